@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sync"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/superfly/litefs/http"
+)
+
+var _ http.Executor = (*SQLExecutor)(nil)
+
+// SQLExecutor executes forwarded writes against databases in the FUSE mount
+// so that they are recorded & replicated like any other write.
+type SQLExecutor struct {
+	mu  sync.Mutex
+	dbs map[string]*sql.DB
+
+	// Path to the FUSE mount directory.
+	Dir string
+}
+
+// NewSQLExecutor returns a new instance of SQLExecutor.
+func NewSQLExecutor(dir string) *SQLExecutor {
+	return &SQLExecutor{
+		dbs: make(map[string]*sql.DB),
+		Dir: dir,
+	}
+}
+
+// Close closes all open database connections.
+func (e *SQLExecutor) Close() (err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for name, db := range e.dbs {
+		if closeErr := db.Close(); err == nil {
+			err = closeErr
+		}
+		delete(e.dbs, name)
+	}
+	return err
+}
+
+// Exec executes stmts in a single transaction against the named database.
+// The transaction is rolled back if any statement fails.
+func (e *SQLExecutor) Exec(ctx context.Context, name string, stmts []http.Statement) (_ []*http.ExecResult, err error) {
+	db, err := e.db(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	results := make([]*http.ExecResult, len(stmts))
+	for i, stmt := range stmts {
+		result, err := tx.ExecContext(ctx, stmt.SQL, stmt.Args...)
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: %w", i, err)
+		}
+
+		results[i] = &http.ExecResult{}
+		if results[i].RowsAffected, err = result.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("statement %d: rows affected: %w", i, err)
+		} else if results[i].LastInsertID, err = result.LastInsertId(); err != nil {
+			return nil, fmt.Errorf("statement %d: last insert id: %w", i, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return results, nil
+}
+
+// db returns a connection pool for the named database, opening it if needed.
+func (e *SQLExecutor) db(name string) (*sql.DB, error) {
+	if name == "" || name != filepath.Base(name) {
+		return nil, fmt.Errorf("invalid database name: %q", name)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if db := e.dbs[name]; db != nil {
+		return db, nil
+	}
+
+	// Take the write lock at the start of each transaction so that concurrent
+	// writers wait on the busy timeout instead of failing on upgrade.
+	dsn := (&url.URL{
+		Scheme:   "file",
+		Opaque:   filepath.Join(e.Dir, name),
+		RawQuery: "_txlock=immediate&_busy_timeout=5000",
+	}).String()
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	e.dbs[name] = db
+	return db, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/superfly/litefs/http"
+	"github.com/superfly/ltx"
+)
+
+// ExportCommand represents a command to export a database from a cluster.
+type ExportCommand struct {
+	// Source LiteFS URL
+	URL string
+
+	// Name of database on LiteFS cluster.
+	Name string
+
+	// Path to write the SQLite database to.
+	Path string
+}
+
+// NewExportCommand returns a new instance of ExportCommand.
+func NewExportCommand() *ExportCommand {
+	return &ExportCommand{
+		URL: DefaultURL,
+	}
+}
+
+// ParseFlags parses the command line flags & config file.
+func (c *ExportCommand) ParseFlags(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litefs-export", flag.ContinueOnError)
+	fs.StringVar(&c.URL, "url", "http://localhost:20202", "LiteFS API URL")
+	fs.StringVar(&c.Name, "name", "", "database name")
+	fs.Usage = func() {
+		fmt.Println(`
+The export command will download a consistent copy of a SQLite database from a
+LiteFS node. The node can be either the primary or a replica. The file is
+written atomically and its checksum is verified before it is moved into place.
+
+Usage:
+
+	litefs export [arguments] PATH
+
+Arguments:
+`[1:])
+		fs.PrintDefaults()
+		fmt.Println("")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	} else if fs.NArg() > 1 {
+		return fmt.Errorf("too many arguments")
+	} else if c.Name == "" {
+		return fmt.Errorf("database name required")
+	}
+
+	// Copy first arg as database path.
+	c.Path = fs.Arg(0)
+
+	return nil
+}
+
+// Run executes the command.
+func (c *ExportCommand) Run(ctx context.Context) (err error) {
+	t := time.Now()
+
+	// Write to a temporary file first so a partial export never replaces PATH.
+	tmpPath := c.Path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+	}()
+
+	client := http.NewClient()
+	pos, err := client.Export(ctx, c.URL, c.Name, f)
+	if err != nil {
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	} else if err := os.Rename(tmpPath, c.Path); err != nil {
+		return err
+	}
+
+	// Notify user of success and elapsed time.
+	fmt.Printf("Export of database %q @ %s in %s\n", c.Name, ltx.FormatTXID(pos.TXID), time.Since(t))
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package main_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	main "github.com/superfly/litefs/cmd/litefs"
+	"github.com/superfly/litefs/internal/testingutil"
+)
+
+// Ensure a database can be exported from a replica.
+func TestExportCommand(t *testing.T) {
+	dir0, dir1 := t.TempDir(), t.TempDir()
+	m0 := runMountCommand(t, newMountCommand(t, dir0, nil))
+	waitForPrimary(t, m0)
+	m1 := runMountCommand(t, newMountCommand(t, dir1, m0))
+
+	db := testingutil.OpenSQLDB(t, filepath.Join(m0.Config.FUSE.Dir, "db"))
+	if _, err := db.Exec(`CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.Exec(`INSERT INTO t VALUES (100)`); err != nil {
+		t.Fatal(err)
+	}
+	waitForSync(t, "db", m0, m1)
+
+	// Export database from the replica to the regular file system.
+	dsn := filepath.Join(t.TempDir(), "db")
+	cmd := main.NewExportCommand()
+	cmd.URL = m1.HTTPServer.URL()
+	cmd.Name = "db"
+	cmd.Path = dsn
+	if err := cmd.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read from exported database.
+	dbx := testingutil.OpenSQLDB(t, dsn)
+	var x int
+	if err := dbx.QueryRow(`SELECT x FROM t`).Scan(&x); err != nil {
+		t.Fatal(err)
+	} else if got, want := x, 100; got != want {
+		t.Fatalf("x=%d, want %d", got, want)
+	}
+}
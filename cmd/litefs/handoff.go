@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/superfly/litefs/http"
+)
+
+// HandoffCommand represents a command to transfer the primary lease to a replica.
+type HandoffCommand struct {
+	// Target LiteFS URL. Must be the current primary.
+	URL string
+
+	// ID of the node to receive the lease. Uses the most caught-up replica if blank.
+	To string
+
+	// Maximum time to wait for the replica to catch up.
+	Timeout time.Duration
+}
+
+// NewHandoffCommand returns a new instance of HandoffCommand.
+func NewHandoffCommand() *HandoffCommand {
+	return &HandoffCommand{
+		URL:     DefaultURL,
+		Timeout: http.DefaultHandoffTimeout,
+	}
+}
+
+// ParseFlags parses the command line flags.
+func (c *HandoffCommand) ParseFlags(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litefs-handoff", flag.ContinueOnError)
+	fs.StringVar(&c.URL, "url", "http://localhost:20202", "LiteFS API URL of the primary")
+	fs.StringVar(&c.To, "to", "", "node ID to receive the lease")
+	fs.DurationVar(&c.Timeout, "timeout", c.Timeout, "maximum time to wait for the replica to catch up")
+	fs.Usage = func() {
+		fmt.Println(`
+The handoff command moves the primary lease from the current primary to one of
+its replicas. New writes are rejected on the primary until the replica has
+received every transaction, after which the primary releases its lease and the
+replica acquires it. If no node ID is specified, the most caught-up candidate
+replica is chosen.
+
+Usage:
+
+	litefs handoff [arguments]
+
+Arguments:
+`[1:])
+		fs.PrintDefaults()
+		fmt.Println("")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() > 0 {
+		return fmt.Errorf("too many arguments")
+	}
+	return nil
+}
+
+// Run executes the command.
+func (c *HandoffCommand) Run(ctx context.Context) (err error) {
+	if err := http.NewClient().Handoff(ctx, c.URL, c.To, c.Timeout); err != nil {
+		return err
+	}
+
+	if c.To != "" {
+		fmt.Printf("Primary lease handed off to %s.\n", c.To)
+	} else {
+		fmt.Println("Primary lease handed off.")
+	}
+	return nil
+}
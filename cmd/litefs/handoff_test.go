@@ -0,0 +1,134 @@
+package main_test
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	main "github.com/superfly/litefs/cmd/litefs"
+	"github.com/superfly/litefs/internal/testingutil"
+)
+
+// Ensure the primary can hand off its lease to a specific replica.
+func TestHandoffCommand(t *testing.T) {
+	dir0, dir1, dir2 := t.TempDir(), t.TempDir(), t.TempDir()
+	m0 := runMountCommand(t, newMountCommand(t, dir0, nil))
+	waitForPrimary(t, m0)
+	m1 := runMountCommand(t, newMountCommand(t, dir1, m0))
+	m2 := runMountCommand(t, newMountCommand(t, dir2, m0))
+
+	db := testingutil.OpenSQLDB(t, filepath.Join(m0.Config.FUSE.Dir, "db"))
+	if _, err := db.Exec(`CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	}
+	waitForSync(t, "db", m0, m1, m2)
+
+	cmd := main.NewHandoffCommand()
+	cmd.URL = m0.HTTPServer.URL()
+	cmd.To = m2.Store.ID()
+	if err := cmd.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitForPrimary(t, m2)
+
+	if m1.Store.IsPrimary() {
+		t.Fatal("expected non-target replica to remain a replica")
+	}
+
+	// Writes on the new primary should replicate to both other nodes.
+	db2 := testingutil.OpenSQLDB(t, filepath.Join(m2.Config.FUSE.Dir, "db"))
+	if _, err := db2.Exec(`INSERT INTO t VALUES (100)`); err != nil {
+		t.Fatal(err)
+	}
+	waitForSync(t, "db", m0, m1, m2)
+}
+
+// Ensure a replica can request the lease from the current primary.
+func TestServer_Promote(t *testing.T) {
+	dir0, dir1 := t.TempDir(), t.TempDir()
+	m0 := runMountCommand(t, newMountCommand(t, dir0, nil))
+	waitForPrimary(t, m0)
+	m1 := runMountCommand(t, newMountCommand(t, dir1, m0))
+
+	db := testingutil.OpenSQLDB(t, filepath.Join(m0.Config.FUSE.Dir, "db"))
+	if _, err := db.Exec(`CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	}
+	waitForSync(t, "db", m0, m1)
+
+	resp, err := http.Post(m1.HTTPServer.URL()+"/promote", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := resp.Body.Close(); err != nil {
+		t.Fatal(err)
+	} else if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("StatusCode=%d, want %d", got, want)
+	}
+	waitForPrimary(t, m1)
+}
+
+// Ensure demotion is rejected on a replica.
+func TestServer_Demote(t *testing.T) {
+	dir0, dir1 := t.TempDir(), t.TempDir()
+	m0 := runMountCommand(t, newMountCommand(t, dir0, nil))
+	waitForPrimary(t, m0)
+	m1 := runMountCommand(t, newMountCommand(t, dir1, m0))
+
+	resp, err := http.Post(m1.HTTPServer.URL()+"/demote", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := resp.Body.Close(); err != nil {
+		t.Fatal(err)
+	} else if got, want := resp.StatusCode, http.StatusServiceUnavailable; got != want {
+		t.Fatalf("StatusCode=%d, want %d", got, want)
+	}
+}
+
+// Ensure a long-running read transaction does not block a handoff.
+func TestHandoffCommand_ReadTx(t *testing.T) {
+	dir0, dir1 := t.TempDir(), t.TempDir()
+	m0 := runMountCommand(t, newMountCommand(t, dir0, nil))
+	waitForPrimary(t, m0)
+	m1 := runMountCommand(t, newMountCommand(t, dir1, m0))
+
+	db := testingutil.OpenSQLDB(t, filepath.Join(m0.Config.FUSE.Dir, "db"))
+	if _, err := db.Exec(`PRAGMA journal_mode = wal`); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.Exec(`CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.Exec(`INSERT INTO t VALUES (100)`); err != nil {
+		t.Fatal(err)
+	}
+	waitForSync(t, "db", m0, m1)
+
+	// Hold a read transaction open for the duration of the handoff.
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var n int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM t`).Scan(&n); err != nil {
+		t.Fatal(err)
+	} else if got, want := n, 1; got != want {
+		t.Fatalf("n=%d, want %d", got, want)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cmd := main.NewHandoffCommand()
+	cmd.URL = m0.HTTPServer.URL()
+	cmd.To = m1.Store.ID()
+	if err := cmd.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitForPrimary(t, m1)
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/superfly/litefs"
+)
+
+// runJournal executes a "journal" subcommand.
+func runJournal(ctx context.Context, args []string) error {
+	var cmd string
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "dump":
+		c := NewJournalDumpCommand()
+		if err := c.ParseFlags(ctx, args); err != nil {
+			return err
+		}
+		return c.Run(ctx)
+
+	default:
+		if cmd == "" || cmd == "help" || strings.HasPrefix(cmd, "-") {
+			fmt.Println(`
+The journal commands inspect SQLite rollback journal files.
+
+Usage:
+
+	litefs journal <command> [arguments]
+
+The commands are:
+
+	dump         print the segments & frames of a journal file
+`[1:])
+			return flag.ErrHelp
+		}
+		return fmt.Errorf("litefs journal %s: unknown command", cmd)
+	}
+}
+
+// JournalDumpCommand represents a command to print the contents of a journal file.
+type JournalDumpCommand struct {
+	// Path to the journal file.
+	Path string
+
+	// Database page size. Read from the journal header if zero.
+	PageSize uint32
+
+	// Output stream. Defaults to STDOUT.
+	Stdout io.Writer
+}
+
+// NewJournalDumpCommand returns a new instance of JournalDumpCommand.
+func NewJournalDumpCommand() *JournalDumpCommand {
+	return &JournalDumpCommand{Stdout: os.Stdout}
+}
+
+// ParseFlags parses the command line flags.
+func (c *JournalDumpCommand) ParseFlags(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litefs-journal-dump", flag.ContinueOnError)
+	pageSize := fs.Uint("page-size", 0, "database page size, read from journal header if unset")
+	fs.Usage = func() {
+		fmt.Println(`
+The dump command prints each segment of a rollback journal along with the page
+number of each valid frame. Reading stops at the first invalid frame, the same
+as SQLite does during recovery.
+
+Usage:
+
+	litefs journal dump [arguments] PATH
+
+Arguments:
+`[1:])
+		fs.PrintDefaults()
+		fmt.Println("")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	} else if fs.NArg() > 1 {
+		return fmt.Errorf("too many arguments")
+	}
+	c.Path, c.PageSize = fs.Arg(0), uint32(*pageSize)
+	return nil
+}
+
+// Run executes the command.
+func (c *JournalDumpCommand) Run(ctx context.Context) (err error) {
+	f, err := os.Open(c.Path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	// Read page size from the journal header if not specified.
+	pageSize := c.PageSize
+	if pageSize == 0 {
+		buf := make([]byte, litefs.SQLITE_JOURNAL_HEADER_SIZE)
+		if _, err := io.ReadFull(f, buf); err != nil {
+			return fmt.Errorf("read journal header: %w", err)
+		} else if pageSize = binary.BigEndian.Uint32(buf[24:]); pageSize == 0 {
+			return fmt.Errorf("journal header has no page size, use -page-size")
+		}
+	}
+
+	r := litefs.NewJournalReader(f, pageSize)
+	for i := 0; ; i++ {
+		if err := r.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("read segment %d: %w", i, err)
+		}
+
+		fmt.Fprintf(c.Stdout, "Segment %d: database size=%d bytes\n", i, r.DatabaseSize())
+		for {
+			pgno, data, err := r.ReadFrame()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("read frame: %w", err)
+			}
+			fmt.Fprintf(c.Stdout, "  pgno=%d size=%d\n", pgno, len(data))
+		}
+	}
+
+	if !r.IsValid() {
+		fmt.Fprintln(c.Stdout, "No valid journal header found.")
+	}
+	return nil
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/superfly/ltx"
+)
+
+// runLTX executes an "ltx" subcommand.
+func runLTX(ctx context.Context, args []string) error {
+	var cmd string
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "list":
+		c := NewLTXListCommand()
+		if err := c.ParseFlags(ctx, args); err != nil {
+			return err
+		}
+		return c.Run(ctx)
+
+	case "dump":
+		c := NewLTXDumpCommand()
+		if err := c.ParseFlags(ctx, args); err != nil {
+			return err
+		}
+		return c.Run(ctx)
+
+	case "verify":
+		c := NewLTXVerifyCommand()
+		if err := c.ParseFlags(ctx, args); err != nil {
+			return err
+		}
+		return c.Run(ctx)
+
+	default:
+		if cmd == "" || cmd == "help" || strings.HasPrefix(cmd, "-") {
+			fmt.Println(`
+The ltx commands inspect the LTX transaction files in a LiteFS data directory.
+
+Usage:
+
+	litefs ltx <command> [arguments]
+
+The commands are:
+
+	list         list LTX files for each database
+	dump         print the header, pages & trailer of an LTX file
+	verify       verify LTX file checksums & continuity
+`[1:])
+			return flag.ErrHelp
+		}
+		return fmt.Errorf("litefs ltx %s: unknown command", cmd)
+	}
+}
+
+// LTXListCommand represents a command to list the LTX files in a data directory.
+type LTXListCommand struct {
+	// Path to the LiteFS data directory.
+	DataDir string
+
+	// Database names to list. Lists all databases if empty.
+	Names []string
+
+	// Output stream. Defaults to STDOUT.
+	Stdout io.Writer
+}
+
+// NewLTXListCommand returns a new instance of LTXListCommand.
+func NewLTXListCommand() *LTXListCommand {
+	return &LTXListCommand{Stdout: os.Stdout}
+}
+
+// ParseFlags parses the command line flags.
+func (c *LTXListCommand) ParseFlags(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litefs-ltx-list", flag.ContinueOnError)
+	fs.StringVar(&c.DataDir, "data-dir", "", "LiteFS data directory")
+	fs.Usage = func() {
+		fmt.Println(`
+The list command prints the header & trailer of every LTX file for each
+database in the data directory. Gaps between transaction IDs are reported.
+
+Usage:
+
+	litefs ltx list [arguments] [NAME...]
+
+Arguments:
+`[1:])
+		fs.PrintDefaults()
+		fmt.Println("")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if c.DataDir == "" {
+		return fmt.Errorf("data directory required")
+	}
+	c.Names = fs.Args()
+	return nil
+}
+
+// Run executes the command.
+func (c *LTXListCommand) Run(ctx context.Context) (err error) {
+	names, err := listDataDirDBs(c.DataDir, c.Names)
+	if err != nil {
+		return err
+	}
+
+	for i, name := range names {
+		if i > 0 {
+			fmt.Fprintln(c.Stdout, "")
+		}
+		fmt.Fprintf(c.Stdout, "%s:\n", name)
+
+		filenames, err := listLTXFiles(c.DataDir, name)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(c.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "MIN_TXID\tMAX_TXID\tPRE_CHECKSUM\tPOST_CHECKSUM\tCOMMIT\tSIZE\tTIMESTAMP")
+
+		var prev *ltx.Header
+		var gaps []string
+		for _, filename := range filenames {
+			hdr, trailer, size, err := readLTXHeaderAndTrailer(filename)
+			if err != nil {
+				fmt.Fprintf(w, "%s\terror: %s\n", filepath.Base(filename), err)
+				continue
+			}
+
+			if prev != nil && prev.MaxTXID+1 != hdr.MinTXID {
+				gaps = append(gaps, fmt.Sprintf("%s-%s", ltx.FormatTXID(prev.MaxTXID+1), ltx.FormatTXID(hdr.MinTXID-1)))
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%016x\t%016x\t%d\t%d\t%s\n",
+				ltx.FormatTXID(hdr.MinTXID),
+				ltx.FormatTXID(hdr.MaxTXID),
+				hdr.PreApplyChecksum,
+				trailer.PostApplyChecksum,
+				hdr.Commit,
+				size,
+				time.UnixMilli(hdr.Timestamp).UTC().Format(time.RFC3339Nano),
+			)
+			prev = &hdr
+		}
+
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		for _, gap := range gaps {
+			fmt.Fprintf(c.Stdout, "gap: %s\n", gap)
+		}
+	}
+
+	return nil
+}
+
+// LTXDumpCommand represents a command to print the contents of an LTX file.
+type LTXDumpCommand struct {
+	// Path to the LTX file.
+	Path string
+
+	// Output stream. Defaults to STDOUT.
+	Stdout io.Writer
+}
+
+// NewLTXDumpCommand returns a new instance of LTXDumpCommand.
+func NewLTXDumpCommand() *LTXDumpCommand {
+	return &LTXDumpCommand{Stdout: os.Stdout}
+}
+
+// ParseFlags parses the command line flags.
+func (c *LTXDumpCommand) ParseFlags(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litefs-ltx-dump", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Println(`
+The dump command prints the header, page numbers with page checksums, and the
+trailer of an LTX file. The file checksum is verified after all pages are read.
+
+Usage:
+
+	litefs ltx dump PATH
+`[1:])
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	} else if fs.NArg() > 1 {
+		return fmt.Errorf("too many arguments")
+	}
+	c.Path = fs.Arg(0)
+	return nil
+}
+
+// Run executes the command.
+func (c *LTXDumpCommand) Run(ctx context.Context) (err error) {
+	f, err := os.Open(c.Path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	dec := ltx.NewDecoder(f)
+	if err := dec.DecodeHeader(); err != nil {
+		return fmt.Errorf("decode header: %w", err)
+	}
+
+	hdr := dec.Header()
+	fmt.Fprintf(c.Stdout, "Header:\n")
+	fmt.Fprintf(c.Stdout, "  Version:   %d\n", hdr.Version)
+	fmt.Fprintf(c.Stdout, "  Flags:     0x%08x\n", hdr.Flags)
+	fmt.Fprintf(c.Stdout, "  PageSize:  %d\n", hdr.PageSize)
+	fmt.Fprintf(c.Stdout, "  Commit:    %d\n", hdr.Commit)
+	fmt.Fprintf(c.Stdout, "  MinTXID:   %s\n", ltx.FormatTXID(hdr.MinTXID))
+	fmt.Fprintf(c.Stdout, "  MaxTXID:   %s\n", ltx.FormatTXID(hdr.MaxTXID))
+	fmt.Fprintf(c.Stdout, "  Timestamp: %s\n", time.UnixMilli(hdr.Timestamp).UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(c.Stdout, "  PreApply:  %016x\n", hdr.PreApplyChecksum)
+	fmt.Fprintf(c.Stdout, "  WALOffset: %d\n", hdr.WALOffset)
+	fmt.Fprintf(c.Stdout, "  WALSize:   %d\n", hdr.WALSize)
+	fmt.Fprintf(c.Stdout, "  WALSalt:   %08x %08x\n", hdr.WALSalt1, hdr.WALSalt2)
+	fmt.Fprintln(c.Stdout, "")
+
+	fmt.Fprintf(c.Stdout, "Pages:\n")
+	data := make([]byte, hdr.PageSize)
+	for {
+		var phdr ltx.PageHeader
+		if err := dec.DecodePage(&phdr, data); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("decode page: %w", err)
+		}
+		fmt.Fprintf(c.Stdout, "  pgno=%d checksum=%016x\n", phdr.Pgno, ltx.ChecksumPage(phdr.Pgno, data))
+	}
+	fmt.Fprintln(c.Stdout, "")
+
+	if err := dec.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+
+	trailer := dec.Trailer()
+	fmt.Fprintf(c.Stdout, "Trailer:\n")
+	fmt.Fprintf(c.Stdout, "  PostApply: %016x\n", trailer.PostApplyChecksum)
+	fmt.Fprintf(c.Stdout, "  File:      %016x\n", trailer.FileChecksum)
+
+	return nil
+}
+
+// LTXVerifyCommand represents a command to verify the LTX files in a data directory.
+type LTXVerifyCommand struct {
+	// Path to the LiteFS data directory.
+	DataDir string
+
+	// Database names to verify. Verifies all databases if empty.
+	Names []string
+
+	// Output stream. Defaults to STDOUT.
+	Stdout io.Writer
+}
+
+// NewLTXVerifyCommand returns a new instance of LTXVerifyCommand.
+func NewLTXVerifyCommand() *LTXVerifyCommand {
+	return &LTXVerifyCommand{Stdout: os.Stdout}
+}
+
+// ParseFlags parses the command line flags.
+func (c *LTXVerifyCommand) ParseFlags(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litefs-ltx-verify", flag.ContinueOnError)
+	fs.StringVar(&c.DataDir, "data-dir", "", "LiteFS data directory")
+	fs.Usage = func() {
+		fmt.Println(`
+The verify command reads every LTX file for each database in the data directory
+and verifies its file checksum. It also checks that the transaction IDs are
+contiguous and that each file's pre-apply checksum matches the post-apply
+checksum of the previous file. Exits with an error if any problems are found.
+
+Usage:
+
+	litefs ltx verify [arguments] [NAME...]
+
+Arguments:
+`[1:])
+		fs.PrintDefaults()
+		fmt.Println("")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if c.DataDir == "" {
+		return fmt.Errorf("data directory required")
+	}
+	c.Names = fs.Args()
+	return nil
+}
+
+// Run executes the command.
+func (c *LTXVerifyCommand) Run(ctx context.Context) (err error) {
+	names, err := listDataDirDBs(c.DataDir, c.Names)
+	if err != nil {
+		return err
+	}
+
+	var problemN int
+	for _, name := range names {
+		problems, err := verifyLTXFiles(c.DataDir, name)
+		if err != nil {
+			return err
+		}
+
+		for _, problem := range problems {
+			fmt.Fprintf(c.Stdout, "%s: %s\n", name, problem)
+		}
+		problemN += len(problems)
+	}
+
+	if problemN > 0 {
+		return fmt.Errorf("%d problem(s) found", problemN)
+	}
+	fmt.Fprintf(c.Stdout, "%d database(s) ok\n", len(names))
+	return nil
+}
+
+// verifyLTXFiles verifies the LTX files for a single database and returns a
+// description of each problem found.
+func verifyLTXFiles(dataDir, name string) ([]string, error) {
+	filenames, err := listLTXFiles(dataDir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	var prevHeader *ltx.Header
+	var prevTrailer ltx.Trailer
+	for _, filename := range filenames {
+		hdr, trailer, err := verifyLTXFile(filename)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", filepath.Base(filename), err))
+			prevHeader = nil
+			continue
+		}
+
+		if minTXID, maxTXID, err := ltx.ParseFilename(filepath.Base(filename)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: invalid filename", filepath.Base(filename)))
+		} else if minTXID != hdr.MinTXID || maxTXID != hdr.MaxTXID {
+			problems = append(problems, fmt.Sprintf("%s: filename does not match header txid range %s-%s",
+				filepath.Base(filename), ltx.FormatTXID(hdr.MinTXID), ltx.FormatTXID(hdr.MaxTXID)))
+		}
+
+		if prevHeader != nil {
+			if prevHeader.MaxTXID+1 != hdr.MinTXID {
+				problems = append(problems, fmt.Sprintf("txid gap: %s-%s",
+					ltx.FormatTXID(prevHeader.MaxTXID+1), ltx.FormatTXID(hdr.MinTXID-1)))
+			} else if prevTrailer.PostApplyChecksum != hdr.PreApplyChecksum {
+				problems = append(problems, fmt.Sprintf("%s: pre-apply checksum %016x does not match previous post-apply checksum %016x",
+					filepath.Base(filename), hdr.PreApplyChecksum, prevTrailer.PostApplyChecksum))
+			}
+
+			if prevHeader.PageSize != hdr.PageSize {
+				problems = append(problems, fmt.Sprintf("%s: page size changed from %d to %d",
+					filepath.Base(filename), prevHeader.PageSize, hdr.PageSize))
+			}
+		}
+
+		prevHeader, prevTrailer = &hdr, trailer
+	}
+
+	return problems, nil
+}
+
+// verifyLTXFile reads an entire LTX file and verifies its file checksum.
+func verifyLTXFile(filename string) (ltx.Header, ltx.Trailer, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return ltx.Header{}, ltx.Trailer{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	dec := ltx.NewDecoder(f)
+	if err := dec.Verify(); err != nil {
+		return ltx.Header{}, ltx.Trailer{}, err
+	}
+	return dec.Header(), dec.Trailer(), nil
+}
+
+// readLTXHeaderAndTrailer reads the header & trailer of an LTX file without
+// reading the page data. Also returns the file size.
+func readLTXHeaderAndTrailer(filename string) (hdr ltx.Header, trailer ltx.Trailer, size int64, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return hdr, trailer, 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return hdr, trailer, 0, err
+	} else if fi.Size() < ltx.HeaderSize+ltx.TrailerSize {
+		return hdr, trailer, fi.Size(), fmt.Errorf("file too small: %d bytes", fi.Size())
+	}
+
+	buf := make([]byte, ltx.HeaderSize)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return hdr, trailer, fi.Size(), err
+	} else if err := hdr.UnmarshalBinary(buf); err != nil {
+		return hdr, trailer, fi.Size(), fmt.Errorf("unmarshal header: %w", err)
+	}
+
+	buf = make([]byte, ltx.TrailerSize)
+	if _, err := f.ReadAt(buf, fi.Size()-ltx.TrailerSize); err != nil {
+		return hdr, trailer, fi.Size(), err
+	} else if err := trailer.UnmarshalBinary(buf); err != nil {
+		return hdr, trailer, fi.Size(), fmt.Errorf("unmarshal trailer: %w", err)
+	}
+
+	return hdr, trailer, fi.Size(), nil
+}
+
+// listDataDirDBs returns the names of the databases in the data directory. If
+// names is not empty, it is returned after verifying each database exists.
+func listDataDirDBs(dataDir string, names []string) ([]string, error) {
+	dbsDir := filepath.Join(dataDir, "dbs")
+
+	if len(names) > 0 {
+		for _, name := range names {
+			if _, err := os.Stat(filepath.Join(dbsDir, name)); err != nil {
+				return nil, err
+			}
+		}
+		return names, nil
+	}
+
+	ents, err := os.ReadDir(dbsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	names = make([]string, 0, len(ents))
+	for _, ent := range ents {
+		if ent.IsDir() {
+			names = append(names, ent.Name())
+		}
+	}
+	return names, nil
+}
+
+// listLTXFiles returns the paths of all LTX files for a database, sorted by TXID.
+func listLTXFiles(dataDir, name string) ([]string, error) {
+	dir := filepath.Join(dataDir, "dbs", name, "ltx")
+	ents, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var filenames []string
+	for _, ent := range ents {
+		if filepath.Ext(ent.Name()) == ".ltx" {
+			filenames = append(filenames, filepath.Join(dir, ent.Name()))
+		}
+	}
+
+	// Filenames use fixed-width hex TXIDs so lexical order is TXID order.
+	sort.Strings(filenames)
+	return filenames, nil
+}
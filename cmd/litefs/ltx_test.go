@@ -0,0 +1,144 @@
+package main_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	main "github.com/superfly/litefs/cmd/litefs"
+	"github.com/superfly/ltx"
+)
+
+func TestLTXListCommand(t *testing.T) {
+	dataDir := t.TempDir()
+	writeLTXFile(t, dataDir, "db", 1, 1, 0, 1000)
+	writeLTXFile(t, dataDir, "db", 2, 2, 1000, 2000)
+	writeLTXFile(t, dataDir, "db", 4, 4, 3000, 4000)
+
+	var buf bytes.Buffer
+	cmd := main.NewLTXListCommand()
+	cmd.DataDir, cmd.Stdout = dataDir, &buf
+	if err := cmd.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "0000000000000002  0000000000000002") {
+		t.Fatalf("expected file in output: %s", out)
+	} else if !strings.Contains(out, "gap: 0000000000000003-0000000000000003\n") {
+		t.Fatalf("expected gap in output: %s", out)
+	}
+}
+
+func TestLTXDumpCommand(t *testing.T) {
+	var buf bytes.Buffer
+	cmd := main.NewLTXDumpCommand()
+	cmd.Path, cmd.Stdout = "../../testdata/store/open-and-write-snapshot/dbs/sqlite.db/ltx/000000000000000d-000000000000000d.ltx", &buf
+	if err := cmd.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "MinTXID:   000000000000000d") {
+		t.Fatalf("expected header in output: %s", out)
+	} else if !strings.Contains(out, "pgno=1 ") {
+		t.Fatalf("expected page in output: %s", out)
+	}
+}
+
+func TestLTXVerifyCommand(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		dataDir := t.TempDir()
+		writeLTXFile(t, dataDir, "db", 1, 1, 0, 1000)
+		writeLTXFile(t, dataDir, "db", 2, 3, 1000, 2000)
+
+		cmd := main.NewLTXVerifyCommand()
+		cmd.DataDir, cmd.Stdout = dataDir, &bytes.Buffer{}
+		if err := cmd.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("ErrGap", func(t *testing.T) {
+		dataDir := t.TempDir()
+		writeLTXFile(t, dataDir, "db", 1, 1, 0, 1000)
+		writeLTXFile(t, dataDir, "db", 3, 3, 1000, 2000)
+
+		var buf bytes.Buffer
+		cmd := main.NewLTXVerifyCommand()
+		cmd.DataDir, cmd.Stdout = dataDir, &buf
+		if err := cmd.Run(context.Background()); err == nil || err.Error() != `1 problem(s) found` {
+			t.Fatalf("unexpected error: %v", err)
+		} else if got, want := buf.String(), "db: txid gap: 0000000000000002-0000000000000002\n"; got != want {
+			t.Fatalf("output=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("ErrChecksumMismatch", func(t *testing.T) {
+		dataDir := t.TempDir()
+		writeLTXFile(t, dataDir, "db", 1, 1, 0, 1000)
+		writeLTXFile(t, dataDir, "db", 2, 2, 1001, 2000)
+
+		var buf bytes.Buffer
+		cmd := main.NewLTXVerifyCommand()
+		cmd.DataDir, cmd.Stdout = dataDir, &buf
+		if err := cmd.Run(context.Background()); err == nil {
+			t.Fatal("expected error")
+		} else if !strings.Contains(buf.String(), "pre-apply checksum") {
+			t.Fatalf("unexpected output: %s", buf.String())
+		}
+	})
+}
+
+func TestWALDumpCommand(t *testing.T) {
+	var buf bytes.Buffer
+	cmd := main.NewWALDumpCommand()
+	cmd.Path, cmd.Stdout = "../../testdata/wal-reader/ok/wal", &buf
+	if err := cmd.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(buf.String(), "Header: page size=4096") {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+}
+
+// writeLTXFile writes a single-page LTX file to a database in a data directory.
+// Checksums are arbitrary values with the checksum flag set.
+func writeLTXFile(tb testing.TB, dataDir, name string, minTXID, maxTXID, preApplyChecksum, postApplyChecksum uint64) {
+	tb.Helper()
+
+	dir := filepath.Join(dataDir, "dbs", name, "ltx")
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		tb.Fatal(err)
+	}
+
+	hdr := ltx.Header{
+		Version:   ltx.Version,
+		PageSize:  512,
+		Commit:    1,
+		MinTXID:   minTXID,
+		MaxTXID:   maxTXID,
+		Timestamp: 1000,
+	}
+	if preApplyChecksum != 0 {
+		hdr.PreApplyChecksum = ltx.ChecksumFlag | preApplyChecksum
+	}
+
+	var buf bytes.Buffer
+	enc := ltx.NewEncoder(&buf)
+	if err := enc.EncodeHeader(hdr); err != nil {
+		tb.Fatal(err)
+	} else if err := enc.EncodePage(ltx.PageHeader{Pgno: 1}, make([]byte, 512)); err != nil {
+		tb.Fatal(err)
+	}
+	enc.SetPostApplyChecksum(ltx.ChecksumFlag | postApplyChecksum)
+	if err := enc.Close(); err != nil {
+		tb.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, ltx.FormatFilename(minTXID, maxTXID)), buf.Bytes(), 0666); err != nil {
+		tb.Fatal(err)
+	}
+}
@@ -10,12 +10,15 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"path"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/mattn/go-shellwords"
 	"github.com/superfly/litefs"
 	"github.com/superfly/litefs/http"
 	"gopkg.in/yaml.v3"
@@ -49,6 +52,20 @@ func run(ctx context.Context, args []string) error {
 	}
 
 	switch cmd {
+	case "export":
+		c := NewExportCommand()
+		if err := c.ParseFlags(ctx, args); err != nil {
+			return err
+		}
+		return c.Run(ctx)
+
+	case "handoff":
+		c := NewHandoffCommand()
+		if err := c.ParseFlags(ctx, args); err != nil {
+			return err
+		}
+		return c.Run(ctx)
+
 	case "import":
 		c := NewImportCommand()
 		if err := c.ParseFlags(ctx, args); err != nil {
@@ -56,9 +73,32 @@ func run(ctx context.Context, args []string) error {
 		}
 		return c.Run(ctx)
 
+	case "journal":
+		return runJournal(ctx, args)
+
+	case "ltx":
+		return runLTX(ctx, args)
+
 	case "mount":
 		return runMount(ctx, args)
 
+	case "wal":
+		return runWAL(ctx, args)
+
+	case "status":
+		c := NewStatusCommand()
+		if err := c.ParseFlags(ctx, args); err != nil {
+			return err
+		}
+		return c.Run(ctx)
+
+	case "verify":
+		c := NewVerifyCommand()
+		if err := c.ParseFlags(ctx, args); err != nil {
+			return err
+		}
+		return c.Run(ctx)
+
 	case "version":
 		fmt.Println(VersionString())
 		return nil
@@ -74,7 +114,7 @@ func run(ctx context.Context, args []string) error {
 
 func runMount(ctx context.Context, args []string) error {
 	signalCh := make(chan os.Signal, 2)
-	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
 	ctx, cancel := context.WithCancel(ctx)
 
@@ -114,38 +154,48 @@ func runMount(ctx context.Context, args []string) error {
 
 	fmt.Println("waiting for signal or subprocess to exit")
 
-	// Wait for signal or subcommand exit to stop program.
+	// Wait for signal or subcommand exit to stop program. A SIGHUP reloads
+	// the config file and continues waiting.
 	var exitCode int
-	select {
-	case err := <-c.ExecCh():
-		cancel()
-
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			exitCode = exitErr.ProcessState.ExitCode()
-			fmt.Printf("subprocess exited with error code %d, litefs shutting down\n", exitCode)
-		} else if err != nil {
-			exitCode = 1
-			fmt.Printf("subprocess exited with error, litefs shutting down: %s\n", err)
-		} else {
-			fmt.Println("subprocess exited successfully, litefs shutting down")
-		}
+	for done := false; !done; {
+		select {
+		case err := <-c.ExecCh():
+			cancel()
+			done = true
+
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				exitCode = exitErr.ProcessState.ExitCode()
+				fmt.Printf("subprocess exited with error code %d, litefs shutting down\n", exitCode)
+			} else if err != nil {
+				exitCode = 1
+				fmt.Printf("subprocess exited with error, litefs shutting down: %s\n", err)
+			} else {
+				fmt.Println("subprocess exited successfully, litefs shutting down")
+			}
 
-	case sig := <-signalCh:
-		if cmd := c.Cmd(); cmd != nil {
-			fmt.Println("sending signal to exec process")
-			if err := cmd.Process.Signal(sig); err != nil {
-				return fmt.Errorf("cannot signal exec process: %w", err)
+		case sig := <-signalCh:
+			if sig == syscall.SIGHUP {
+				fmt.Println("SIGHUP received, reloading config")
+				if err := c.Reload(ctx); err != nil {
+					fmt.Fprintf(os.Stderr, "ERROR: cannot reload config: %s\n", err)
+				}
+				continue
 			}
 
-			fmt.Println("waiting for exec process to close")
-			if err := <-c.ExecCh(); err != nil && !strings.HasPrefix(err.Error(), "signal:") {
-				return fmt.Errorf("cannot wait for exec process: %w", err)
+			// Move the lease to a replica before shutting down, if we are primary.
+			if sig == syscall.SIGTERM {
+				c.Handoff(ctx)
 			}
-		}
 
-		cancel()
-		fmt.Println("signal received, litefs shutting down")
+			// Stop exec processes in reverse order of when they were started.
+			fmt.Println("stopping exec processes")
+			c.StopProcesses(sig)
+
+			cancel()
+			done = true
+			fmt.Println("signal received, litefs shutting down")
+		}
 	}
 
 	if err := c.Close(); err != nil {
@@ -162,16 +212,21 @@ func runMount(ctx context.Context, args []string) error {
 
 // Config represents a configuration for the binary process.
 type Config struct {
-	Exec         string `yaml:"exec"`
-	ExitOnError  bool   `yaml:"exit-on-error"`
-	SkipSync     bool   `yaml:"skip-sync"`
-	StrictVerify bool   `yaml:"strict-verify"`
-
-	Data    DataConfig    `yaml:"data"`
-	FUSE    FUSEConfig    `yaml:"fuse"`
-	HTTP    HTTPConfig    `yaml:"http"`
-	Lease   LeaseConfig   `yaml:"lease"`
-	Tracing TracingConfig `yaml:"tracing"`
+	Exec         ExecConfigSlice `yaml:"exec"`
+	ExitOnError  bool            `yaml:"exit-on-error"`
+	SkipSync     bool            `yaml:"skip-sync"`
+	StrictVerify bool            `yaml:"strict-verify"`
+
+	Data       DataConfig       `yaml:"data"`
+	Databases  []DatabaseConfig `yaml:"databases"`
+	Backup     BackupConfig     `yaml:"backup"`
+	Checkpoint CheckpointConfig `yaml:"checkpoint"`
+	FUSE       FUSEConfig       `yaml:"fuse"`
+	HTTP       HTTPConfig       `yaml:"http"`
+	Hooks      HooksConfig      `yaml:"hooks"`
+	Lease      LeaseConfig      `yaml:"lease"`
+	Proxy      ProxyConfig      `yaml:"proxy"`
+	Tracing    TracingConfig    `yaml:"tracing"`
 }
 
 // NewConfig returns a new instance of Config with defaults set.
@@ -182,12 +237,24 @@ func NewConfig() Config {
 	config.Data.Compress = true
 	config.Data.Retention = litefs.DefaultRetention
 	config.Data.RetentionMonitorInterval = litefs.DefaultRetentionMonitorInterval
+	config.Data.DiskSpaceMonitorInterval = litefs.DefaultDiskSpaceMonitorInterval
+
+	config.Backup.Interval = litefs.DefaultBackupInterval
+	config.Backup.Retain = litefs.DefaultBackupRetain
+
+	config.Checkpoint.Mode = string(litefs.DefaultCheckpointMode)
+	config.Checkpoint.Interval = litefs.DefaultCheckpointMonitorInterval
 
 	config.HTTP.Addr = http.DefaultAddr
 
+	config.Proxy.ReadTimeout = http.DefaultProxyReadTimeout
+	config.Proxy.CookieExpiry = http.DefaultProxyCookieExpiry
+
 	config.Lease.Candidate = true
 	config.Lease.ReconnectDelay = litefs.DefaultReconnectDelay
 	config.Lease.DemoteDelay = litefs.DefaultDemoteDelay
+	config.Lease.HandoffDelay = litefs.DefaultHandoffDelay
+	config.Lease.HandoffTimeout = DefaultHandoffTimeout
 
 	config.Tracing.MaxSize = DefaultTracingMaxSize
 	config.Tracing.MaxCount = DefaultTracingMaxCount
@@ -204,6 +271,51 @@ type DataConfig struct {
 
 	Retention                time.Duration `yaml:"retention"`
 	RetentionMonitorInterval time.Duration `yaml:"retention-monitor-interval"`
+
+	MinFreeSpace             int64         `yaml:"min-free-space"`
+	DiskSpaceMonitorInterval time.Duration `yaml:"disk-space-monitor-interval"`
+}
+
+// DatabaseConfig represents settings that override the data & backup settings
+// for databases whose name matches a name or glob pattern. Unset fields fall
+// back to the settings in the "data" & "backup" sections.
+type DatabaseConfig struct {
+	Name string `yaml:"name"`
+
+	Compress  *bool          `yaml:"compress"`
+	Retention *time.Duration `yaml:"retention"`
+
+	// If false, the database is not streamed to replicas.
+	Replicate *bool `yaml:"replicate"`
+
+	// Maximum size of the database, in bytes.
+	MaxSize *int64 `yaml:"max-size"`
+
+	// Backup interval & number of backups kept. A zero interval disables
+	// backups of the database.
+	BackupInterval *time.Duration `yaml:"backup-interval"`
+	BackupRetain   *int           `yaml:"backup-retain"`
+}
+
+// BackupConfig represents the configuration for periodic database backups
+// written by the primary. Backups are disabled if the directory is blank.
+type BackupConfig struct {
+	Dir      string        `yaml:"dir"`
+	Interval time.Duration `yaml:"interval"`
+	Retain   int           `yaml:"retain"`
+}
+
+// CheckpointConfig represents the configuration for checkpoints performed by
+// the primary when the WAL grows too large.
+type CheckpointConfig struct {
+	// WAL size, in bytes, that triggers a checkpoint. Zero disables.
+	Threshold int64 `yaml:"threshold"`
+
+	// Checkpoint mode: "PASSIVE", "FULL", or "TRUNCATE".
+	Mode string `yaml:"mode"`
+
+	// Frequency with which to check the WAL size.
+	Interval time.Duration `yaml:"interval"`
 }
 
 // FUSEConfig represents the configuration for the FUSE file system.
@@ -211,11 +323,46 @@ type FUSEConfig struct {
 	Dir        string `yaml:"dir"`
 	AllowOther bool   `yaml:"allow-other"`
 	Debug      bool   `yaml:"debug"`
+
+	// Interval between checks for locks left behind by exited processes.
+	// Uses the file system default if zero & disables checks if negative.
+	StaleLockInterval time.Duration `yaml:"stale-lock-interval"`
 }
 
 // HTTPConfig represents the configuration for the HTTP server.
 type HTTPConfig struct {
-	Addr string `yaml:"addr"`
+	Addr            string `yaml:"addr"`
+	WriteForwarding bool   `yaml:"write-forwarding"`
+}
+
+// ProxyConfig represents the configuration for the HTTP proxy server. The
+// proxy is disabled if the address is blank.
+type ProxyConfig struct {
+	Addr            string        `yaml:"addr"`
+	Target          string        `yaml:"target"`
+	DB              string        `yaml:"db"`
+	ReadOnlyMethods []string      `yaml:"read-only-methods"`
+	ReadOnlyPaths   []string      `yaml:"read-only-paths"`
+	ReadTimeout     time.Duration `yaml:"read-timeout"`
+	CookieExpiry    time.Duration `yaml:"cookie-expiry"`
+}
+
+// Validate returns an error if the proxy is enabled but misconfigured.
+func (c *ProxyConfig) Validate() error {
+	if c.Addr == "" {
+		return nil
+	} else if c.Target == "" {
+		return fmt.Errorf("proxy target required")
+	} else if c.DB == "" {
+		return fmt.Errorf("proxy database required")
+	}
+
+	for _, pattern := range c.ReadOnlyPaths {
+		if _, err := path.Match(pattern, "/"); err != nil {
+			return fmt.Errorf("invalid proxy read-only path %q: %w", pattern, err)
+		}
+	}
+	return nil
 }
 
 // LeaseConfig represents a generic configuration for all lease types.
@@ -243,6 +390,14 @@ type LeaseConfig struct {
 	// become primary again.
 	DemoteDelay time.Duration `yaml:"demote-delay"`
 
+	// Amount of time other nodes wait for the target of a lease handoff to
+	// become primary before attempting to acquire the lease themselves.
+	HandoffDelay time.Duration `yaml:"handoff-delay"`
+
+	// Maximum time to wait for a replica to catch up when handing off the
+	// lease on SIGTERM. Set to zero to release the lease without a handoff.
+	HandoffTimeout time.Duration `yaml:"handoff-timeout"`
+
 	// Consul lease settings.
 	Consul struct {
 		URL       string        `yaml:"url"`
@@ -252,6 +407,207 @@ type LeaseConfig struct {
 	} `yaml:"consul"`
 }
 
+// reloadableConfigFields are the config fields, by YAML path, that can be
+// changed by reloading the config while LiteFS is running.
+var reloadableConfigFields = map[string]bool{
+	"data.compress":                    true,
+	"data.retention":                   true,
+	"data.retention-monitor-interval":  true,
+	"data.min-free-space":              true,
+	"data.disk-space-monitor-interval": true,
+	"databases":                        true,
+	"backup.interval":                  true,
+	"backup.retain":                    true,
+	"checkpoint":                       true,
+	"hooks":                            true,
+	"lease.handoff-timeout":            true,
+	"tracing":                          true,
+}
+
+// NonReloadableConfigChanges returns the YAML paths of fields that differ
+// between a & b and that cannot be changed by reloading the config.
+func NonReloadableConfigChanges(a, b *Config) []string {
+	return diffConfig(reflect.ValueOf(*a), reflect.ValueOf(*b), "")
+}
+
+func diffConfig(a, b reflect.Value, prefix string) (fields []string) {
+	for i := 0; i < a.NumField(); i++ {
+		name, _, _ := strings.Cut(a.Type().Field(i).Tag.Get("yaml"), ",")
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if reloadableConfigFields[name] {
+			continue
+		}
+
+		if fa, fb := a.Field(i), b.Field(i); fa.Kind() == reflect.Struct {
+			fields = append(fields, diffConfig(fa, fb, name)...)
+		} else if !reflect.DeepEqual(fa.Interface(), fb.Interface()) {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// ExecConfigSlice represents the list of commands to execute. Commands are
+// started in order. The last command & any background commands are run as
+// supervised long-running processes. All other commands run to completion
+// before the next command is started.
+type ExecConfigSlice []*ExecConfig
+
+// UnmarshalYAML unmarshals a single command string or a list of commands.
+// An empty command string unmarshals to an empty list.
+func (a *ExecConfigSlice) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		var cmd string
+		if err := value.Decode(&cmd); err != nil {
+			return err
+		} else if cmd == "" {
+			*a = ExecConfigSlice{}
+			return nil
+		}
+		*a = ExecConfigSlice{{Cmd: cmd}}
+		return nil
+	}
+
+	var other []*ExecConfig
+	if err := value.Decode(&other); err != nil {
+		return err
+	}
+	*a = other
+	return nil
+}
+
+// ExecConfig represents a single command to execute.
+type ExecConfig struct {
+	Cmd string `yaml:"cmd"`
+
+	// Name used in logs & as the output prefix. Defaults to the command name.
+	Name string `yaml:"name"`
+
+	// If true, the command is started as a long-running process and the next
+	// command is started without waiting for it to exit.
+	Background bool `yaml:"background"`
+
+	// Restart policy for long-running processes: "no", "always" or
+	// "on-failure". LiteFS shuts down when a process exits without restarting.
+	Restart string `yaml:"restart"`
+
+	// Initial & maximum delay between restarts. The delay doubles after each
+	// consecutive restart.
+	RestartDelay    time.Duration `yaml:"restart-delay"`
+	MaxRestartDelay time.Duration `yaml:"max-restart-delay"`
+
+	// Signal sent to stop the process. Defaults to the signal received by LiteFS.
+	StopSignal string `yaml:"stop-signal"`
+
+	// Time to wait for the process to exit after the stop signal before it is killed.
+	StopTimeout time.Duration `yaml:"stop-timeout"`
+
+	// If true, only runs the command on nodes that can become primary.
+	IfCandidate bool `yaml:"if-candidate"`
+
+	// If true, only runs the command if the node is primary once it has
+	// connected to the cluster. The command is stopped & fails if the node
+	// loses its primary lease while running.
+	IfPrimary bool `yaml:"if-primary"`
+}
+
+// Validate returns an error if the command, restart policy or stop signal is invalid.
+// The isLongRunning flag specifies if the command is run as a supervised process.
+func (c *ExecConfig) Validate(isLongRunning bool) error {
+	if args, err := shellwords.Parse(c.Cmd); err != nil {
+		return fmt.Errorf("cannot parse exec command: %w", err)
+	} else if len(args) == 0 {
+		return fmt.Errorf("exec command required")
+	}
+
+	if !IsValidRestartPolicy(c.Restart) {
+		return fmt.Errorf("invalid restart policy, must be 'no', 'always' or 'on-failure', got: '%v'", c.Restart)
+	} else if c.Restart != "" && c.Restart != RestartNo && !isLongRunning {
+		return fmt.Errorf("restart policy requires a background or final exec command: %s", c.Cmd)
+	}
+
+	if c.StopSignal != "" {
+		if _, err := ParseSignal(c.StopSignal); err != nil {
+			return fmt.Errorf("invalid stop signal: %w", err)
+		}
+	}
+	return nil
+}
+
+// IsLongRunning returns true if the command at index i is run as a
+// supervised process rather than run to completion.
+func (a ExecConfigSlice) IsLongRunning(i int) bool {
+	return a[i].Background || i == len(a)-1
+}
+
+// HooksConfig represents the actions taken when the role of the node changes.
+type HooksConfig struct {
+	// Runs once the node becomes primary or connects to the primary.
+	OnReady HookConfig `yaml:"on-ready"`
+
+	// Runs when the node acquires the primary lease.
+	OnPromote HookConfig `yaml:"on-promote"`
+
+	// Runs when the node loses the primary lease.
+	OnDemote HookConfig `yaml:"on-demote"`
+
+	// Runs when a different node becomes the primary, including this node.
+	OnPrimaryChange HookConfig `yaml:"on-primary-change"`
+}
+
+// HookConfig represents a single hook. A hook can run a command, send a
+// signal to the exec subprocess, or both.
+type HookConfig struct {
+	Cmd    string `yaml:"cmd"`
+	Signal string `yaml:"signal"`
+}
+
+// Validate returns an error if the command or signal cannot be parsed.
+func (c *HookConfig) Validate() error {
+	if c.Cmd != "" {
+		if args, err := shellwords.Parse(c.Cmd); err != nil {
+			return fmt.Errorf("cannot parse cmd: %w", err)
+		} else if len(args) == 0 {
+			return fmt.Errorf("cmd required")
+		}
+	}
+	if c.Signal != "" {
+		if _, err := ParseSignal(c.Signal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseSignal returns the signal for a name such as "SIGUSR1" or "USR1".
+func ParseSignal(name string) (syscall.Signal, error) {
+	switch strings.TrimPrefix(strings.ToUpper(name), "SIG") {
+	case "HUP":
+		return syscall.SIGHUP, nil
+	case "INT":
+		return syscall.SIGINT, nil
+	case "QUIT":
+		return syscall.SIGQUIT, nil
+	case "TERM":
+		return syscall.SIGTERM, nil
+	case "USR1":
+		return syscall.SIGUSR1, nil
+	case "USR2":
+		return syscall.SIGUSR2, nil
+	case "WINCH":
+		return syscall.SIGWINCH, nil
+	default:
+		return 0, fmt.Errorf("invalid signal: %q", name)
+	}
+}
+
+// Lease configuration defaults.
+const (
+	DefaultHandoffTimeout = 10 * time.Second
+)
+
 // Tracing configuration defaults.
 const (
 	DefaultTracingMaxSize  = 64 // MB
@@ -352,8 +708,15 @@ Usage:
 
 The commands are:
 
+	export       export a SQLite database from a LiteFS cluster
+	handoff      hand off the primary lease to a replica
 	import       import a SQLite database into a LiteFS cluster
+	journal      inspect a SQLite rollback journal file
+	ltx          inspect LTX files in a data directory
 	mount        mount the LiteFS FUSE file system
+	status       print the status of a LiteFS node
+	verify       verify a data directory while LiteFS is stopped
 	version      prints the version
+	wal          inspect a SQLite WAL file
 `[1:])
 }
@@ -4,7 +4,7 @@ package main
 import (
 	"context"
 	"fmt"
-	"os/exec"
+	"os"
 )
 
 // MountCommand represents a command to mount the file system.
@@ -23,8 +23,16 @@ func (c *MountCommand) Close() error { return nil }
 // ExecCh always returns nil.
 func (c *MountCommand) ExecCh() chan error { return nil }
 
-// Cmd always returns nil.
-func (c *MountCommand) Cmd() *exec.Cmd { return nil }
+// Reload returns an error for non-Linux systems.
+func (c *MountCommand) Reload(ctx context.Context) error {
+	return fmt.Errorf("litefs-mount is not available on macOS")
+}
+
+// StopProcesses is a no-op on non-Linux systems.
+func (c *MountCommand) StopProcesses(sig os.Signal) {}
+
+// Handoff is a no-op on non-Linux systems.
+func (c *MountCommand) Handoff(ctx context.Context) {}
 
 // ParseFlags returns an error for non-Linux systems.
 func (c *MountCommand) ParseFlags(ctx context.Context, args []string) error {
@@ -12,8 +12,11 @@ import (
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/mattn/go-shellwords"
 	"github.com/superfly/litefs"
@@ -25,31 +28,59 @@ import (
 
 // MountCommand represents a command to mount the file system.
 type MountCommand struct {
-	cmd    *exec.Cmd  // subcommand
-	execCh chan error // subcommand error channel
+	processes []*Process // supervised exec processes, in start order
+	execCh    chan error // receives the first process exit that stops LiteFS
+
+	hooksCancel func()        // stops the hooks monitor
+	hooksDone   chan struct{} // closed when the hooks monitor exits
+
+	// Settings from the command line, used when reloading the config.
+	configPath  string             // path of the config file that was read
+	expandEnv   bool               // if true, expand env vars in config
+	execArgs    []string           // exec command after double dash
+	fuseDebug   bool               // FUSE debug logging flag
+	tracing     bool               // trace logging to stdout flag
+	traceLogger *lumberjack.Logger // rolling trace log, if enabled
+
+	mu sync.Mutex // protects Config after startup
 
 	Config Config
 
-	Store      *litefs.Store
-	Leaser     litefs.Leaser
-	FileSystem *fuse.FileSystem
-	HTTPServer *http.Server
+	Store       *litefs.Store
+	Leaser      litefs.Leaser
+	FileSystem  *fuse.FileSystem
+	HTTPServer  *http.Server
+	Executor    *SQLExecutor // executes forwarded writes, if enabled
+	ProxyServer *http.ProxyServer
 
 	// Used for generating the advertise URL for testing.
 	AdvertiseURLFn func() string
+
+	// Used for overriding the primary's proxy URL for testing.
+	ProxyPrimaryURLFn func(info *litefs.PrimaryInfo) string
 }
 
 // NewMountCommand returns a new instance of MountCommand.
 func NewMountCommand() *MountCommand {
 	return &MountCommand{
-		execCh: make(chan error),
+		execCh: make(chan error, 1),
 		Config: NewConfig(),
 	}
 }
 
-func (c *MountCommand) Cmd() *exec.Cmd     { return c.cmd }
 func (c *MountCommand) ExecCh() chan error { return c.execCh }
 
+// Processes returns the supervised exec processes in the order they started.
+func (c *MountCommand) Processes() []*Process { return c.processes }
+
+// StopProcesses stops the supervised exec processes in reverse start order.
+// The given signal is sent to processes without a configured stop signal.
+func (c *MountCommand) StopProcesses(sig os.Signal) {
+	for i := len(c.processes) - 1; i >= 0; i-- {
+		c.processes[i].Stop(sig)
+	}
+}
+
 // ParseFlags parses the command line flags & config file.
 func (c *MountCommand) ParseFlags(ctx context.Context, args []string) (err error) {
 	// Split the args list if there is a double dash arg included. Arguments
@@ -86,44 +117,61 @@ Arguments:
 		return fmt.Errorf("too many arguments, specify a '--' to specify an exec command")
 	}
 
-	if err := c.parseConfig(ctx, *configPath, !*noExpandEnv); err != nil {
+	c.expandEnv, c.execArgs, c.fuseDebug, c.tracing = !*noExpandEnv, args1, *fuseDebug, *tracing
+	if err := c.parseConfig(ctx, *configPath, c.expandEnv); err != nil {
 		return err
 	}
+	c.applyFlags(&c.Config)
+
+	c.initTracing()
+
+	return nil
+}
 
+// applyFlags overrides config fields that were specified on the command line.
+func (c *MountCommand) applyFlags(config *Config) {
 	// Override "exec" field if specified on the CLI.
-	if args1 != nil {
-		c.Config.Exec = strings.Join(args1, " ")
+	if c.execArgs != nil {
+		config.Exec = ExecConfigSlice{{Cmd: strings.Join(c.execArgs, " ")}}
 	}
 
 	// Override "debug" field if specified on the CLI.
-	if *fuseDebug {
-		c.Config.FUSE.Debug = true
+	if c.fuseDebug {
+		config.FUSE.Debug = true
+	}
+}
+
+// initTracing enables trace logging, if specified. The config settings specify
+// a rolling on-disk log whereas the CLI flag specifies output to STDOUT.
+func (c *MountCommand) initTracing() {
+	// Close the previous on-disk log, if any, when reloading.
+	if c.traceLogger != nil {
+		_ = c.traceLogger.Close()
+		c.traceLogger = nil
 	}
 
-	// Enable trace logging, if specified. The config settings specify a rolling
-	// on-disk log whereas the CLI flag specifies output to STDOUT.
 	var tw io.Writer
 	if c.Config.Tracing.Path != "" {
 		log.Printf("trace log enabled: %s", c.Config.Tracing.Path)
-		tw = &lumberjack.Logger{
+		c.traceLogger = &lumberjack.Logger{
 			Filename:   c.Config.Tracing.Path,
 			MaxSize:    c.Config.Tracing.MaxSize,
 			MaxBackups: c.Config.Tracing.MaxCount,
 			Compress:   c.Config.Tracing.Compress,
 		}
+		tw = c.traceLogger
 	}
-	if *tracing {
+	if c.tracing {
 		if tw == nil {
 			tw = os.Stdout
 		} else {
 			tw = io.MultiWriter(os.Stdout, tw)
 		}
 	}
-	if tw != nil {
-		litefs.TraceLog.SetOutput(tw)
+	if tw == nil {
+		tw = io.Discard
 	}
-
-	return nil
+	litefs.TraceLog.SetOutput(tw)
 }
 
 // parseConfig parses the configuration file from configPath, if specified.
@@ -137,6 +185,7 @@ func (c *MountCommand) parseConfig(ctx context.Context, configPath string, expan
 		if err != nil {
 			return err
 		}
+		c.configPath = configPath
 		return UnmarshalConfig(&c.Config, buf, expandEnv)
 	}
 
@@ -158,6 +207,7 @@ func (c *MountCommand) parseConfig(ctx context.Context, configPath string, expan
 		}
 
 		fmt.Printf("config file read from %s\n", path)
+		c.configPath = path
 		return nil
 	}
 
@@ -179,6 +229,38 @@ func (c *MountCommand) Validate(ctx context.Context) (err error) {
 		return fmt.Errorf("invalid lease type, must be either 'consul' or 'static', got: '%v'", c.Config.Lease.Type)
 	}
 
+	// Ensure the checkpoint mode is valid.
+	if mode := litefs.CheckpointMode(strings.ToUpper(c.Config.Checkpoint.Mode)); !mode.IsValid() {
+		return fmt.Errorf("invalid checkpoint mode, must be 'PASSIVE', 'FULL', or 'TRUNCATE', got: '%v'", c.Config.Checkpoint.Mode)
+	}
+
+	// Ensure exec commands can be parsed.
+	for i, ec := range c.Config.Exec {
+		if err := ec.Validate(c.Config.Exec.IsLongRunning(i)); err != nil {
+			return err
+		}
+	}
+
+	// Ensure hooks have valid commands & signals.
+	for name, hook := range c.hooks() {
+		if err := hook.Validate(); err != nil {
+			return fmt.Errorf("invalid %s hook: %w", name, err)
+		} else if hook.Signal != "" && len(c.Config.Exec) == 0 {
+			return fmt.Errorf("invalid %s hook: signal requires exec", name)
+		}
+	}
+
+	if err := c.Config.Proxy.Validate(); err != nil {
+		return err
+	}
+
+	// Ensure database override patterns are well-formed.
+	for _, o := range c.Config.dbOverrides() {
+		if err := o.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -209,13 +291,96 @@ func configSearchPaths() []string {
 	return a
 }
 
+// Reload re-reads the config file and applies the settings that can be
+// changed while running. No changes are applied if the new config is invalid
+// or if it changes a setting that requires a restart.
+func (c *MountCommand) Reload(ctx context.Context) error {
+	if c.configPath == "" {
+		return fmt.Errorf("no config file to reload")
+	}
+
+	buf, err := os.ReadFile(c.configPath)
+	if err != nil {
+		return fmt.Errorf("cannot read config file at %s: %w", c.configPath, err)
+	}
+
+	config := NewConfig()
+	if err := UnmarshalConfig(&config, buf, c.expandEnv); err != nil {
+		return fmt.Errorf("cannot unmarshal config file at %s: %w", c.configPath, err)
+	}
+	c.applyFlags(&config)
+
+	if err := (&MountCommand{Config: config}).Validate(ctx); err != nil {
+		return err
+	} else if fields := NonReloadableConfigChanges(&c.Config, &config); len(fields) > 0 {
+		return fmt.Errorf("cannot reload without a restart, changed fields: %s", strings.Join(fields, ", "))
+	}
+
+	if err := c.Store.ApplySettings(config.storeSettings()); err != nil {
+		return fmt.Errorf("cannot apply store settings: %w", err)
+	}
+
+	c.mu.Lock()
+	c.Config = config
+	c.mu.Unlock()
+
+	c.initTracing()
+
+	log.Printf("config reloaded from %s", c.configPath)
+	return nil
+}
+
+// Handoff transfers the primary lease to the most caught-up replica so the
+// cluster can continue accepting writes while this node shuts down. This is
+// a no-op if the node is not the primary or handoff is disabled.
+func (c *MountCommand) Handoff(ctx context.Context) {
+	if c.Store == nil || c.HTTPServer == nil || !c.Store.IsPrimary() || c.Config.Lease.HandoffTimeout <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.Config.Lease.HandoffTimeout)
+	defer cancel()
+
+	log.Printf("handing off primary lease before shutdown")
+	if err := c.HTTPServer.Handoff(ctx, ""); err != nil {
+		log.Printf("cannot hand off primary lease: %s", err)
+		return
+	}
+
+	// Wait for the lease to be released so replicas are notified.
+	for c.Store.IsPrimary() && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func (c *MountCommand) Close() (err error) {
+	// Stop any exec processes that are still running.
+	c.StopProcesses(syscall.SIGTERM)
+
+	if c.hooksCancel != nil {
+		c.hooksCancel()
+		<-c.hooksDone
+	}
+
+	if c.ProxyServer != nil {
+		if e := c.ProxyServer.Close(); err == nil {
+			err = e
+		}
+	}
+
 	if c.HTTPServer != nil {
 		if e := c.HTTPServer.Close(); err == nil {
 			err = e
 		}
 	}
 
+	// Close forwarded write connections so they don't hold the mount open.
+	if c.Executor != nil {
+		if e := c.Executor.Close(); err == nil {
+			err = e
+		}
+	}
+
 	if c.FileSystem != nil {
 		if e := c.FileSystem.Unmount(); err == nil {
 			err = e
@@ -268,6 +433,14 @@ func (c *MountCommand) Run(ctx context.Context) (err error) {
 	c.HTTPServer.Serve()
 	log.Printf("http server listening on: %s", c.HTTPServer.URL())
 
+	if c.Config.Proxy.Addr != "" {
+		if err := c.initProxyServer(ctx); err != nil {
+			return fmt.Errorf("cannot init proxy server: %w", err)
+		}
+		c.ProxyServer.Serve()
+		log.Printf("proxy server listening on: %s", c.ProxyServer.URL())
+	}
+
 	// Wait until the store either becomes primary or connects to the primary.
 	if c.Config.SkipSync {
 		log.Printf("skipping cluster sync, starting immediately")
@@ -281,14 +454,134 @@ func (c *MountCommand) Run(ctx context.Context) (err error) {
 		}
 	}
 
+	// Capture the role before starting the subprocess so that the hooks
+	// only fire for changes after the subprocess environment is set.
+	isPrimary, primary := c.Store.IsPrimary(), c.primaryHostname()
+
 	// Execute subcommand, if specified in config.
-	if err := c.execCmd(ctx); err != nil {
+	if err := c.execCmd(ctx, isPrimary, primary); err != nil {
 		return fmt.Errorf("cannot exec: %w", err)
 	}
 
+	c.runHook(ctx, "on-ready", c.hooksConfig().OnReady, isPrimary, primary)
+
+	hooksCtx, cancel := context.WithCancel(ctx)
+	c.hooksCancel, c.hooksDone = cancel, make(chan struct{})
+	go func() { defer close(c.hooksDone); c.monitorHooks(hooksCtx, isPrimary, primary) }()
+
 	return nil
 }
 
+// hooks returns the configured hooks by name.
+func (c *MountCommand) hooks() map[string]HookConfig {
+	return map[string]HookConfig{
+		"on-ready":          c.Config.Hooks.OnReady,
+		"on-promote":        c.Config.Hooks.OnPromote,
+		"on-demote":         c.Config.Hooks.OnDemote,
+		"on-primary-change": c.Config.Hooks.OnPrimaryChange,
+	}
+}
+
+// hooksConfig returns the current hooks config. Hooks can change on reload.
+func (c *MountCommand) hooksConfig() HooksConfig {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Config.Hooks
+}
+
+// monitorHooks runs hooks as the node gains or loses the primary lease and
+// as the cluster's primary changes. The initial state is the role that was
+// passed to the exec subprocess.
+func (c *MountCommand) monitorHooks(ctx context.Context, isPrimary bool, primary string) {
+	for {
+		// Fetch the channel before the state so no change can be missed.
+		ch := c.Store.PrimaryChangeCh()
+		newIsPrimary, newPrimary := c.Store.IsPrimary(), c.primaryHostname()
+
+		hooks := c.hooksConfig()
+		if newIsPrimary && !isPrimary {
+			c.runHook(ctx, "on-promote", hooks.OnPromote, newIsPrimary, newPrimary)
+		} else if !newIsPrimary && isPrimary {
+			c.runHook(ctx, "on-demote", hooks.OnDemote, newIsPrimary, newPrimary)
+		}
+		isPrimary = newIsPrimary
+
+		// Replicas briefly lose track of the primary when reconnecting so only
+		// fire when a new primary is known.
+		if newPrimary != "" && newPrimary != primary {
+			c.runHook(ctx, "on-primary-change", hooks.OnPrimaryChange, newIsPrimary, newPrimary)
+			primary = newPrimary
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ch:
+		}
+	}
+}
+
+// runHook sends the hook's signal to the exec subprocess and runs the hook's
+// command. Failures are logged but do not stop LiteFS.
+func (c *MountCommand) runHook(ctx context.Context, name string, hook HookConfig, isPrimary bool, primary string) {
+	if hook.Signal != "" {
+		sig, _ := ParseSignal(hook.Signal)
+		for _, p := range c.processes {
+			log.Printf("hook %s: sending %s to %s", name, sig, p.Name)
+			if err := p.Signal(sig); err != nil {
+				log.Printf("hook %s: cannot signal %s: %s", name, p.Name, err)
+			}
+		}
+	}
+
+	if hook.Cmd == "" {
+		return
+	}
+
+	args, _ := shellwords.Parse(hook.Cmd)
+	log.Printf("hook %s: running: %s %v", name, args[0], args[1:])
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), primaryEnv(isPrimary, primary)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.Printf("hook %s: command failed: %s", name, err)
+	}
+}
+
+// primaryHostname returns the hostname of the current primary. Returns a
+// blank string if the primary is unknown.
+func (c *MountCommand) primaryHostname() string {
+	if c.Store.IsPrimary() {
+		return c.hostname()
+	} else if info := c.Store.PrimaryInfo(); info != nil {
+		return info.Hostname
+	}
+	return ""
+}
+
+// hostname returns the hostname this node advertises to other nodes.
+func (c *MountCommand) hostname() string {
+	c.mu.Lock()
+	hostname := c.Config.Lease.Hostname
+	c.mu.Unlock()
+
+	if hostname != "" {
+		return hostname
+	}
+	hostname, _ = os.Hostname()
+	return hostname
+}
+
+// primaryEnv returns the environment variables describing the node's role.
+func primaryEnv(isPrimary bool, primary string) []string {
+	return []string{
+		"LITEFS_PRIMARY=" + primary,
+		"LITEFS_IS_PRIMARY=" + strconv.FormatBool(isPrimary),
+	}
+}
+
 func (c *MountCommand) initConsul(ctx context.Context) (err error) {
 	// TEMP: Allow non-localhost addresses.
 
@@ -330,15 +623,63 @@ func (c *MountCommand) initConsul(ctx context.Context) (err error) {
 func (c *MountCommand) initStore(ctx context.Context) error {
 	c.Store = litefs.NewStore(c.Config.Data.Dir, c.Config.Lease.Candidate)
 	c.Store.StrictVerify = c.Config.StrictVerify
-	c.Store.Compress = c.Config.Data.Compress
-	c.Store.Retention = c.Config.Data.Retention
-	c.Store.RetentionMonitorInterval = c.Config.Data.RetentionMonitorInterval
+
+	settings := c.Config.storeSettings()
+	c.Store.Compress = settings.Compress
+	c.Store.Retention = settings.Retention
+	c.Store.RetentionMonitorInterval = settings.RetentionMonitorInterval
+	c.Store.MinFreeSpace = settings.MinFreeSpace
+	c.Store.DiskSpaceMonitorInterval = settings.DiskSpaceMonitorInterval
+	c.Store.BackupDir = c.Config.Backup.Dir
+	c.Store.BackupInterval = settings.BackupInterval
+	c.Store.BackupRetain = settings.BackupRetain
+	c.Store.DBOverrides = settings.DBOverrides
+	c.Store.CheckpointThreshold = settings.CheckpointThreshold
+	c.Store.CheckpointMode = settings.CheckpointMode
+	c.Store.CheckpointMonitorInterval = settings.CheckpointMonitorInterval
+
 	c.Store.ReconnectDelay = c.Config.Lease.ReconnectDelay
 	c.Store.DemoteDelay = c.Config.Lease.DemoteDelay
+	c.Store.HandoffDelay = c.Config.Lease.HandoffDelay
 	c.Store.Client = http.NewClient()
 	return nil
 }
 
+// storeSettings returns the store settings that can be changed while running.
+func (c *Config) storeSettings() litefs.StoreSettings {
+	return litefs.StoreSettings{
+		Retention:                 c.Data.Retention,
+		RetentionMonitorInterval:  c.Data.RetentionMonitorInterval,
+		Compress:                  c.Data.Compress,
+		CheckpointThreshold:       c.Checkpoint.Threshold,
+		CheckpointMode:            litefs.CheckpointMode(strings.ToUpper(c.Checkpoint.Mode)),
+		CheckpointMonitorInterval: c.Checkpoint.Interval,
+		MinFreeSpace:              c.Data.MinFreeSpace,
+		DiskSpaceMonitorInterval:  c.Data.DiskSpaceMonitorInterval,
+		BackupInterval:            c.Backup.Interval,
+		BackupRetain:              c.Backup.Retain,
+		DBOverrides:               c.dbOverrides(),
+	}
+}
+
+// dbOverrides returns the per-database store overrides from the config.
+func (c *Config) dbOverrides() []*litefs.DBOverride {
+	a := make([]*litefs.DBOverride, len(c.Databases))
+	for i, dbc := range c.Databases {
+		a[i] = &litefs.DBOverride{
+			Pattern:   dbc.Name,
+			Retention: dbc.Retention,
+			Compress:  dbc.Compress,
+			Replicate: dbc.Replicate,
+			MaxSize:   dbc.MaxSize,
+
+			BackupInterval: dbc.BackupInterval,
+			BackupRetain:   dbc.BackupRetain,
+		}
+	}
+	return a
+}
+
 func (c *MountCommand) openStore(ctx context.Context) error {
 	c.Store.Leaser = c.Leaser
 	if err := c.Store.Open(); err != nil {
@@ -356,6 +697,10 @@ func (c *MountCommand) initFileSystem(ctx context.Context) error {
 	fsys := fuse.NewFileSystem(c.Config.FUSE.Dir, c.Store)
 	fsys.AllowOther = c.Config.FUSE.AllowOther
 	fsys.Debug = c.Config.FUSE.Debug
+	fsys.Hostname = c.hostname()
+	if v := c.Config.FUSE.StaleLockInterval; v != 0 {
+		fsys.StaleLockInterval = v
+	}
 	if err := fsys.Mount(); err != nil {
 		return fmt.Errorf("cannot open file system: %s", err)
 	}
@@ -369,6 +714,10 @@ func (c *MountCommand) initFileSystem(ctx context.Context) error {
 
 func (c *MountCommand) initHTTPServer(ctx context.Context) error {
 	server := http.NewServer(c.Store, c.Config.HTTP.Addr)
+	if c.Config.HTTP.WriteForwarding {
+		c.Executor = NewSQLExecutor(c.Config.FUSE.Dir)
+		server.Executor = c.Executor
+	}
 	if err := server.Listen(); err != nil {
 		return fmt.Errorf("cannot open http server: %w", err)
 	}
@@ -376,30 +725,114 @@ func (c *MountCommand) initHTTPServer(ctx context.Context) error {
 	return nil
 }
 
-func (c *MountCommand) execCmd(ctx context.Context) error {
-	// Exit if no subcommand specified.
-	if c.Config.Exec == "" {
-		return nil
+func (c *MountCommand) initProxyServer(ctx context.Context) error {
+	server := http.NewProxyServer(c.Store)
+	server.Addr = c.Config.Proxy.Addr
+	server.Target = c.Config.Proxy.Target
+	server.DBName = c.Config.Proxy.DB
+	server.ReadOnlyPaths = c.Config.Proxy.ReadOnlyPaths
+	server.ReadTimeout = c.Config.Proxy.ReadTimeout
+	server.CookieExpiry = c.Config.Proxy.CookieExpiry
+	if len(c.Config.Proxy.ReadOnlyMethods) > 0 {
+		server.ReadOnlyMethods = c.Config.Proxy.ReadOnlyMethods
 	}
+	server.PrimaryURLFn = c.ProxyPrimaryURLFn
 
-	// Execute subcommand process.
-	args, err := shellwords.Parse(c.Config.Exec)
-	if err != nil {
-		return fmt.Errorf("cannot parse exec command: %w", err)
+	if err := server.Listen(); err != nil {
+		return err
 	}
+	c.ProxyServer = server
+	return nil
+}
+
+func (c *MountCommand) execCmd(ctx context.Context, isPrimary bool, primary string) error {
+	for i, ec := range c.Config.Exec {
+		// Skip commands whose qualifiers do not match this node.
+		cmdCtx := ctx
+		if ec.IfCandidate && !c.Store.Candidate() {
+			log.Printf("skipping exec command on non-candidate node: %s", ec.Cmd)
+			continue
+		} else if ec.IfPrimary {
+			if cmdCtx = c.primaryCtx(ctx); cmdCtx == nil {
+				log.Printf("skipping exec command on replica node: %s", ec.Cmd)
+				continue
+			}
+		}
+
+		args, err := shellwords.Parse(ec.Cmd)
+		if err != nil {
+			return fmt.Errorf("cannot parse exec command: %w", err)
+		}
 
-	log.Printf("starting subprocess: %s %v", args[0], args[1:])
+		name := ec.Name
+		if name == "" {
+			name = filepath.Base(args[0])
+		}
+
+		// Only prefix output if it needs to be distinguished from other processes.
+		var prefix string
+		if ec.Name != "" || len(c.Config.Exec) > 1 {
+			prefix = "[" + name + "] "
+		}
+
+		env := append(os.Environ(), primaryEnv(isPrimary, primary)...)
+
+		// Run commands to completion unless they are long-running.
+		if !c.Config.Exec.IsLongRunning(i) {
+			cmd := exec.CommandContext(cmdCtx, args[0], args[1:]...)
+			cmd.Env = env
+			cmd.Stdout = newPrefixWriter(os.Stdout, prefix)
+			cmd.Stderr = newPrefixWriter(os.Stderr, prefix)
+
+			log.Printf("running %s: %s %v", name, args[0], args[1:])
+			err := cmd.Run()
+			flushPrefixWriters(cmd.Stdout, cmd.Stderr)
+			if cmdCtx.Err() == litefs.ErrLeaseExpired {
+				return fmt.Errorf("primary lease lost while running exec command: %s", ec.Cmd)
+			} else if err != nil {
+				return fmt.Errorf("exec command failed: %s: %w", ec.Cmd, err)
+			}
+			continue
+		}
+
+		log.Printf("starting %s: %s %v", name, args[0], args[1:])
 
-	c.cmd = exec.CommandContext(ctx, args[0], args[1:]...)
-	c.cmd.Env = os.Environ()
-	c.cmd.Stdout = os.Stdout
-	c.cmd.Stderr = os.Stderr
-	if err := c.cmd.Start(); err != nil {
-		return fmt.Errorf("cannot start exec command: %w", err)
+		p := NewProcess(name, args, ec)
+		p.Env, p.Prefix = env, prefix
+		p.OnExit = c.onProcessExit
+		if err := p.Start(cmdCtx); err != nil {
+			return fmt.Errorf("cannot start exec command: %w", err)
+		}
+		c.processes = append(c.processes, p)
 	}
-	go func() { c.execCh <- c.cmd.Wait() }()
 
 	return nil
 }
 
+// onProcessExit reports the exit of a process that will not be restarted.
+// Only the first exit is reported as it triggers a shutdown.
+func (c *MountCommand) onProcessExit(err error) {
+	select {
+	case c.execCh <- err:
+	default:
+	}
+}
+
+// primaryCtx waits for the node to connect to the cluster and returns a
+// context that is canceled when the primary lease is lost. Returns nil if
+// the node is not the primary.
+func (c *MountCommand) primaryCtx(ctx context.Context) context.Context {
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-c.Store.ReadyCh():
+	}
+
+	primaryCtx := c.Store.PrimaryCtx(ctx)
+	if primaryCtx.Err() != nil {
+		return nil
+	}
+	return primaryCtx
+}
+
 var expvarOnce sync.Once
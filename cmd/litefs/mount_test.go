@@ -11,12 +11,16 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
 	main "github.com/superfly/litefs/cmd/litefs"
+	"github.com/superfly/litefs/http"
 	"github.com/superfly/litefs/internal/testingutil"
+	"github.com/superfly/ltx"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -786,6 +790,250 @@ func TestMultiNode_EnsureReadOnlyReplica(t *testing.T) {
 
 }
 
+// Ensure writes sent to a replica are forwarded to & executed on the primary.
+func TestMultiNode_WriteForwarding(t *testing.T) {
+	cmd0 := newMountCommand(t, t.TempDir(), nil)
+	cmd0.Config.HTTP.WriteForwarding = true
+	m0 := runMountCommand(t, cmd0)
+	waitForPrimary(t, m0)
+
+	cmd1 := newMountCommand(t, t.TempDir(), m0)
+	cmd1.Config.HTTP.WriteForwarding = true
+	m1 := runMountCommand(t, cmd1)
+
+	resp, err := http.NewClient().Exec(context.Background(), m1.HTTPServer.URL(), "db", []http.Statement{
+		{SQL: `CREATE TABLE t (x)`},
+		{SQL: `INSERT INTO t VALUES (?)`, Args: []interface{}{100}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if got, want := len(resp.Results), 2; got != want {
+		t.Fatalf("len(Results)=%d, want %d", got, want)
+	} else if got, want := resp.Results[1].RowsAffected, int64(1); got != want {
+		t.Fatalf("RowsAffected=%d, want %d", got, want)
+	}
+
+	txID, err := ltx.ParseTXID(resp.TXID)
+	if err != nil {
+		t.Fatal(err)
+	} else if got, want := m0.Store.DB("db").Pos().TXID, txID; got != want {
+		t.Fatalf("TXID=%s, want %s", ltx.FormatTXID(got), ltx.FormatTXID(want))
+	}
+
+	// Ensure the write replicates back to the replica.
+	waitForSync(t, "db", m0, m1)
+	var x int
+	db1 := testingutil.OpenSQLDB(t, filepath.Join(cmd1.Config.FUSE.Dir, "db"))
+	if err := db1.QueryRow(`SELECT x FROM t`).Scan(&x); err != nil {
+		t.Fatal(err)
+	} else if got, want := x, 100; got != want {
+		t.Fatalf("x=%d, want %d", got, want)
+	}
+
+	// Ensure a failed statement rolls back the entire transaction.
+	if _, err := http.NewClient().Exec(context.Background(), m1.HTTPServer.URL(), "db", []http.Statement{
+		{SQL: `INSERT INTO t VALUES (200)`},
+		{SQL: `INSERT INTO no_such_table VALUES (1)`},
+	}); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := db1.QueryRow(`SELECT COUNT(*) FROM t`).Scan(&x); err != nil {
+		t.Fatal(err)
+	} else if got, want := x, 1; got != want {
+		t.Fatalf("count=%d, want %d", got, want)
+	}
+}
+
+// Ensure a replica can wait for a write on the primary to replicate.
+func TestMultiNode_Wait(t *testing.T) {
+	m0 := runMountCommand(t, newMountCommand(t, t.TempDir(), nil))
+	waitForPrimary(t, m0)
+	m1 := runMountCommand(t, newMountCommand(t, t.TempDir(), m0))
+
+	db0 := testingutil.OpenSQLDB(t, filepath.Join(m0.Config.FUSE.Dir, "db"))
+	if _, err := db0.Exec(`CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	} else if _, err := db0.Exec(`INSERT INTO t VALUES (100)`); err != nil {
+		t.Fatal(err)
+	}
+	txID := m0.Store.DB("db").Pos().TXID
+
+	status, err := http.NewClient().Wait(context.Background(), m1.HTTPServer.URL(), "db", txID, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	} else if got, want := status.TXID, ltx.FormatTXID(txID); got != want {
+		t.Fatalf("TXID=%s, want %s", got, want)
+	}
+
+	// Waiting for a future transaction should time out.
+	if _, err := http.NewClient().Wait(context.Background(), m1.HTTPServer.URL(), "db", txID+1, 10*time.Millisecond); err == nil || !strings.Contains(err.Error(), "code=408") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure a database can be cloned by the primary at its current position or
+// at a retained TXID.
+func TestSingleNode_Clone(t *testing.T) {
+	m0 := runMountCommand(t, newMountCommand(t, t.TempDir(), nil))
+	waitForPrimary(t, m0)
+
+	db := testingutil.OpenSQLDB(t, filepath.Join(m0.Config.FUSE.Dir, "db"))
+	if _, err := db.Exec(`CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.Exec(`INSERT INTO t VALUES (100)`); err != nil {
+		t.Fatal(err)
+	}
+	txID := m0.Store.DB("db").TXID()
+
+	if _, err := db.Exec(`UPDATE t SET x = 200`); err != nil {
+		t.Fatal(err)
+	}
+
+	client := http.NewClient()
+	if status, err := client.Clone(context.Background(), m0.HTTPServer.URL(), "db", "current", 0); err != nil {
+		t.Fatal(err)
+	} else if got, want := status.TXID, ltx.FormatTXID(1); got != want {
+		t.Fatalf("TXID=%s, want %s", got, want)
+	}
+	if _, err := client.Clone(context.Background(), m0.HTTPServer.URL(), "db", "previous", txID); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]int{"current": 200, "previous": 100} {
+		var x int
+		clone := testingutil.OpenSQLDB(t, filepath.Join(m0.Config.FUSE.Dir, name))
+		if err := clone.QueryRow(`SELECT x FROM t`).Scan(&x); err != nil {
+			t.Fatal(err)
+		} else if x != want {
+			t.Fatalf("%s: x=%d, want %d", name, x, want)
+		}
+	}
+
+	// Existing targets should not be overwritten.
+	if _, err := client.Clone(context.Background(), m0.HTTPServer.URL(), "db", "current", 0); err == nil || !strings.Contains(err.Error(), "code=409") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure held locks are reported with the process that holds them.
+func TestSingleNode_Locks(t *testing.T) {
+	m0 := runMountCommand(t, newMountCommand(t, t.TempDir(), nil))
+	waitForPrimary(t, m0)
+
+	db := testingutil.OpenSQLDB(t, filepath.Join(m0.Config.FUSE.Dir, "db"))
+	if _, err := db.Exec(`CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold the write lock by leaving a write transaction open.
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.Exec(`INSERT INTO t VALUES (100)`); err != nil {
+		t.Fatal(err)
+	}
+
+	lockType := "RESERVED"
+	if testingutil.IsWALMode() {
+		lockType = "WRITE"
+	}
+
+	locks, err := http.NewClient().Locks(context.Background(), m0.HTTPServer.URL(), "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+	for _, lock := range locks {
+		if lock.Type != lockType {
+			continue
+		}
+		found = true
+
+		if got, want := lock.State, "exclusive"; got != want {
+			t.Fatalf("State=%s, want %s", got, want)
+		} else if got, want := lock.PID, os.Getpid(); got != want {
+			t.Fatalf("PID=%d, want %d", got, want)
+		} else if lock.AcquiredAt.IsZero() {
+			t.Fatal("expected acquisition time")
+		}
+	}
+	if !found {
+		t.Fatalf("expected %s lock: %#v", lockType, locks)
+	}
+
+	// Locks should also be included in the node status.
+	status, err := http.NewClient().Status(context.Background(), m0.HTTPServer.URL())
+	if err != nil {
+		t.Fatal(err)
+	} else if len(status.DBs) != 1 || len(status.DBs[0].Locks) == 0 {
+		t.Fatalf("expected locks in status: %#v", status.DBs)
+	}
+}
+
+// Ensure promote & demote hooks run with the node's role in their environment.
+func TestMultiNode_Hooks(t *testing.T) {
+	dir0, dir1 := t.TempDir(), t.TempDir()
+	hookDir := t.TempDir()
+
+	cmd0 := newMountCommand(t, dir0, nil)
+	cmd0.Config.Hooks.OnDemote.Cmd = fmt.Sprintf(`sh -c 'echo "$LITEFS_IS_PRIMARY" > %s'`, filepath.Join(hookDir, "demote"))
+	m0 := runMountCommand(t, cmd0)
+	waitForPrimary(t, m0)
+
+	cmd1 := newMountCommand(t, dir1, m0)
+	cmd1.Config.Hooks.OnPromote.Cmd = fmt.Sprintf(`sh -c 'echo "$LITEFS_IS_PRIMARY" > %s'`, filepath.Join(hookDir, "promote"))
+	m1 := runMountCommand(t, cmd1)
+
+	// Demote primary & wait for replica promotion.
+	m0.Store.Demote()
+	waitForPrimary(t, m1)
+
+	for name, want := range map[string]string{"demote": "false\n", "promote": "true\n"} {
+		testingutil.RetryUntil(t, 1*time.Millisecond, 5*time.Second, func() error {
+			if buf, err := os.ReadFile(filepath.Join(hookDir, name)); err != nil {
+				return err
+			} else if got := string(buf); got != want {
+				return fmt.Errorf("%s hook output=%q, want %q", name, got, want)
+			}
+			return nil
+		})
+	}
+}
+
+// Ensure "if-primary" exec commands only run on the primary.
+func TestMultiNode_ExecIfPrimary(t *testing.T) {
+	dir0, dir1 := t.TempDir(), t.TempDir()
+	outDir := t.TempDir()
+
+	newExec := func(name string) main.ExecConfigSlice {
+		return main.ExecConfigSlice{
+			{Cmd: fmt.Sprintf(`touch %s`, filepath.Join(outDir, name)), IfPrimary: true},
+			{Cmd: "sleep 60"},
+		}
+	}
+
+	cmd0 := newMountCommand(t, dir0, nil)
+	cmd0.Config.Exec = newExec("node0")
+	m0 := runMountCommand(t, cmd0)
+	waitForPrimary(t, m0)
+
+	cmd1 := newMountCommand(t, dir1, m0)
+	cmd1.Config.Exec = newExec("node1")
+	m1 := runMountCommand(t, cmd1)
+
+	if _, err := os.Stat(filepath.Join(outDir, "node0")); err != nil {
+		t.Fatalf("expected command to run on primary: %s", err)
+	} else if _, err := os.Stat(filepath.Join(outDir, "node1")); !os.IsNotExist(err) {
+		t.Fatalf("expected command to be skipped on replica: %v", err)
+	}
+
+	m0.StopProcesses(syscall.SIGTERM)
+	m1.StopProcesses(syscall.SIGTERM)
+}
+
 func TestMultiNode_Candidate(t *testing.T) {
 	dir0, dir1 := t.TempDir(), t.TempDir()
 	cmd0 := runMountCommand(t, newMountCommand(t, dir0, nil))
@@ -919,6 +1167,43 @@ func TestMultiNode_EnforceRetention(t *testing.T) {
 	}
 }
 
+// Ensure the primary checkpoints the WAL once it grows past the threshold.
+func TestSingleNode_Checkpoint(t *testing.T) {
+	cmd := newMountCommand(t, t.TempDir(), nil)
+	cmd.Config.Checkpoint.Threshold = 1
+	cmd.Config.Checkpoint.Interval = 100 * time.Millisecond
+	waitForPrimary(t, runMountCommand(t, cmd))
+	db := testingutil.OpenSQLDB(t, filepath.Join(cmd.Config.FUSE.Dir, "db"))
+
+	if _, err := db.Exec(`PRAGMA journal_mode = wal`); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.Exec(`CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.Exec(`INSERT INTO t VALUES (100)`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the WAL to be checkpointed & truncated.
+	testingutil.RetryUntil(t, 10*time.Millisecond, 5*time.Second, func() error {
+		if sz, err := cmd.Store.DB("db").WALSize(); err != nil {
+			return err
+		} else if sz != 0 {
+			return fmt.Errorf("wal size: %d", sz)
+		}
+		return nil
+	})
+
+	// Ensure data is still available & writable after the checkpoint.
+	var x int
+	if _, err := db.Exec(`INSERT INTO t VALUES (200)`); err != nil {
+		t.Fatal(err)
+	} else if err := db.QueryRow(`SELECT SUM(x) FROM t`).Scan(&x); err != nil {
+		t.Fatal(err)
+	} else if got, want := x, 300; got != want {
+		t.Fatalf("x=%d, want %d", got, want)
+	}
+}
+
 // Ensure multiple nodes can run in a cluster for an extended period of time.
 func TestFunctional_OK(t *testing.T) {
 	if *funTime <= 0 {
@@ -1023,6 +1308,15 @@ func TestMountCommand_Validate(t *testing.T) {
 			t.Fatalf("unexpected error: %s", err)
 		}
 	})
+	t.Run("ErrInvalidCheckpointMode", func(t *testing.T) {
+		cmd := main.NewMountCommand()
+		cmd.Config.FUSE.Dir, cmd.Config.Data.Dir = t.TempDir(), t.TempDir()
+		cmd.Config.Lease.Type = "static"
+		cmd.Config.Checkpoint.Mode = "RESTART"
+		if err := cmd.Validate(context.Background()); err == nil || err.Error() != `invalid checkpoint mode, must be 'PASSIVE', 'FULL', or 'TRUNCATE', got: 'RESTART'` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
 }
 
 //go:embed etc/litefs.yml
@@ -1037,15 +1331,35 @@ func TestUnmarshalConfig(t *testing.T) {
 		if got, want := config.Data.Dir, "/var/lib/litefs"; got != want {
 			t.Fatalf("FUSE.Dir=%s, want %s", got, want)
 		}
+		if got, want := config.Data.MinFreeSpace, int64(104857600); got != want {
+			t.Fatalf("Data.MinFreeSpace=%d, want %d", got, want)
+		}
 		if got, want := config.FUSE.Dir, "/litefs"; got != want {
 			t.Fatalf("FUSE.Dir=%s, want %s", got, want)
 		}
 		if got, want := config.FUSE.Debug, false; got != want {
 			t.Fatalf("Debug=%v, want %v", got, want)
 		}
+		if got, want := config.FUSE.StaleLockInterval, 10*time.Second; got != want {
+			t.Fatalf("FUSE.StaleLockInterval=%s, want %s", got, want)
+		}
 		if got, want := config.HTTP.Addr, ":20202"; got != want {
 			t.Fatalf("HTTP.Addr=%s, want %s", got, want)
 		}
+		if got, want := config.HTTP.WriteForwarding, false; got != want {
+			t.Fatalf("HTTP.WriteForwarding=%v, want %v", got, want)
+		}
+		if got, want := config.Proxy, (main.ProxyConfig{
+			Addr:            ":8080",
+			Target:          "localhost:8081",
+			DB:              "my.db",
+			ReadOnlyMethods: []string{"GET", "HEAD", "OPTIONS"},
+			ReadOnlyPaths:   []string{"/search"},
+			ReadTimeout:     5 * time.Second,
+			CookieExpiry:    5 * time.Minute,
+		}); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Proxy=%#v, want %#v", got, want)
+		}
 		if got, want := config.Lease.Type, "consul"; got != want {
 			t.Fatalf("Lease.Type=%s, want %s", got, want)
 		}
@@ -1070,6 +1384,95 @@ func TestUnmarshalConfig(t *testing.T) {
 		if got, want := config.Lease.Candidate, true; got != want {
 			t.Fatalf("Lease.Candidate=%v, want %v", got, want)
 		}
+		if got, want := len(config.Exec), 3; got != want {
+			t.Fatalf("len(Exec)=%d, want %d", got, want)
+		} else if got, want := *config.Exec[0], (main.ExecConfig{Cmd: "myapp-migrate", IfPrimary: true}); got != want {
+			t.Fatalf("Exec[0]=%#v, want %#v", got, want)
+		} else if got, want := *config.Exec[1], (main.ExecConfig{
+			Cmd:             "myapp-worker",
+			Name:            "worker",
+			Background:      true,
+			Restart:         "on-failure",
+			RestartDelay:    1 * time.Second,
+			MaxRestartDelay: 30 * time.Second,
+		}); got != want {
+			t.Fatalf("Exec[1]=%#v, want %#v", got, want)
+		} else if got, want := *config.Exec[2], (main.ExecConfig{
+			Cmd:         "myapp -addr :8080",
+			Name:        "app",
+			StopSignal:  "SIGINT",
+			StopTimeout: 10 * time.Second,
+		}); got != want {
+			t.Fatalf("Exec[2]=%#v, want %#v", got, want)
+		}
+		if got, want := config.Hooks.OnPromote.Cmd, "systemctl start myapp-worker"; got != want {
+			t.Fatalf("Hooks.OnPromote.Cmd=%s, want %s", got, want)
+		}
+		if got, want := config.Hooks.OnDemote.Signal, "SIGUSR2"; got != want {
+			t.Fatalf("Hooks.OnDemote.Signal=%s, want %s", got, want)
+		}
+		if got, want := config.Lease.HandoffTimeout, 10*time.Second; got != want {
+			t.Fatalf("Lease.HandoffTimeout=%s, want %s", got, want)
+		}
+		if got, want := config.Lease.HandoffDelay, 5*time.Second; got != want {
+			t.Fatalf("Lease.HandoffDelay=%s, want %s", got, want)
+		}
+
+		if got, want := len(config.Databases), 1; got != want {
+			t.Fatalf("len(Databases)=%d, want %d", got, want)
+		}
+		if got, want := config.Databases[0].Name, "events.db"; got != want {
+			t.Fatalf("Databases[0].Name=%s, want %s", got, want)
+		}
+		if got, want := *config.Databases[0].Retention, 1*time.Minute; got != want {
+			t.Fatalf("Databases[0].Retention=%s, want %s", got, want)
+		}
+		if got, want := *config.Databases[0].MaxSize, int64(214748364800); got != want {
+			t.Fatalf("Databases[0].MaxSize=%d, want %d", got, want)
+		}
+		if got, want := *config.Databases[0].BackupInterval, 5*time.Minute; got != want {
+			t.Fatalf("Databases[0].BackupInterval=%s, want %s", got, want)
+		}
+		if got, want := *config.Databases[0].BackupRetain, 288; got != want {
+			t.Fatalf("Databases[0].BackupRetain=%d, want %d", got, want)
+		}
+
+		if got, want := config.Backup.Dir, "/var/lib/litefs-backup"; got != want {
+			t.Fatalf("Backup.Dir=%s, want %s", got, want)
+		}
+		if got, want := config.Backup.Interval, 1*time.Hour; got != want {
+			t.Fatalf("Backup.Interval=%s, want %s", got, want)
+		}
+		if got, want := config.Backup.Retain, 24; got != want {
+			t.Fatalf("Backup.Retain=%d, want %d", got, want)
+		}
+
+		if got, want := config.Checkpoint.Threshold, int64(4194304); got != want {
+			t.Fatalf("Checkpoint.Threshold=%d, want %d", got, want)
+		}
+		if got, want := config.Checkpoint.Mode, "PASSIVE"; got != want {
+			t.Fatalf("Checkpoint.Mode=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("ExecString", func(t *testing.T) {
+		config := main.NewConfig()
+		if err := main.UnmarshalConfig(&config, []byte(`exec: "myapp -addr :8080"`), false); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(config.Exec), 1; got != want {
+			t.Fatalf("len(Exec)=%d, want %d", got, want)
+		} else if got, want := config.Exec[0].Cmd, "myapp -addr :8080"; got != want {
+			t.Fatalf("Exec[0].Cmd=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("ExecEmptyString", func(t *testing.T) {
+		config := main.NewConfig()
+		if err := main.UnmarshalConfig(&config, []byte(`exec: ""`), false); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(config.Exec), 0; got != want {
+			t.Fatalf("len(Exec)=%d, want %d", got, want)
+		}
 	})
 
 	t.Run("ErrUnknownField", func(t *testing.T) {
@@ -1124,6 +1527,46 @@ func TestExpandEnv(t *testing.T) {
 	})
 }
 
+func TestParseSignal(t *testing.T) {
+	if sig, err := main.ParseSignal("SIGUSR1"); err != nil {
+		t.Fatal(err)
+	} else if got, want := sig, syscall.SIGUSR1; got != want {
+		t.Fatalf("sig=%s, want %s", got, want)
+	}
+	if sig, err := main.ParseSignal("hup"); err != nil {
+		t.Fatal(err)
+	} else if got, want := sig, syscall.SIGHUP; got != want {
+		t.Fatalf("sig=%s, want %s", got, want)
+	}
+	if _, err := main.ParseSignal("SIGFOO"); err == nil || err.Error() != `invalid signal: "SIGFOO"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestNonReloadableConfigChanges(t *testing.T) {
+	t.Run("Reloadable", func(t *testing.T) {
+		a, b := main.NewConfig(), main.NewConfig()
+		b.Data.Retention = 1 * time.Hour
+		b.Backup.Interval = 5 * time.Minute
+		b.Checkpoint.Mode = "TRUNCATE"
+		b.Tracing.Path = "/var/log/litefs.log"
+		b.Hooks.OnPromote = main.HookConfig{Cmd: "echo"}
+		if fields := main.NonReloadableConfigChanges(&a, &b); len(fields) != 0 {
+			t.Fatalf("unexpected fields: %v", fields)
+		}
+	})
+	t.Run("NonReloadable", func(t *testing.T) {
+		a, b := main.NewConfig(), main.NewConfig()
+		b.Data.Dir = "/data"
+		b.Backup.Dir = "/backup"
+		b.HTTP.Addr = ":30000"
+		b.Lease.Consul.TTL = 1 * time.Minute
+		if got, want := main.NonReloadableConfigChanges(&a, &b), []string{"data.dir", "backup.dir", "http.addr", "lease.consul.ttl"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("fields=%v, want %v", got, want)
+		}
+	})
+}
+
 func newMountCommand(tb testing.TB, dir string, peer *main.MountCommand) *main.MountCommand {
 	tb.Helper()
 
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Restart policies for supervised exec processes.
+const (
+	RestartNo        = "no"
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+)
+
+// Process supervision defaults.
+const (
+	DefaultRestartDelay    = 1 * time.Second
+	DefaultMaxRestartDelay = 30 * time.Second
+	DefaultStopTimeout     = 10 * time.Second
+)
+
+// IsValidRestartPolicy returns true if s is a valid restart policy.
+func IsValidRestartPolicy(s string) bool {
+	switch s {
+	case "", RestartNo, RestartAlways, RestartOnFailure:
+		return true
+	default:
+		return false
+	}
+}
+
+// Process represents a supervised, long-running exec subprocess. The process
+// is restarted according to its restart policy until it is stopped.
+type Process struct {
+	mu        sync.Mutex
+	cmd       *exec.Cmd
+	startedAt time.Time
+	stopping  bool
+	stopCh    chan struct{} // closed when Stop() is called
+	done      chan struct{} // closed when the supervisor loop exits
+	err       error         // exit error of the final run
+
+	Name   string
+	Args   []string
+	Env    []string
+	Config *ExecConfig
+
+	// Output streams. Each line is prefixed with Prefix, if set.
+	Stdout io.Writer
+	Stderr io.Writer
+	Prefix string
+
+	// Called once when the process exits and will not be restarted.
+	// Not called if the process exits because Stop() was called.
+	OnExit func(err error)
+}
+
+// NewProcess returns a new instance of Process.
+func NewProcess(name string, args []string, config *ExecConfig) *Process {
+	return &Process{
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+
+		Name:   name,
+		Args:   args,
+		Config: config,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+}
+
+// Cmd returns the currently running command. May be nil between restarts.
+func (p *Process) Cmd() *exec.Cmd {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cmd
+}
+
+// Done returns a channel that is closed once the process has exited and
+// will not be restarted.
+func (p *Process) Done() <-chan struct{} { return p.done }
+
+// Err returns the exit error of the final run. Only valid after Done() is closed.
+func (p *Process) Err() error { return p.err }
+
+// Start starts the process & its supervisor. Returns an error if the initial
+// start fails. Later failures to start are handled by the restart policy.
+func (p *Process) Start(ctx context.Context) error {
+	if err := p.startCmd(ctx); err != nil {
+		return err
+	}
+	go p.supervise(ctx)
+	return nil
+}
+
+func (p *Process) startCmd(ctx context.Context) error {
+	stdout := newPrefixWriter(p.Stdout, p.Prefix)
+	stderr := newPrefixWriter(p.Stderr, p.Prefix)
+
+	cmd := exec.CommandContext(ctx, p.Args[0], p.Args[1:]...)
+	cmd.Env = p.Env
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("cannot start %s: %w", p.Name, err)
+	}
+
+	p.mu.Lock()
+	p.cmd, p.startedAt = cmd, time.Now()
+	stopping := p.stopping
+	p.mu.Unlock()
+
+	// Stop() may have missed the new process if it was called while starting.
+	if stopping {
+		_ = cmd.Process.Kill()
+	}
+	return nil
+}
+
+// supervise waits for the process to exit and restarts it with an
+// exponential backoff until the restart policy says otherwise.
+func (p *Process) supervise(ctx context.Context) {
+	defer close(p.done)
+
+	delay := p.restartDelay()
+	for {
+		p.mu.Lock()
+		cmd, startedAt := p.cmd, p.startedAt
+		p.mu.Unlock()
+
+		err := cmd.Wait()
+		flushPrefixWriters(cmd.Stdout, cmd.Stderr)
+
+		// Exit without notification if this was a requested stop.
+		if p.isStopping() {
+			p.err = err
+			return
+		}
+
+		// Never restart if the parent context is canceled, such as when a
+		// primary-only process loses its lease.
+		if ctx.Err() != nil || !p.shouldRestart(err) {
+			p.exit(err)
+			return
+		}
+
+		// Reset backoff if the process ran for a while before exiting.
+		if time.Since(startedAt) > p.maxRestartDelay() {
+			delay = p.restartDelay()
+		}
+
+		log.Printf("%s exited (%v), restarting in %s", p.Name, exitString(err), delay)
+		select {
+		case <-ctx.Done():
+			p.exit(err)
+			return
+		case <-p.stopCh:
+			p.err = err
+			return
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > p.maxRestartDelay() {
+			delay = p.maxRestartDelay()
+		}
+
+		// A restart failure is treated like an immediate exit. The start
+		// error replaces the exit error so it is reported if we stop here.
+		for {
+			if err = p.startCmd(ctx); err == nil {
+				break
+			} else if !p.shouldRestart(err) {
+				p.exit(err)
+				return
+			}
+			log.Printf("%s, retrying in %s", err, delay)
+
+			select {
+			case <-ctx.Done():
+				p.exit(err)
+				return
+			case <-p.stopCh:
+				p.err = err
+				return
+			case <-time.After(delay):
+			}
+
+			if delay *= 2; delay > p.maxRestartDelay() {
+				delay = p.maxRestartDelay()
+			}
+		}
+	}
+}
+
+func (p *Process) exit(err error) {
+	p.err = err
+	if p.OnExit != nil {
+		p.OnExit(err)
+	}
+}
+
+func (p *Process) shouldRestart(err error) bool {
+	switch p.Config.Restart {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
+
+func (p *Process) isStopping() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stopping
+}
+
+// Signal sends sig to the running process, if any.
+func (p *Process) Signal(sig os.Signal) error {
+	cmd := p.Cmd()
+	if cmd == nil || cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Signal(sig)
+}
+
+// Stop sends the process its stop signal and waits for it to exit. If the
+// process is still running after its stop timeout, it is killed. The
+// fallback signal is used if the process has no stop signal configured.
+func (p *Process) Stop(fallback os.Signal) {
+	p.mu.Lock()
+	if p.stopping {
+		p.mu.Unlock()
+		<-p.done
+		return
+	}
+	p.stopping = true
+	close(p.stopCh)
+	p.mu.Unlock()
+
+	sig := fallback
+	if p.Config.StopSignal != "" {
+		sig, _ = ParseSignal(p.Config.StopSignal)
+	}
+
+	log.Printf("stopping %s with %s", p.Name, sig)
+	if err := p.Signal(sig); err != nil {
+		log.Printf("cannot signal %s: %s", p.Name, err)
+	}
+
+	timeout := p.Config.StopTimeout
+	if timeout <= 0 {
+		timeout = DefaultStopTimeout
+	}
+
+	select {
+	case <-p.done:
+	case <-time.After(timeout):
+		log.Printf("%s did not stop within %s, killing", p.Name, timeout)
+		if cmd := p.Cmd(); cmd != nil && cmd.Process != nil {
+			_ = cmd.Process.Kill()
+		}
+		<-p.done
+	}
+}
+
+func (p *Process) restartDelay() time.Duration {
+	if p.Config.RestartDelay > 0 {
+		return p.Config.RestartDelay
+	}
+	return DefaultRestartDelay
+}
+
+func (p *Process) maxRestartDelay() time.Duration {
+	if p.Config.MaxRestartDelay > 0 {
+		return p.Config.MaxRestartDelay
+	}
+	return DefaultMaxRestartDelay
+}
+
+// exitString returns a short description of a process exit.
+func exitString(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	return err.Error()
+}
+
+// prefixWriter writes each line to an underlying writer with a prefix.
+// Partial lines are buffered until a newline is written or Flush() is called.
+type prefixWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+// newPrefixWriter returns w if prefix is blank. Otherwise wraps w.
+func newPrefixWriter(w io.Writer, prefix string) io.Writer {
+	if prefix == "" {
+		return w
+	}
+	return &prefixWriter{w: w, prefix: []byte(prefix)}
+}
+
+func (w *prefixWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i == -1 {
+			break
+		}
+		if err := w.writeLine(w.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes any buffered partial line followed by a newline.
+func (w *prefixWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		_ = w.writeLine(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+// flushPrefixWriters flushes any of the writers that are prefix writers.
+func flushPrefixWriters(writers ...io.Writer) {
+	for _, w := range writers {
+		if w, ok := w.(*prefixWriter); ok {
+			w.Flush()
+		}
+	}
+}
+
+func (w *prefixWriter) writeLine(line []byte) error {
+	_, err := w.w.Write(append(append([]byte(nil), w.prefix...), line...))
+	return err
+}
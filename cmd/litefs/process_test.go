@@ -0,0 +1,213 @@
+package main_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	main "github.com/superfly/litefs/cmd/litefs"
+)
+
+func TestProcess_Restart(t *testing.T) {
+	t.Run("No", func(t *testing.T) {
+		exitCh := make(chan error, 1)
+		p := main.NewProcess("test", []string{"sh", "-c", "exit 3"}, &main.ExecConfig{})
+		p.OnExit = func(err error) { exitCh <- err }
+		if err := p.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		var exitErr *exec.ExitError
+		if err := <-exitCh; !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("OnFailure", func(t *testing.T) {
+		// Fails on the first two runs & succeeds on the third.
+		counter := t.TempDir() + "/counter"
+		script := `echo x >> ` + counter + `; [ "$(wc -l < ` + counter + `)" -ge 3 ]`
+
+		exitCh := make(chan error, 1)
+		p := main.NewProcess("test", []string{"sh", "-c", script}, &main.ExecConfig{
+			Restart:      main.RestartOnFailure,
+			RestartDelay: 1 * time.Millisecond,
+		})
+		p.OnExit = func(err error) { exitCh <- err }
+		if err := p.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case err := <-exitCh:
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for process exit")
+		}
+	})
+
+	t.Run("Always", func(t *testing.T) {
+		var buf lockedBuffer
+		p := main.NewProcess("test", []string{"sh", "-c", "echo run"}, &main.ExecConfig{
+			Restart:      main.RestartAlways,
+			RestartDelay: 1 * time.Millisecond,
+		})
+		p.Stdout = &buf
+		p.OnExit = func(err error) { t.Errorf("unexpected exit: %v", err) }
+		if err := p.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; strings.Count(buf.String(), "run\n") < 3; i++ {
+			if i > 500 {
+				t.Fatal("timeout waiting for restarts")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		p.Stop(syscall.SIGTERM)
+	})
+
+	t.Run("StartError", func(t *testing.T) {
+		// Script removes itself so every restart fails to start.
+		path := filepath.Join(t.TempDir(), "run.sh")
+		if err := os.WriteFile(path, []byte("#!/bin/sh\nrm \"$0\"\nexit 1\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		exitCh := make(chan error, 1)
+		p := main.NewProcess("test", []string{path}, &main.ExecConfig{
+			Restart:         main.RestartAlways,
+			RestartDelay:    1 * time.Millisecond,
+			MaxRestartDelay: 10 * time.Millisecond,
+		})
+		p.OnExit = func(err error) { exitCh <- err }
+		if err := p.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		// Canceling while retrying should report the start error.
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+
+		select {
+		case err := <-exitCh:
+			if err == nil || !strings.HasPrefix(err.Error(), "cannot start test: ") {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for process exit")
+		}
+	})
+}
+
+func TestProcess_Stop(t *testing.T) {
+	t.Run("StopSignal", func(t *testing.T) {
+		var buf lockedBuffer
+		p := main.NewProcess("test", []string{"sh", "-c", `trap 'echo usr1; exit 0' USR1; while true; do sleep 0.01; done`}, &main.ExecConfig{
+			StopSignal: "SIGUSR1",
+		})
+		p.Stdout = &buf
+		if err := p.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond) // wait for trap to be installed
+
+		p.Stop(syscall.SIGTERM)
+		if got, want := buf.String(), "usr1\n"; got != want {
+			t.Fatalf("output=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		p := main.NewProcess("test", []string{"sh", "-c", `trap '' TERM; while true; do sleep 0.01; done`}, &main.ExecConfig{
+			StopTimeout: 100 * time.Millisecond,
+		})
+		if err := p.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond) // wait for trap to be installed
+
+		p.Stop(syscall.SIGTERM)
+		if err := p.Err(); err == nil || err.Error() != "signal: killed" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestProcess_Prefix(t *testing.T) {
+	var buf lockedBuffer
+	exitCh := make(chan error, 1)
+	p := main.NewProcess("test", []string{"sh", "-c", `printf 'foo\nbar\nbaz'`}, &main.ExecConfig{})
+	p.Stdout, p.Prefix = &buf, "[test] "
+	p.OnExit = func(err error) { exitCh <- err }
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if err := <-exitCh; err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := buf.String(), "[test] foo\n[test] bar\n[test] baz\n"; got != want {
+		t.Fatalf("output=%q, want %q", got, want)
+	}
+}
+
+// lockedBuffer is a bytes.Buffer that is safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestExecConfig_Validate(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c := &main.ExecConfig{Cmd: "myapp", Restart: main.RestartAlways, StopSignal: "SIGINT"}
+		if err := c.Validate(true); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("ErrInvalidRestartPolicy", func(t *testing.T) {
+		c := &main.ExecConfig{Cmd: "myapp", Restart: "sometimes"}
+		if err := c.Validate(true); err == nil || err.Error() != `invalid restart policy, must be 'no', 'always' or 'on-failure', got: 'sometimes'` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrRestartNotLongRunning", func(t *testing.T) {
+		c := &main.ExecConfig{Cmd: "myapp", Restart: main.RestartOnFailure}
+		if err := c.Validate(false); err == nil || err.Error() != `restart policy requires a background or final exec command: myapp` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrInvalidStopSignal", func(t *testing.T) {
+		c := &main.ExecConfig{Cmd: "myapp", StopSignal: "SIGFOO"}
+		if err := c.Validate(true); err == nil || err.Error() != `invalid stop signal: invalid signal: "SIGFOO"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
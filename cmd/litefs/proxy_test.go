@@ -0,0 +1,106 @@
+package main_test
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/superfly/litefs"
+	lfshttp "github.com/superfly/litefs/http"
+	"github.com/superfly/litefs/internal/testingutil"
+)
+
+// Ensure the proxy forwards writes to the primary & holds replica reads until
+// they catch up to the write.
+func TestMultiNode_Proxy(t *testing.T) {
+	// Applications are started once their databases are open.
+	var db0, db1 *sql.DB
+	app0 := httptest.NewUnstartedServer(newProxyTestHandler(&db0))
+	defer app0.Close()
+	app1 := httptest.NewUnstartedServer(newProxyTestHandler(&db1))
+	defer app1.Close()
+
+	cmd0 := newMountCommand(t, t.TempDir(), nil)
+	cmd0.Config.Proxy.Addr = ":0"
+	cmd0.Config.Proxy.Target = app0.Listener.Addr().String()
+	cmd0.Config.Proxy.DB = "db"
+	m0 := runMountCommand(t, cmd0)
+	waitForPrimary(t, m0)
+
+	cmd1 := newMountCommand(t, t.TempDir(), m0)
+	cmd1.Config.Proxy.Addr = ":0"
+	cmd1.Config.Proxy.Target = app1.Listener.Addr().String()
+	cmd1.Config.Proxy.DB = "db"
+	cmd1.ProxyPrimaryURLFn = func(info *litefs.PrimaryInfo) string { return m0.ProxyServer.URL() }
+	m1 := runMountCommand(t, cmd1)
+
+	db0 = testingutil.OpenSQLDB(t, filepath.Join(m0.Config.FUSE.Dir, "db"))
+	if _, err := db0.Exec(`CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	}
+	waitForSync(t, "db", m0, m1)
+	db1 = testingutil.OpenSQLDB(t, filepath.Join(m1.Config.FUSE.Dir, "db"))
+	app0.Start()
+	app1.Start()
+
+	// Write through the replica's proxy. It should execute on the primary.
+	resp, err := http.Post(m1.ProxyServer.URL()+"/items", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("StatusCode=%d, want %d", got, want)
+	}
+
+	var cookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == lfshttp.ProxyTXIDCookieName {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("expected txid cookie")
+	}
+
+	// Read from the replica with the cookie. It should see the write.
+	req, err := http.NewRequest("GET", m1.ProxyServer.URL()+"/items", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(cookie)
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if buf, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	} else if got, want := string(buf), "1"; got != want {
+		t.Fatalf("count=%s, want %s", got, want)
+	}
+}
+
+// newProxyTestHandler returns an application handler that inserts a row on
+// POST & returns the row count on GET.
+func newProxyTestHandler(db **sql.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			if _, err := (*db).Exec(`INSERT INTO t VALUES (1)`); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		default:
+			var n int
+			if err := (*db).QueryRow(`SELECT COUNT(*) FROM t`).Scan(&n); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(w, n)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/superfly/litefs/http"
+)
+
+// StatusCommand represents a command to display the state of a LiteFS node.
+type StatusCommand struct {
+	// Target LiteFS URL
+	URL string
+
+	// If true, prints the status as JSON.
+	JSON bool
+
+	// Output stream. Defaults to STDOUT.
+	Stdout io.Writer
+}
+
+// NewStatusCommand returns a new instance of StatusCommand.
+func NewStatusCommand() *StatusCommand {
+	return &StatusCommand{
+		URL:    DefaultURL,
+		Stdout: os.Stdout,
+	}
+}
+
+// ParseFlags parses the command line flags.
+func (c *StatusCommand) ParseFlags(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litefs-status", flag.ContinueOnError)
+	fs.StringVar(&c.URL, "url", "http://localhost:20202", "LiteFS API URL")
+	fs.BoolVar(&c.JSON, "json", false, "output as JSON")
+	fs.Usage = func() {
+		fmt.Println(`
+The status command prints the role of a LiteFS node, the current primary, and
+the position of each database. When run against the primary, it also lists
+the connected replicas with the last transaction sent to each and how many
+transactions have not been sent yet. Replicas may not have applied every
+transaction they have been sent.
+
+Usage:
+
+	litefs status [arguments]
+
+Arguments:
+`[1:])
+		fs.PrintDefaults()
+		fmt.Println("")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() > 0 {
+		return fmt.Errorf("too many arguments")
+	}
+	return nil
+}
+
+// Run executes the command.
+func (c *StatusCommand) Run(ctx context.Context) (err error) {
+	status, err := http.NewClient().Status(ctx, c.URL)
+	if err != nil {
+		return err
+	}
+
+	if c.JSON {
+		enc := json.NewEncoder(c.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(status)
+	}
+
+	role := "replica"
+	if status.IsPrimary {
+		role = "primary"
+	}
+
+	fmt.Fprintf(c.Stdout, "ID:        %s\n", status.ID)
+	fmt.Fprintf(c.Stdout, "Role:      %s\n", role)
+	fmt.Fprintf(c.Stdout, "Candidate: %v\n", status.Candidate)
+	if status.Primary != nil {
+		fmt.Fprintf(c.Stdout, "Primary:   %s\n", status.Primary.AdvertiseURL)
+	} else {
+		fmt.Fprintf(c.Stdout, "Primary:   none\n")
+	}
+	if lease := status.Lease; lease != nil && !lease.RenewedAt.IsZero() {
+		fmt.Fprintf(c.Stdout, "Lease:     ttl=%s renewed=%s ago\n", lease.TTL, time.Since(lease.RenewedAt).Truncate(time.Millisecond))
+	} else if lease != nil {
+		fmt.Fprintf(c.Stdout, "Lease:     static\n")
+	}
+	if status.LowDiskSpace {
+		fmt.Fprintf(c.Stdout, "Disk:      low disk space, writes rejected\n")
+	}
+
+	fmt.Fprintln(c.Stdout, "")
+	w := tabwriter.NewWriter(c.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tTXID\tCHECKSUM")
+	for _, db := range status.DBs {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", db.Name, db.TXID, db.Checksum)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if err := c.printLocks(status.DBs); err != nil {
+		return err
+	}
+
+	if len(status.Replicas) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(c.Stdout, "")
+	w = tabwriter.NewWriter(c.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "REPLICA\tADDR\tCONNECTED\tDATABASE\tSENT TXID\tSENT LAG")
+	for _, replica := range status.Replicas {
+		connected := time.Since(replica.ConnectedAt).Truncate(time.Second)
+		for _, db := range replica.DBs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", replica.ID, replica.Addr, connected, db.Name, db.SentTXID, db.SentLag)
+		}
+	}
+	return w.Flush()
+}
+
+// printLocks prints the locks held on each database, if any.
+func (c *StatusCommand) printLocks(dbs []*http.DBStatus) error {
+	var n int
+	for _, db := range dbs {
+		n += len(db.Locks)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(c.Stdout, "")
+	w := tabwriter.NewWriter(c.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tLOCK\tSTATE\tOWNER\tPID\tHELD")
+	for _, db := range dbs {
+		for _, lock := range db.Locks {
+			pid := "-"
+			if lock.PID != 0 {
+				pid = fmt.Sprint(lock.PID)
+			}
+			held := time.Since(lock.AcquiredAt).Truncate(time.Millisecond)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", db.Name, lock.Type, lock.State, lock.Owner, pid, held)
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,49 @@
+package main_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	main "github.com/superfly/litefs/cmd/litefs"
+	"github.com/superfly/litefs/http"
+	"github.com/superfly/litefs/internal/testingutil"
+)
+
+// Ensure the primary reports its connected replicas.
+func TestStatusCommand(t *testing.T) {
+	dir0, dir1 := t.TempDir(), t.TempDir()
+	m0 := runMountCommand(t, newMountCommand(t, dir0, nil))
+	waitForPrimary(t, m0)
+	m1 := runMountCommand(t, newMountCommand(t, dir1, m0))
+
+	db := testingutil.OpenSQLDB(t, filepath.Join(m0.Config.FUSE.Dir, "db"))
+	if _, err := db.Exec(`CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	}
+	waitForSync(t, "db", m0, m1)
+
+	var buf bytes.Buffer
+	cmd := main.NewStatusCommand()
+	cmd.URL = m0.HTTPServer.URL()
+	cmd.JSON = true
+	cmd.Stdout = &buf
+	if err := cmd.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var status http.Status
+	if err := json.Unmarshal(buf.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	} else if !status.IsPrimary {
+		t.Fatal("expected primary")
+	} else if got, want := len(status.DBs), 1; got != want {
+		t.Fatalf("len(DBs)=%d, want %d", got, want)
+	} else if got, want := len(status.Replicas), 1; got != want {
+		t.Fatalf("len(Replicas)=%d, want %d", got, want)
+	} else if got, want := status.Replicas[0].ID, m1.Store.ID(); got != want {
+		t.Fatalf("Replicas[0].ID=%s, want %s", got, want)
+	}
+}
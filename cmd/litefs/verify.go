@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/superfly/litefs"
+	"github.com/superfly/ltx"
+)
+
+// VerifyCommand represents a command to verify a data directory while the
+// node is stopped.
+type VerifyCommand struct {
+	// Path to the LiteFS data directory.
+	DataDir string
+
+	// Database names to verify. Verifies all databases if empty.
+	Names []string
+
+	// If true, runs "PRAGMA integrity_check" against each database.
+	IntegrityCheck bool
+
+	// Output stream. Defaults to STDOUT.
+	Stdout io.Writer
+}
+
+// NewVerifyCommand returns a new instance of VerifyCommand.
+func NewVerifyCommand() *VerifyCommand {
+	return &VerifyCommand{Stdout: os.Stdout}
+}
+
+// ParseFlags parses the command line flags.
+func (c *VerifyCommand) ParseFlags(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litefs-verify", flag.ContinueOnError)
+	fs.StringVar(&c.DataDir, "data-dir", "", "LiteFS data directory")
+	fs.BoolVar(&c.IntegrityCheck, "integrity-check", false, "run PRAGMA integrity_check on each database")
+	fs.Usage = func() {
+		fmt.Println(`
+The verify command checks the databases in a LiteFS data directory. It must
+only be run while LiteFS is stopped.
+
+For each database, the checksum of the database is recomputed as LiteFS would
+recover it on startup: a hot journal is rolled back, committed WAL frames up
+to the last LTX file are overlaid and the pages of the last LTX file are
+applied. The checksum is compared against the post-apply checksum of the last
+LTX file. Files are only read and nothing is written to the data directory.
+LTX files are checked for valid file checksums, contiguous transaction IDs and
+matching pre-apply & post-apply checksums.
+
+Exits with an error if any problems are found.
+
+Usage:
+
+	litefs verify [arguments] [NAME...]
+
+Arguments:
+`[1:])
+		fs.PrintDefaults()
+		fmt.Println("")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if c.DataDir == "" {
+		return fmt.Errorf("data directory required")
+	}
+	c.Names = fs.Args()
+	return nil
+}
+
+// Run executes the command.
+func (c *VerifyCommand) Run(ctx context.Context) (err error) {
+	names, err := listDataDirDBs(c.DataDir, c.Names)
+	if err != nil {
+		return err
+	}
+
+	var problemN int
+	for _, name := range names {
+		problems, err := c.verifyDB(ctx, name)
+		if err != nil {
+			return fmt.Errorf("verify %q: %w", name, err)
+		}
+
+		if len(problems) == 0 {
+			fmt.Fprintf(c.Stdout, "%s: ok\n", name)
+			continue
+		}
+		for _, problem := range problems {
+			fmt.Fprintf(c.Stdout, "%s: %s\n", name, problem)
+		}
+		problemN += len(problems)
+	}
+
+	if problemN > 0 {
+		return fmt.Errorf("%d problem(s) found", problemN)
+	}
+	return nil
+}
+
+// verifyDB verifies a single database and returns a description of each problem found.
+func (c *VerifyCommand) verifyDB(ctx context.Context, name string) ([]string, error) {
+	problems, err := verifyLTXFiles(c.DataDir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The last LTX file determines the expected database state.
+	filenames, err := listLTXFiles(c.DataDir, name)
+	if err != nil {
+		return nil, err
+	} else if len(filenames) == 0 {
+		return append(problems, "no ltx files"), nil
+	}
+
+	// Read the database as LiteFS would recover it on startup. Files are only
+	// read so the data directory is never changed.
+	dbDir := filepath.Join(c.DataDir, "dbs", name)
+	r, err := litefs.OpenRecoveryReader(dbDir, filenames[len(filenames)-1])
+	if err != nil {
+		return append(problems, fmt.Sprintf("recovery failed: %s", err)), nil
+	}
+	defer func() { _ = r.Close() }()
+
+	chksum, changed, err := r.ReadPages(ctx, nil)
+	if err != nil {
+		return append(problems, fmt.Sprintf("recovery failed: %s", err)), nil
+	} else if chksum != r.Trailer().PostApplyChecksum {
+		return append(problems, fmt.Sprintf("database checksum %016x does not match LTX post-apply checksum %016x at %s",
+			chksum, r.Trailer().PostApplyChecksum, ltx.FormatTXID(r.Header().MaxTXID))), nil
+	}
+
+	if !c.IntegrityCheck {
+		return problems, nil
+	}
+
+	// The database file is checked as-is unless recovery would change it. In
+	// that case the recovered database is written to a temporary file outside
+	// of the data directory.
+	path := filepath.Join(dbDir, "database")
+	if changed {
+		f, err := os.CreateTemp("", "litefs-verify-*")
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}()
+
+		if err := writeRecoveredDatabase(ctx, r, f); err != nil {
+			return nil, fmt.Errorf("write recovered database: %w", err)
+		}
+		path = f.Name()
+	}
+
+	results, err := integrityCheck(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("integrity check: %w", err)
+	}
+	for _, result := range results {
+		problems = append(problems, fmt.Sprintf("integrity check: %s", result))
+	}
+
+	return problems, nil
+}
+
+// writeRecoveredDatabase writes each recovered page read by r to f. The header
+// is switched to rollback journal mode so that SQLite does not look for a WAL.
+func writeRecoveredDatabase(ctx context.Context, r *litefs.RecoveryReader, f *os.File) error {
+	pageSize := int64(r.Header().PageSize)
+	if _, _, err := r.ReadPages(ctx, func(pgno uint32, data []byte) error {
+		_, err := f.WriteAt(data, int64(pgno-1)*pageSize)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if _, err := f.WriteAt([]byte{1, 1}, 18); err != nil {
+		return err
+	} else if err := f.Truncate(int64(r.Header().Commit) * pageSize); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// integrityCheck runs "PRAGMA integrity_check" against the database at path
+// without modifying it. Returns the reported errors, if any.
+func integrityCheck(ctx context.Context, path string) ([]string, error) {
+	dsn := (&url.URL{
+		Scheme:   "file",
+		Opaque:   path,
+		RawQuery: "mode=ro&immutable=1",
+	}).String()
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+
+	rows, err := db.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var results []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return nil, err
+		} else if result != "ok" {
+			results = append(results, result)
+		}
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,113 @@
+package main_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	main "github.com/superfly/litefs/cmd/litefs"
+	"github.com/superfly/litefs/internal/testingutil"
+)
+
+func TestVerifyCommand(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		dataDir := t.TempDir()
+		testingutil.MustCopyDir(t, "../../testdata/store/open-and-write-snapshot", dataDir)
+
+		var buf bytes.Buffer
+		cmd := main.NewVerifyCommand()
+		cmd.DataDir, cmd.IntegrityCheck, cmd.Stdout = dataDir, true, &buf
+		if err := cmd.Run(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %s: %s", err, buf.String())
+		} else if got, want := buf.String(), "sqlite.db: ok\n"; got != want {
+			t.Fatalf("output=%q, want %q", got, want)
+		}
+	})
+
+	// Pages in the last LTX file are reapplied on startup so damage to them is
+	// repaired, such as a database left at the LTX pre-apply checksum.
+	t.Run("RepairedByLastLTX", func(t *testing.T) {
+		dataDir := t.TempDir()
+		testingutil.MustCopyDir(t, "../../testdata/store/open-and-write-snapshot", dataDir)
+
+		// Page 8 is contained in the last LTX file.
+		path := filepath.Join(dataDir, "dbs", "sqlite.db", "database")
+		f, err := os.OpenFile(path, os.O_RDWR, 0666)
+		if err != nil {
+			t.Fatal(err)
+		} else if _, err := f.WriteAt(bytes.Repeat([]byte{0xFF}, 4096), 7*4096); err != nil {
+			t.Fatal(err)
+		} else if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		cmd := main.NewVerifyCommand()
+		cmd.DataDir, cmd.IntegrityCheck, cmd.Stdout = dataDir, true, &buf
+		if err := cmd.Run(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %s: %s", err, buf.String())
+		} else if got, want := buf.String(), "sqlite.db: ok\n"; got != want {
+			t.Fatalf("output=%q, want %q", got, want)
+		}
+
+		// The database file is only read, never repaired.
+		if data, err := os.ReadFile(path); err != nil {
+			t.Fatal(err)
+		} else if got, want := data[7*4096], byte(0xFF); got != want {
+			t.Fatalf("page 8 byte=%x, want %x", got, want)
+		}
+	})
+
+	// A WAL with a different salt than the last LTX file is removed on startup.
+	// The verify command must ignore it without removing it.
+	t.Run("WALSaltMismatch", func(t *testing.T) {
+		dataDir := t.TempDir()
+		testingutil.MustCopyDir(t, "../../testdata/store/open-and-write-snapshot", dataDir)
+
+		walPath := filepath.Join(dataDir, "dbs", "sqlite.db", "wal")
+		if err := os.WriteFile(walPath, bytes.Repeat([]byte{0x01}, 4096+32+24), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		cmd := main.NewVerifyCommand()
+		cmd.DataDir, cmd.Stdout = dataDir, &buf
+		if err := cmd.Run(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %s: %s", err, buf.String())
+		} else if _, err := os.Stat(walPath); err != nil {
+			t.Fatalf("expected wal to be left in place: %s", err)
+		}
+	})
+
+	t.Run("ErrChecksumMismatch", func(t *testing.T) {
+		dataDir := t.TempDir()
+		testingutil.MustCopyDir(t, "../../testdata/store/open-and-write-snapshot", dataDir)
+
+		// Corrupt a byte in the last page of the database.
+		path := filepath.Join(dataDir, "dbs", "sqlite.db", "database")
+		f, err := os.OpenFile(path, os.O_RDWR, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		} else if _, err := f.WriteAt([]byte{0xFF}, fi.Size()-1); err != nil {
+			t.Fatal(err)
+		} else if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		cmd := main.NewVerifyCommand()
+		cmd.DataDir, cmd.Stdout = dataDir, &buf
+		if err := cmd.Run(context.Background()); err == nil || err.Error() != `1 problem(s) found` {
+			t.Fatalf("unexpected error: %v", err)
+		} else if !strings.Contains(buf.String(), "does not match LTX post-apply checksum") {
+			t.Fatalf("unexpected output: %s", buf.String())
+		}
+	})
+}
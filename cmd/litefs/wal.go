@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/superfly/litefs"
+	"github.com/superfly/ltx"
+)
+
+// runWAL executes a "wal" subcommand.
+func runWAL(ctx context.Context, args []string) error {
+	var cmd string
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "dump":
+		c := NewWALDumpCommand()
+		if err := c.ParseFlags(ctx, args); err != nil {
+			return err
+		}
+		return c.Run(ctx)
+
+	default:
+		if cmd == "" || cmd == "help" || strings.HasPrefix(cmd, "-") {
+			fmt.Println(`
+The wal commands inspect SQLite WAL files.
+
+Usage:
+
+	litefs wal <command> [arguments]
+
+The commands are:
+
+	dump         print the frames of a WAL file
+`[1:])
+			return flag.ErrHelp
+		}
+		return fmt.Errorf("litefs wal %s: unknown command", cmd)
+	}
+}
+
+// WALDumpCommand represents a command to print the contents of a WAL file.
+type WALDumpCommand struct {
+	// Path to the WAL file.
+	Path string
+
+	// Output stream. Defaults to STDOUT.
+	Stdout io.Writer
+}
+
+// NewWALDumpCommand returns a new instance of WALDumpCommand.
+func NewWALDumpCommand() *WALDumpCommand {
+	return &WALDumpCommand{Stdout: os.Stdout}
+}
+
+// ParseFlags parses the command line flags.
+func (c *WALDumpCommand) ParseFlags(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litefs-wal-dump", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Println(`
+The dump command prints each valid frame of a WAL file with its offset, page
+number, commit size & page checksum. Reading stops at the first frame with an
+invalid salt or checksum. Frames after the last commit are uncommitted.
+
+Usage:
+
+	litefs wal dump PATH
+`[1:])
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	} else if fs.NArg() > 1 {
+		return fmt.Errorf("too many arguments")
+	}
+	c.Path = fs.Arg(0)
+	return nil
+}
+
+// Run executes the command.
+func (c *WALDumpCommand) Run(ctx context.Context) (err error) {
+	f, err := os.Open(c.Path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	r := litefs.NewWALReader(bufio.NewReader(f))
+	if err := r.ReadHeader(); err == io.EOF {
+		fmt.Fprintln(c.Stdout, "No valid WAL header found.")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+	fmt.Fprintf(c.Stdout, "Header: page size=%d\n", r.PageSize())
+
+	var frameN, txN, uncommittedN int
+	data := make([]byte, r.PageSize())
+	for {
+		pgno, commit, err := r.ReadFrame(data)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("read frame: %w", err)
+		}
+		frameN++
+
+		fmt.Fprintf(c.Stdout, "  offset=%d pgno=%d commit=%d checksum=%016x\n", r.Offset(), pgno, commit, ltx.ChecksumPage(pgno, data))
+
+		if commit != 0 {
+			txN, uncommittedN = txN+1, 0
+		} else {
+			uncommittedN++
+		}
+	}
+
+	fmt.Fprintf(c.Stdout, "Frames: %d, transactions: %d, uncommitted frames: %d\n", frameN, txN, uncommittedN)
+	return nil
+}
@@ -1,11 +1,13 @@
 package litefs
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc64"
 	"io"
 	"io/fs"
 	"log"
@@ -15,6 +17,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 	"unsafe"
 
@@ -35,8 +38,10 @@ type DB struct {
 	mode     DBMode       // database journaling mode (rollback, wal)
 
 	chksums struct { // database page checksums
-		mu sync.Mutex
-		m  map[uint32]uint64
+		mu         sync.Mutex
+		pages      pageChecksums
+		fileID     fileIdentity // database file when pages last matched it
+		fileIDTime time.Time    // time fileID was recorded
 	}
 
 	dirtyPageSet map[uint32]struct{}
@@ -57,6 +62,26 @@ type DB struct {
 		m  map[uint64]*GuardSet
 	}
 
+	// Guard sets used by LiteFS itself for snapshots, checkpoints, etc. These
+	// use owner zero & are tracked so that HeldLocks() can report them.
+	internalGuardSets struct {
+		mu sync.Mutex
+		m  map[*GuardSet]struct{}
+	}
+
+	// Open read-only views of historical versions of the database, by TXID.
+	historicalViews struct {
+		mu sync.Mutex
+		m  map[uint64]*HistoricalView
+	}
+
+	// Owners blocked in Locks() or RLocks(), mapped to the lock & owners they
+	// are waiting on. Used for deadlock detection.
+	lockWaiters struct {
+		mu sync.Mutex
+		m  map[uint64]lockWait
+	}
+
 	// SQLite database locks
 	pendingLock  RWMutex
 	sharedLock   RWMutex
@@ -89,10 +114,21 @@ func NewDB(store *Store, name string, path string) *DB {
 		Now: time.Now,
 	}
 	db.pos.Store(Pos{})
-	db.chksums.m = make(map[uint32]uint64)
 	db.wal.frameOffsets = make(map[uint32]int64)
 	db.wal.chksums = make(map[uint32][]uint64)
 	db.guardSets.m = make(map[uint64]*GuardSet)
+	db.internalGuardSets.m = make(map[*GuardSet]struct{})
+	db.historicalViews.m = make(map[uint64]*HistoricalView)
+	db.lockWaiters.m = make(map[uint64]lockWait)
+
+	for _, lockType := range lockTypes {
+		waitMetric := dbLockWaitSecondsMetricVec.WithLabelValues(name, lockType.String())
+		holdMetric := dbLockHoldSecondsMetricVec.WithLabelValues(name, lockType.String())
+
+		mu := db.mutex(lockType)
+		mu.OnWait = func(d time.Duration) { waitMetric.Observe(d.Seconds()) }
+		mu.OnUnlock = func(d time.Duration) { holdMetric.Observe(d.Seconds()) }
+	}
 
 	return db
 }
@@ -147,6 +183,9 @@ func (db *DB) WALPath() string { return filepath.Join(db.path, "wal") }
 // SHMPath returns the path to the underlying shared memory file.
 func (db *DB) SHMPath() string { return filepath.Join(db.path, "shm") }
 
+// ChecksumPath returns the path to the persisted page checksum file.
+func (db *DB) ChecksumPath() string { return filepath.Join(db.path, "checksums") }
+
 // Pos returns the current transaction position of the database.
 func (db *DB) Pos() Pos {
 	return db.pos.Load().(Pos)
@@ -172,6 +211,12 @@ func (db *DB) setPos(pos Pos) error {
 // TXID returns the current transaction ID.
 func (db *DB) TXID() uint64 { return db.Pos().TXID }
 
+// PageSize returns the database page size. Returns zero if not yet known.
+func (db *DB) PageSize() uint32 { return db.pageSize }
+
+// Mode returns the journaling mode of the database.
+func (db *DB) Mode() DBMode { return db.mode }
+
 // Open initializes the database from files in its data directory.
 func (db *DB) Open() error {
 
@@ -196,11 +241,28 @@ func (db *DB) Open() error {
 		return fmt.Errorf("max ltx file: %w", err)
 	}
 
-	// Sync up WAL and last LTX file, if they both exist.
+	// Sync up WAL and last LTX file, if they both exist. The position after
+	// the last LTX file is used to validate the persisted checksum file.
+	var ltxPos Pos
 	if ltxFilename != "" {
 		if err := db.syncWALToLTX(context.Background(), ltxFilename); err != nil {
 			return fmt.Errorf("sync wal to ltx: %w", err)
 		}
+
+		if ltxPos, err = readLTXFilePos(ltxFilename); err != nil {
+			log.Printf("cannot read ltx position, ignoring checksum file: db=%q err=%s", db.name, err)
+		}
+	}
+
+	// The checksum file describes the database & WAL as they were on close so
+	// they must be compared before recovery modifies them.
+	dbID, err := statFileIdentity(db.DatabasePath())
+	if err != nil {
+		return fmt.Errorf("stat database: %w", err)
+	}
+	walID, err := statFileIdentity(db.WALPath())
+	if err != nil {
+		return fmt.Errorf("stat wal: %w", err)
 	}
 
 	// Reset the rollback journal and/or WAL.
@@ -209,7 +271,7 @@ func (db *DB) Open() error {
 	}
 
 	// Verify database header & initialize checksums.
-	if err := db.initDatabaseFile(); err != nil {
+	if err := db.initDatabaseFile(ltxPos, dbID, walID); err != nil {
 		return fmt.Errorf("init database file: %w", err)
 	}
 
@@ -314,15 +376,13 @@ func (db *DB) rollbackJournal(ctx context.Context) error {
 
 	// Copy every journal page back into the main database file.
 	r := NewJournalReader(journalFile, db.pageSize)
-	for i := 0; ; i++ {
-		if err := r.Next(); err == io.EOF {
-			break
-		} else if err != nil {
-			return fmt.Errorf("next segment(%d): %w", i, err)
-		}
-		if err := db.rollbackJournalSegment(ctx, r, dbFile); err != nil {
-			return fmt.Errorf("segment(%d): %w", i, err)
+	if err := readJournalFrames(r, func(pgno uint32, data []byte, offset int64) error {
+		if err := db.writeDatabasePage(dbFile, pgno, data); err != nil {
+			return fmt.Errorf("write to database (pgno=%d): %w", pgno, err)
 		}
+		return nil
+	}); err != nil {
+		return err
 	}
 
 	// Resize database to size before journal transaction, if a valid header exists.
@@ -353,20 +413,91 @@ func (db *DB) rollbackJournal(ctx context.Context) error {
 	return nil
 }
 
-func (db *DB) rollbackJournalSegment(ctx context.Context, r *JournalReader, dbFile *os.File) error {
+// readJournalFrames calls fn with each frame in every segment of the journal
+// read by r, in order. The offset is the position of the page data within the
+// journal file. Page data is only valid for the duration of the call.
+func readJournalFrames(r *JournalReader, fn func(pgno uint32, data []byte, offset int64) error) error {
 	for i := 0; ; i++ {
-		pgno, data, err := r.ReadFrame()
-		if err == io.EOF {
+		if err := r.Next(); err == io.EOF {
 			return nil
 		} else if err != nil {
-			return fmt.Errorf("read frame(%d): %w", i, err)
+			return fmt.Errorf("next segment(%d): %w", i, err)
 		}
 
-		// Write data to the database file.
-		if err := db.writeDatabasePage(dbFile, pgno, data); err != nil {
-			return fmt.Errorf("write to database (pgno=%d): %w", pgno, err)
+		for j := 0; ; j++ {
+			offset := r.offset + 4
+			pgno, data, err := r.ReadFrame()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("segment(%d): read frame(%d): %w", i, j, err)
+			}
+
+			if err := fn(pgno, data, offset); err != nil {
+				return fmt.Errorf("segment(%d): %w", i, err)
+			}
+		}
+	}
+}
+
+// Checkpoint copies all pages from the WAL into the database file and then
+// truncates the WAL. This is a no-op if the database is not in WAL mode.
+//
+// PASSIVE checkpoints return ErrCheckpointBusy if any SQLite connection holds
+// a WAL lock. Other modes wait for readers & writers until ctx is done.
+func (db *DB) Checkpoint(ctx context.Context, mode CheckpointMode) (err error) {
+	defer func() {
+		TraceLog.Printf("[Checkpoint(%s)]: mode=%s %s", db.name, mode, errorKeyValue(err))
+	}()
+
+	if !mode.IsValid() {
+		return fmt.Errorf("invalid checkpoint mode: %q", mode)
+	} else if db.mode != DBModeWAL {
+		return nil
+	}
+
+	// Passive checkpoints only make a single attempt to acquire locks.
+	lockCtx := ctx
+	if mode == CheckpointModePassive {
+		var cancel context.CancelFunc
+		lockCtx, cancel = context.WithCancel(ctx)
+		cancel()
+	}
+
+	guard, err := db.AcquireWriteLock(lockCtx)
+	if mode == CheckpointModePassive && errors.Is(err, context.Canceled) && ctx.Err() == nil {
+		return ErrCheckpointBusy
+	} else if err != nil {
+		return err
+	}
+	defer guard.Unlock()
+
+	if err := db.checkpoint(ctx); err != nil {
+		return err
+	}
+
+	// Pages were written directly to the database file so clear the page cache.
+	if invalidator := db.store.Invalidator; invalidator != nil {
+		if err := invalidator.InvalidateDB(db); err != nil {
+			return fmt.Errorf("invalidate db: %w", err)
 		}
 	}
+
+	dbCheckpointCountMetricVec.WithLabelValues(db.name, string(mode)).Inc()
+
+	return nil
+}
+
+// WALSize returns the size of the WAL file, in bytes. Returns zero if the WAL
+// file does not exist.
+func (db *DB) WALSize() (int64, error) {
+	fi, err := os.Stat(db.WALPath())
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
 }
 
 func (db *DB) checkpoint(ctx context.Context) error {
@@ -388,7 +519,7 @@ func (db *DB) checkpoint(ctx context.Context) error {
 	}
 	defer func() { _ = walFile.Close() }()
 
-	offsets, commit, err := db.readWALPageOffsets(walFile)
+	offsets, commit, err := readWALPageOffsets(walFile)
 	if err != nil {
 		return fmt.Errorf("read wal page offsets: %w", err)
 	}
@@ -434,7 +565,7 @@ func (db *DB) checkpoint(ctx context.Context) error {
 
 // readWALPageOffsets returns a map of the offsets of the last committed version
 // of each page in the WAL. Also returns the commit size of the last transaction.
-func (db *DB) readWALPageOffsets(f *os.File) (_ map[uint32]int64, lastCommit uint32, _ error) {
+func readWALPageOffsets(f io.Reader) (_ map[uint32]int64, lastCommit uint32, _ error) {
 	r := NewWALReader(f)
 	if err := r.ReadHeader(); err == io.EOF {
 		return nil, 0, nil
@@ -541,9 +672,7 @@ func (db *DB) syncWALToLTX(ctx context.Context, ltxFilename string) error {
 	// If WAL salt doesn't match the LTX WAL salt then the WAL has been
 	// restarted and we need to remove it. We are just renaming it for now so
 	// we can debug in case this happens.
-	salt1 := binary.BigEndian.Uint32(hdr[16:])
-	salt2 := binary.BigEndian.Uint32(hdr[20:])
-	if salt1 != dec.Header().WALSalt1 || salt2 != dec.Header().WALSalt2 {
+	if !walSaltMatches(dec.Header(), hdr) {
 		log.Printf("wal-sync: wal salt mismatch on %q, removing wal", db.name)
 		if err := os.Rename(db.WALPath(), db.WALPath()+".removed"); err != nil {
 			return fmt.Errorf("wal-sync: rename wal file with salt mismatch: %w", err)
@@ -570,10 +699,26 @@ func (db *DB) syncWALToLTX(ctx context.Context, ltxFilename string) error {
 	return nil
 }
 
+// walSaltMatches returns true if the salt in the WAL header, walHdr, matches
+// the WAL salt recorded in the LTX header.
+func walSaltMatches(hdr ltx.Header, walHdr []byte) bool {
+	return binary.BigEndian.Uint32(walHdr[16:]) == hdr.WALSalt1 &&
+		binary.BigEndian.Uint32(walHdr[20:]) == hdr.WALSalt2
+}
+
 // initDatabaseFile opens and validates the database file, if it exists.
 // The journal & WAL should not exist at this point. The journal should be
 // rolled back and the WAL should be checkpointed.
-func (db *DB) initDatabaseFile() error {
+//
+// Page checksums are loaded from the checksum file if it matches pos and the
+// database & WAL files, identified by dbID & walID, have not changed since it
+// was written. Otherwise they are computed by reading every page of the
+// database. The checksum file is never used if StrictVerify is enabled.
+func (db *DB) initDatabaseFile(pos Pos, dbID, walID fileIdentity) error {
+	// The checksum file is only valid for a single open. It is rewritten
+	// when the database is closed.
+	defer func() { _ = os.Remove(db.ChecksumPath()) }()
+
 	f, err := os.Open(db.DatabasePath())
 	if os.IsNotExist(err) {
 		log.Printf("database file does not exist on initialization: %s", db.DatabasePath())
@@ -595,11 +740,24 @@ func (db *DB) initDatabaseFile() error {
 
 	assert(db.pageSize > 0, "page size must be greater than zero")
 
-	// Build per-page checksum map for existing pages. The database could be
+	// Use the persisted checksums from the last shutdown, if they match.
+	if !pos.IsZero() && !db.store.StrictVerify {
+		pages, err := db.readChecksumFile(pos, dbID, walID)
+		if err == nil {
+			db.chksums.mu.Lock()
+			db.chksums.pages = pages
+			db.chksums.mu.Unlock()
+			return db.updateDatabaseFileID()
+		} else if !os.IsNotExist(err) {
+			log.Printf("cannot use checksum file, rebuilding: db=%q err=%s", db.name, err)
+		}
+	}
+
+	// Build per-page checksums for existing pages. The database could be
 	// short compared to the page count in the header so just checksum what we
 	// can. The database may recover in applyLTX() so we'll do validation then.
 	buf := make([]byte, db.pageSize)
-	m := make(map[uint32]uint64)
+	pages := make(pageChecksums, 0, db.pageN)
 	for pgno := uint32(1); pgno <= db.pageN; pgno++ {
 		offset := int64(pgno-1) * int64(db.pageSize)
 		if _, err := internal.ReadFullAt(f, buf, offset); err == io.EOF || err == io.ErrUnexpectedEOF {
@@ -609,15 +767,344 @@ func (db *DB) initDatabaseFile() error {
 			return fmt.Errorf("read database page %d: %w", pgno, err)
 		}
 
-		m[pgno] = ltx.ChecksumPage(pgno, buf)
+		pages.set(pgno, ltx.ChecksumPage(pgno, buf))
 	}
 	db.chksums.mu.Lock()
-	db.chksums.m = m
+	db.chksums.pages = pages
 	db.chksums.mu.Unlock()
 
+	return db.updateDatabaseFileID()
+}
+
+// Close persists the page checksums so that the next call to Open() can skip
+// reading the entire database file. This should only be called once there
+// are no more readers or writers on the database.
+func (db *DB) Close() error {
+	return db.writeChecksumFile()
+}
+
+// Checksum file format constants.
+const (
+	checksumFileMagic      = "LFSC"
+	checksumFileVersion    = 2
+	checksumFileHeaderSize = 80
+)
+
+// checksumFileRacyWindow is the minimum time between the last modification of
+// the database file & the time its identity is recorded for the identity to be
+// trusted. File systems with coarse timestamps may not change the modification
+// time on a write that occurs shortly after a previous one.
+const checksumFileRacyWindow = 1 * time.Second
+
+// fileIdentity identifies a specific version of a file on disk. It is used to
+// detect changes made to the database outside of LiteFS, such as while the
+// node is stopped.
+type fileIdentity struct {
+	Size    int64
+	ModTime int64 // unix nanoseconds
+	Ino     uint64
+}
+
+// statFileIdentity returns the identity of the file at path. Returns a zero
+// identity if the file does not exist.
+func statFileIdentity(path string) (fileIdentity, error) {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fileIdentity{}, nil
+	} else if err != nil {
+		return fileIdentity{}, err
+	}
+
+	id := fileIdentity{Size: fi.Size(), ModTime: fi.ModTime().UnixNano()}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		id.Ino = uint64(st.Ino)
+	}
+	return id, nil
+}
+
+// IsZero returns true if the file did not exist.
+func (id fileIdentity) IsZero() bool { return id == fileIdentity{} }
+
+// isRacy returns true if the file was modified so close to t that a later
+// write may not have changed its modification time.
+func (id fileIdentity) isRacy(t time.Time) bool {
+	return t.Sub(time.Unix(0, id.ModTime)) < checksumFileRacyWindow
+}
+
+// marshal appends the identity to b in big endian format.
+func (id fileIdentity) marshal(b []byte) {
+	binary.BigEndian.PutUint64(b[0:8], uint64(id.Size))
+	binary.BigEndian.PutUint64(b[8:16], uint64(id.ModTime))
+	binary.BigEndian.PutUint64(b[16:24], id.Ino)
+}
+
+// unmarshalFileIdentity decodes an identity written by marshal.
+func unmarshalFileIdentity(b []byte) fileIdentity {
+	return fileIdentity{
+		Size:    int64(binary.BigEndian.Uint64(b[0:8])),
+		ModTime: int64(binary.BigEndian.Uint64(b[8:16])),
+		Ino:     binary.BigEndian.Uint64(b[16:24]),
+	}
+}
+
+// updateDatabaseFileID records the identity of the database file after LiteFS
+// has synced its own writes so that the in-memory page checksums are known to
+// match the file.
+func (db *DB) updateDatabaseFileID() error {
+	id, err := statFileIdentity(db.DatabasePath())
+	if err != nil {
+		return fmt.Errorf("stat database: %w", err)
+	}
+
+	db.chksums.mu.Lock()
+	defer db.chksums.mu.Unlock()
+	db.chksums.fileID, db.chksums.fileIDTime = id, time.Now()
 	return nil
 }
 
+// verifyDatabaseChecksums reads every page of the database file & returns
+// true if they match the in-memory page checksums.
+//
+// Database checksum lock must be held when invoked.
+func (db *DB) verifyDatabaseChecksums() (bool, error) {
+	f, err := os.Open(db.DatabasePath())
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+
+	buf := make([]byte, db.pageSize)
+	lockPgno := ltx.LockPgno(db.pageSize)
+	for pgno := uint32(1); pgno <= db.chksums.pages.pageN(); pgno++ {
+		if pgno == lockPgno {
+			continue
+		}
+
+		offset := int64(pgno-1) * int64(db.pageSize)
+		if _, err := internal.ReadFullAt(f, buf, offset); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("read database page %d: %w", pgno, err)
+		}
+
+		if pageChksum, _ := db.chksums.pages.get(pgno); pageChksum != ltx.ChecksumPage(pgno, buf) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// writeChecksumFile writes the current page checksums and position to the
+// checksum file. The file is written to a temporary path and then atomically
+// renamed. The file is skipped if the checksums are inconsistent with the
+// current position, such as during an in-progress transaction.
+func (db *DB) writeChecksumFile() (err error) {
+	pos := db.Pos()
+	defer func() {
+		TraceLog.Printf("[WriteChecksumFile(%s)]: pos=%s pageN=%d %s", db.name, pos, db.pageN, errorKeyValue(err))
+	}()
+
+	if pos.IsZero() || db.pageSize == 0 || db.pageN == 0 {
+		return nil
+	}
+
+	db.chksums.mu.Lock()
+	defer db.chksums.mu.Unlock()
+
+	// The in-memory checksums only reflect writes made through LiteFS. If the
+	// database file has changed since LiteFS last synced it, or it may have
+	// changed without updating its timestamp, verify the checksums against the
+	// file before persisting them.
+	dbID, err := statFileIdentity(db.DatabasePath())
+	if err != nil {
+		return err
+	}
+	if dbID.IsZero() || dbID != db.chksums.fileID || dbID.isRacy(db.chksums.fileIDTime) {
+		if ok, err := db.verifyDatabaseChecksums(); err != nil {
+			return err
+		} else if !ok {
+			log.Printf("database file changed outside of litefs, skipping checksum file: db=%q", db.name)
+			return nil
+		}
+
+		// Ensure the file did not change while it was being verified.
+		if id, err := statFileIdentity(db.DatabasePath()); err != nil {
+			return err
+		} else if id != dbID {
+			return nil
+		}
+	}
+
+	walID, err := statFileIdentity(db.WALPath())
+	if err != nil {
+		return err
+	}
+
+	// Build the checksums for the database as it will exist after the WAL is
+	// checkpointed on the next open.
+	var chksum uint64
+	pages := make([]uint64, db.pageN)
+	for pgno := uint32(1); pgno <= db.pageN; pgno++ {
+		pageChksum, ok := db.pageChecksum(pgno, db.pageN, nil)
+		if !ok {
+			return nil // incomplete checksums, skip
+		}
+		pages[pgno-1] = pageChksum
+		chksum = ltx.ChecksumFlag | (chksum ^ pageChksum)
+	}
+	if chksum != pos.PostApplyChecksum {
+		return nil // uncommitted changes, skip
+	}
+
+	tempPath := db.ChecksumPath() + ".tmp"
+	f, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := crc64.New(crc64.MakeTable(crc64.ISO))
+	w := bufio.NewWriter(io.MultiWriter(f, h))
+
+	hdr := make([]byte, checksumFileHeaderSize)
+	copy(hdr[0:4], checksumFileMagic)
+	binary.BigEndian.PutUint32(hdr[4:8], checksumFileVersion)
+	binary.BigEndian.PutUint32(hdr[8:12], db.pageSize)
+	binary.BigEndian.PutUint32(hdr[12:16], db.pageN)
+	binary.BigEndian.PutUint64(hdr[16:24], pos.TXID)
+	binary.BigEndian.PutUint64(hdr[24:32], pos.PostApplyChecksum)
+	dbID.marshal(hdr[32:56])
+	walID.marshal(hdr[56:80])
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 8)
+	for _, pageChksum := range pages {
+		binary.BigEndian.PutUint64(buf, pageChksum)
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	// Append checksum of the file contents so we can detect partial writes.
+	binary.BigEndian.PutUint64(buf, h.Sum64())
+	if _, err := f.Write(buf); err != nil {
+		return err
+	} else if err := f.Sync(); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, db.ChecksumPath())
+}
+
+// readChecksumFile reads page checksums from the checksum file. Returns an
+// error if the file does not match pos, the current database header, or the
+// identities of the database & WAL files before recovery.
+func (db *DB) readChecksumFile(pos Pos, dbID, walID fileIdentity) (pageChecksums, error) {
+	f, err := os.Open(db.ChecksumPath())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	h := crc64.New(crc64.MakeTable(crc64.ISO))
+	r := io.TeeReader(bufio.NewReader(f), h)
+
+	hdr := make([]byte, checksumFileHeaderSize)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	} else if string(hdr[0:4]) != checksumFileMagic {
+		return nil, fmt.Errorf("invalid checksum file magic")
+	} else if v := binary.BigEndian.Uint32(hdr[4:8]); v != checksumFileVersion {
+		return nil, fmt.Errorf("unsupported checksum file version: %d", v)
+	}
+
+	pageSize := binary.BigEndian.Uint32(hdr[8:12])
+	pageN := binary.BigEndian.Uint32(hdr[12:16])
+	filePos := Pos{
+		TXID:              binary.BigEndian.Uint64(hdr[16:24]),
+		PostApplyChecksum: binary.BigEndian.Uint64(hdr[24:32]),
+	}
+	if filePos != pos {
+		return nil, fmt.Errorf("position mismatch: %s <> %s", filePos, pos)
+	} else if id := unmarshalFileIdentity(hdr[32:56]); id != dbID {
+		return nil, fmt.Errorf("database file changed since checksum file was written")
+	} else if id.isRacy(fi.ModTime()) {
+		return nil, fmt.Errorf("database file modified too close to checksum file write")
+	} else if id := unmarshalFileIdentity(hdr[56:80]); id != walID {
+		return nil, fmt.Errorf("wal file changed since checksum file was written")
+	} else if pageSize != db.pageSize || pageN != db.pageN {
+		return nil, fmt.Errorf("database size mismatch: pageSize=%d pageN=%d, expected pageSize=%d pageN=%d", pageSize, pageN, db.pageSize, db.pageN)
+	}
+
+	var chksum uint64
+	buf := make([]byte, 8)
+	pages := make(pageChecksums, pageN)
+	for i := range pages {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("read page checksum: %w", err)
+		}
+		pages[i] = binary.BigEndian.Uint64(buf)
+		chksum = ltx.ChecksumFlag | (chksum ^ pages[i])
+	}
+	sum := h.Sum64()
+
+	// Verify file integrity & ensure the checksums match the position.
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("read file checksum: %w", err)
+	} else if v := binary.BigEndian.Uint64(buf); v != sum {
+		return nil, fmt.Errorf("file checksum mismatch: %016x <> %016x", v, sum)
+	} else if chksum != pos.PostApplyChecksum {
+		return nil, fmt.Errorf("database checksum mismatch: %016x <> %016x", chksum, pos.PostApplyChecksum)
+	}
+
+	return pages, nil
+}
+
+// readLTXFilePos returns the position of the database after the LTX file at
+// path has been applied. This only reads the header & trailer of the file.
+func readLTXFilePos(path string) (Pos, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Pos{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return Pos{}, err
+	}
+
+	var hdr ltx.Header
+	buf := make([]byte, ltx.HeaderSize)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return Pos{}, fmt.Errorf("read ltx header: %w", err)
+	} else if err := hdr.UnmarshalBinary(buf); err != nil {
+		return Pos{}, fmt.Errorf("unmarshal ltx header: %w", err)
+	}
+
+	var trailer ltx.Trailer
+	buf = make([]byte, ltx.TrailerSize)
+	if _, err := internal.ReadFullAt(f, buf, fi.Size()-ltx.TrailerSize); err != nil {
+		return Pos{}, fmt.Errorf("read ltx trailer: %w", err)
+	} else if err := trailer.UnmarshalBinary(buf); err != nil {
+		return Pos{}, fmt.Errorf("unmarshal ltx trailer: %w", err)
+	}
+
+	return Pos{TXID: hdr.MaxTXID, PostApplyChecksum: trailer.PostApplyChecksum}, nil
+}
+
 // clean deletes and recreates the database data directory.
 func (db *DB) clean() error {
 	if err := os.RemoveAll(db.path); err != nil && !os.IsNotExist(err) {
@@ -693,16 +1180,16 @@ func (db *DB) truncateDatabase(f *os.File, pageN uint32) (err error) {
 		defer db.chksums.mu.Unlock()
 
 		for pgno := pageN + 1; pgno <= prevPageN; pgno++ {
-			pageChksum := db.chksums.m[pgno]
-			delete(db.chksums.m, pgno)
+			pageChksum, _ := db.chksums.pages.get(pgno)
 			TraceLog.Printf("[TruncatePage(%s)]: pgno=%d chksum=%016x", db.name, pgno, pageChksum)
 		}
+		db.chksums.pages.truncate(pageN)
 	}()
 
 	// Update page count.
 	db.pageN = pageN
 
-	return nil
+	return db.updateDatabaseFileID()
 }
 
 // SyncDatabase fsync's the database file.
@@ -717,8 +1204,10 @@ func (db *DB) SyncDatabase(ctx context.Context) (err error) {
 	} else if err := f.Sync(); err != nil {
 		_ = f.Close()
 		return err
+	} else if err := f.Close(); err != nil {
+		return err
 	}
-	return f.Close()
+	return db.updateDatabaseFileID()
 }
 
 // ReadDatabaseAt reads from the database at the specified index.
@@ -770,6 +1259,9 @@ func (db *DB) WriteDatabaseAt(ctx context.Context, f *os.File, data []byte, offs
 	// necessary with the write-ahead log (WAL) since pages are appended
 	// instead of overwritten. We can determine the dirty set at commit-time.
 	pgno := uint32(offset/int64(db.pageSize)) + 1
+	if err := db.checkMaxSize(pgno); err != nil {
+		return err
+	}
 	if db.mode == DBModeRollback {
 		db.dirtyPageSet[pgno] = struct{}{}
 	}
@@ -805,8 +1297,9 @@ func (db *DB) writeDatabasePage(f *os.File, pgno uint32, data []byte) (err error
 	newChksum = ltx.ChecksumPage(pgno, data)
 
 	db.chksums.mu.Lock()
-	prevChksum = db.chksums.m[pgno]
-	db.chksums.m[pgno] = newChksum
+	prevChksum, _ = db.chksums.pages.get(pgno)
+	db.chksums.pages.set(pgno, newChksum)
+	db.chksums.fileID = fileIdentity{}
 	db.chksums.mu.Unlock()
 
 	return nil
@@ -960,6 +1453,8 @@ func (db *DB) TruncateWAL(ctx context.Context, size int64) (err error) {
 	db.wal.frameOffsets = make(map[uint32]int64)
 	db.wal.chksums = make(map[uint32][]uint64)
 
+	dbWALBytesMetricVec.WithLabelValues(db.name).Set(0)
+
 	return nil
 }
 
@@ -975,6 +1470,8 @@ func (db *DB) RemoveWAL(ctx context.Context) (err error) {
 	db.wal.frameOffsets = make(map[uint32]int64)
 	db.wal.chksums = make(map[uint32][]uint64)
 
+	dbWALBytesMetricVec.WithLabelValues(db.name).Set(0)
+
 	return nil
 }
 
@@ -1104,6 +1601,13 @@ func (db *DB) writeWALFrameHeader(ctx context.Context, f *os.File, data []byte,
 		return fmt.Errorf("cannot write wal frame header @%d before current WAL position @%d", offset, db.wal.offset)
 	}
 
+	// Reject frames that would grow the database past its configured size.
+	if pgno != 0 {
+		if err := db.checkMaxSize(pgno); err != nil {
+			return err
+		}
+	}
+
 	// Passthrough write to underlying WAL file.
 	_, err = f.WriteAt(data, offset)
 	return err
@@ -1372,6 +1876,7 @@ func (db *DB) CommitWAL(ctx context.Context) (err error) {
 	dbLTXCountMetricVec.WithLabelValues(db.name).Inc()
 	dbLTXBytesMetricVec.WithLabelValues(db.name).Set(float64(enc.N()))
 	dbLatencySecondsMetricVec.WithLabelValues(db.name).Set(0.0)
+	dbWALBytesMetricVec.WithLabelValues(db.name).Set(float64(endOffset))
 
 	// Notify store of database change.
 	db.store.MarkDirty(db.name)
@@ -1642,20 +2147,16 @@ func (db *DB) CommitJournal(ctx context.Context, mode JournalMode) (err error) {
 		db.chksums.mu.Lock()
 		defer db.chksums.mu.Unlock()
 
-		for pgno := range db.chksums.m {
-			if pgno <= commit {
-				continue
-			}
-
+		for pgno := commit + 1; pgno <= db.chksums.pages.pageN(); pgno++ {
 			if pgno == lockPgno {
 				TraceLog.Printf("[CommitJournalRemovePage(%s)]: pgno=%d SKIP(LOCK_PAGE)\n", db.name, pgno)
 				continue
 			}
 
 			pageChksum, _ := db.pageChecksum(pgno, db.pageN, nil)
-			delete(db.chksums.m, pgno)
 			TraceLog.Printf("[CommitJournalRemovePage(%s)]: pgno=%d chksum=%016x %s", db.name, pgno, pageChksum, errorKeyValue(err))
 		}
+		db.chksums.pages.truncate(commit)
 	}()
 
 	// Compute new database checksum.
@@ -1759,17 +2260,280 @@ func (db *DB) onDiskChecksum(dbFile, walFile *os.File) (chksum uint64, err error
 	return chksum, nil
 }
 
-// isJournalHeaderValid returns true if the journal starts with the journal magic.
-func (db *DB) isJournalHeaderValid() (bool, error) {
-	f, err := os.Open(db.JournalPath())
-	if err != nil {
-		return false, err
-	}
-	defer func() { _ = f.Close() }()
+// RecoveryReader reads the pages of a database as they would exist after
+// DB.Open() recovers it, without modifying any files. This allows a data
+// directory to be verified while LiteFS is stopped.
+//
+// Recovery rolls back a hot journal, copies committed WAL frames up to the end
+// of the last LTX file into the database & then applies the last LTX file.
+type RecoveryReader struct {
+	ltxFilename string
+	header      ltx.Header
+	trailer     ltx.Trailer
+
+	dbFile      *os.File
+	journalFile *os.File
+	walFile     *os.File
+
+	pageSize  uint32
+	filePageN uint32 // size of database file, in pages
+
+	journalOffsets map[uint32]int64 // page data offsets in hot journal
+	journalCommit  uint32           // size after rollback, if journal valid
+	journalValid   bool
+
+	walOffsets map[uint32]int64 // offsets of last committed frame per page
+	walCommit  uint32           // size after checkpoint, zero if no frames
+}
 
-	buf := make([]byte, len(SQLITE_JOURNAL_HEADER_STRING))
-	if _, err := io.ReadFull(f, buf); err != nil {
-		return false, err
+// OpenRecoveryReader opens the database files in dir for reading as they would
+// be recovered to the LTX file at ltxFilename, which should be the last LTX
+// file for the database.
+func OpenRecoveryReader(dir, ltxFilename string) (_ *RecoveryReader, err error) {
+	r := &RecoveryReader{ltxFilename: ltxFilename}
+	defer func() {
+		if err != nil {
+			_ = r.Close()
+		}
+	}()
+
+	// Validate the LTX file before it is used, as syncWALToLTX() does.
+	if err := r.readLTXFile(); err != nil {
+		return nil, err
+	}
+	r.pageSize = r.header.PageSize
+
+	if r.dbFile, err = os.Open(filepath.Join(dir, "database")); err != nil {
+		return nil, err
+	}
+
+	// The database header is only read to catch a page size mismatch. An
+	// empty database file is initialized by the LTX file.
+	if hdr, _, err := readSQLiteDatabaseHeader(r.dbFile); err == io.EOF {
+		// empty database file
+	} else if err != nil {
+		return nil, fmt.Errorf("read database header: %w", err)
+	} else if hdr.PageSize != r.pageSize {
+		return nil, fmt.Errorf("database page size %d does not match ltx page size %d", hdr.PageSize, r.pageSize)
+	}
+
+	fi, err := r.dbFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	r.filePageN = uint32(fi.Size() / int64(r.pageSize))
+
+	if err := r.readJournal(filepath.Join(dir, "journal")); err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	if err := r.readWAL(filepath.Join(dir, "wal")); err != nil {
+		return nil, fmt.Errorf("read wal: %w", err)
+	}
+	return r, nil
+}
+
+// Close closes the underlying database, journal & WAL files.
+func (r *RecoveryReader) Close() (retErr error) {
+	for _, f := range []*os.File{r.dbFile, r.journalFile, r.walFile} {
+		if f == nil {
+			continue
+		} else if err := f.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}
+	return retErr
+}
+
+// Header returns the header of the LTX file the database is recovered to.
+func (r *RecoveryReader) Header() ltx.Header { return r.header }
+
+// Trailer returns the trailer of the LTX file the database is recovered to.
+func (r *RecoveryReader) Trailer() ltx.Trailer { return r.trailer }
+
+func (r *RecoveryReader) readLTXFile() error {
+	f, err := os.Open(r.ltxFilename)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	dec := ltx.NewDecoder(f)
+	if err := dec.Verify(); err != nil {
+		return fmt.Errorf("validate ltx: %w", err)
+	}
+	r.header, r.trailer = dec.Header(), dec.Trailer()
+	return nil
+}
+
+// readJournal records the pages that rollbackJournal() copies back into the
+// database file.
+func (r *RecoveryReader) readJournal(path string) (err error) {
+	if r.journalFile, err = os.Open(path); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	jr := NewJournalReader(r.journalFile, r.pageSize)
+	r.journalOffsets = make(map[uint32]int64)
+	if err := readJournalFrames(jr, func(pgno uint32, data []byte, offset int64) error {
+		r.journalOffsets[pgno] = offset
+		return nil
+	}); err != nil {
+		return err
+	}
+	r.journalCommit, r.journalValid = jr.commit, jr.IsValid()
+	return nil
+}
+
+// readWAL records the committed frames that checkpoint() copies into the
+// database file after syncWALToLTX() has removed or truncated the WAL.
+func (r *RecoveryReader) readWAL(path string) (err error) {
+	if r.walFile, err = os.Open(path); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	fi, err := r.walFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	size := fi.Size()
+	hdr := make([]byte, WALHeaderSize)
+	if _, err := internal.ReadFullAt(r.walFile, hdr, 0); err == io.EOF || err == io.ErrUnexpectedEOF {
+		// short WAL header, not synced
+	} else if err != nil {
+		return err
+	} else if !walSaltMatches(r.header, hdr) {
+		return nil // WAL is removed
+	} else if size < r.header.WALOffset {
+		return fmt.Errorf("short wal size (%d bytes), last ltx offset at %d bytes", size, r.header.WALOffset)
+	} else if ltxWALSize := r.header.WALOffset + r.header.WALSize; size > ltxWALSize {
+		size = ltxWALSize
+	}
+
+	r.walOffsets, r.walCommit, err = readWALPageOffsets(io.NewSectionReader(r.walFile, 0, size))
+	return err
+}
+
+// ReadPages calls fn with each page of the recovered database in order,
+// skipping the lock page, and returns the checksum of the recovered database.
+// Also returns true if recovery would change the database file. fn may be nil.
+func (r *RecoveryReader) ReadPages(ctx context.Context, fn func(pgno uint32, data []byte) error) (chksum uint64, changed bool, err error) {
+	f, err := os.Open(r.ltxFilename)
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() { _ = f.Close() }()
+
+	// LTX pages are stored in order so they are merged as the database is read.
+	dec := ltx.NewDecoder(f)
+	if err := dec.DecodeHeader(); err != nil {
+		return 0, false, fmt.Errorf("decode ltx header: %w", err)
+	}
+	var ltxPageHeader ltx.PageHeader
+	ltxData := make([]byte, r.pageSize)
+	decodeNext := func() error {
+		if err := dec.DecodePage(&ltxPageHeader, ltxData); err == io.EOF {
+			ltxPageHeader.Pgno = 0
+		} else if err != nil {
+			return fmt.Errorf("decode ltx page: %w", err)
+		}
+		return nil
+	}
+	if err := decodeNext(); err != nil {
+		return 0, false, err
+	}
+
+	changed = len(r.journalOffsets) > 0 || r.walCommit > 0 || r.filePageN != r.header.Commit
+
+	lockPgno := ltx.LockPgno(r.pageSize)
+	data := make([]byte, r.pageSize)
+	for pgno := uint32(1); pgno <= r.header.Commit; pgno++ {
+		if err := ctx.Err(); err != nil {
+			return 0, false, err
+		} else if pgno == lockPgno {
+			continue
+		}
+
+		if err := r.readPage(pgno, data); err != nil {
+			return 0, false, fmt.Errorf("read page %d: %w", pgno, err)
+		}
+
+		// Pages in the last LTX file overwrite the recovered page.
+		if ltxPageHeader.Pgno == pgno {
+			if !bytes.Equal(data, ltxData) {
+				copy(data, ltxData)
+				changed = true
+			}
+			if err := decodeNext(); err != nil {
+				return 0, false, err
+			}
+		}
+
+		chksum = ltx.ChecksumFlag | (chksum ^ ltx.ChecksumPage(pgno, data))
+
+		if fn != nil {
+			if err := fn(pgno, data); err != nil {
+				return 0, false, err
+			}
+		}
+	}
+
+	if ltxPageHeader.Pgno != 0 {
+		return 0, false, fmt.Errorf("ltx page %d beyond commit %d", ltxPageHeader.Pgno, r.header.Commit)
+	} else if err := dec.Close(); err != nil {
+		return 0, false, fmt.Errorf("close ltx decoder: %w", err)
+	}
+	return chksum, changed, nil
+}
+
+// readPage reads pgno as it exists after the journal is rolled back and the
+// WAL is checkpointed. Pages beyond the end of a truncated file are zero.
+func (r *RecoveryReader) readPage(pgno uint32, data []byte) error {
+	if r.walCommit > 0 {
+		if pgno > r.walCommit {
+			return zeroPage(data)
+		} else if offset, ok := r.walOffsets[pgno]; ok {
+			_, err := internal.ReadFullAt(r.walFile, data, offset+WALFrameHeaderSize)
+			return err
+		}
+	}
+
+	if r.journalValid && pgno > r.journalCommit {
+		return zeroPage(data)
+	} else if offset, ok := r.journalOffsets[pgno]; ok {
+		_, err := internal.ReadFullAt(r.journalFile, data, offset)
+		return err
+	}
+
+	if pgno > r.filePageN {
+		return zeroPage(data)
+	}
+	_, err := internal.ReadFullAt(r.dbFile, data, int64(pgno-1)*int64(r.pageSize))
+	return err
+}
+
+func zeroPage(data []byte) error {
+	for i := range data {
+		data[i] = 0
+	}
+	return nil
+}
+
+// isJournalHeaderValid returns true if the journal starts with the journal magic.
+func (db *DB) isJournalHeaderValid() (bool, error) {
+	f, err := os.Open(db.JournalPath())
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+
+	buf := make([]byte, len(SQLITE_JOURNAL_HEADER_STRING))
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return false, err
 	}
 	return string(buf) == SQLITE_JOURNAL_HEADER_STRING, nil
 }
@@ -2119,10 +2883,44 @@ func (db *DB) importToLTX(ctx context.Context, r io.Reader) (Pos, error) {
 	return pos, nil
 }
 
+// WaitWriters blocks until in-flight write transactions have completed. Unlike
+// AcquireWriteLock, it does not wait on read locks so long-running readers do
+// not delay the caller.
+func (db *DB) WaitWriters(ctx context.Context) error {
+	gs := db.newInternalGuardSet()
+	defer gs.Unlock()
+
+	// Acquire shared lock to check database mode. This is released before
+	// waiting so a rollback journal writer can still upgrade to commit.
+	if err := gs.pending.RLock(ctx); err != nil {
+		return fmt.Errorf("acquire PENDING read lock: %w", err)
+	}
+	if err := gs.shared.RLock(ctx); err != nil {
+		return fmt.Errorf("acquire SHARED read lock: %w", err)
+	}
+	mode := db.mode
+	gs.UnlockDatabase()
+
+	if err := gs.reserved.Lock(ctx); err != nil {
+		return fmt.Errorf("acquire RESERVED write lock: %w", err)
+	}
+	if mode == DBModeRollback {
+		if err := gs.pending.Lock(ctx); err != nil {
+			return fmt.Errorf("acquire PENDING write lock: %w", err)
+		}
+		return nil
+	}
+
+	if err := gs.write.Lock(ctx); err != nil {
+		return fmt.Errorf("acquire exclusive WAL_WRITE_LOCK: %w", err)
+	}
+	return nil
+}
+
 // AcquireWriteLock acquires the appropriate locks for a write depending on if
 // the database uses a rollback journal or WAL.
 func (db *DB) AcquireWriteLock(ctx context.Context) (_ *GuardSet, err error) {
-	gs := db.newGuardSet(0) // TODO(fsm): Track internal owners?
+	gs := db.newInternalGuardSet()
 	defer func() {
 		if err != nil {
 			gs.Unlock()
@@ -2201,6 +2999,23 @@ func (db *DB) CreateGuardSetIfNotExists(owner uint64) *GuardSet {
 	return guardSet
 }
 
+// newInternalGuardSet returns a guard set for locks acquired by LiteFS itself.
+// The guard set is reported by HeldLocks() until it is unlocked.
+func (db *DB) newInternalGuardSet() *GuardSet {
+	gs := db.newGuardSet(0)
+	gs.SetPID(os.Getpid())
+	gs.release = func() {
+		db.internalGuardSets.mu.Lock()
+		defer db.internalGuardSets.mu.Unlock()
+		delete(db.internalGuardSets.m, gs)
+	}
+
+	db.internalGuardSets.mu.Lock()
+	defer db.internalGuardSets.mu.Unlock()
+	db.internalGuardSets.m[gs] = struct{}{}
+	return gs
+}
+
 // newGuardSet returns a set of guards that can control locking for the database file.
 func (db *DB) newGuardSet(owner uint64) *GuardSet {
 	return &GuardSet{
@@ -2229,6 +3044,19 @@ func (db *DB) TryLocks(ctx context.Context, owner uint64, lockTypes []LockType)
 	for _, lockType := range lockTypes {
 		guard := guardSet.Guard(lockType)
 
+		// Reject new write transactions when the data directory is low on
+		// space so we fail before a commit instead of partway through one.
+		// Writes are also rejected while handing off the primary lease.
+		if (lockType == LockTypeReserved || lockType == LockTypeWrite) && guard.State() != RWMutexStateExclusive {
+			if db.store.LowDiskSpace() {
+				TraceLog.Printf("[TryLock(%s)]: type=%s owner=%d %s", db.name, lockType, owner, errorKeyValue(ErrLowDiskSpace))
+				return false, ErrLowDiskSpace
+			} else if db.store.HandoffNodeID() != "" {
+				TraceLog.Printf("[TryLock(%s)]: type=%s owner=%d %s", db.name, lockType, owner, errorKeyValue(ErrReadOnlyReplica))
+				return false, ErrReadOnlyReplica
+			}
+		}
+
 		// There is a race condition where a passive checkpoint can copy out data
 		// from the WAL to the database before an LTX file is written. To prevent
 		// that, we require that the owner has acquired the WRITE lock before
@@ -2304,6 +3132,185 @@ func (db *DB) CanRLock(ctx context.Context, owner uint64, lockTypes []LockType)
 	return true
 }
 
+// Locks acquires exclusive locks on one or more locks on the database for a
+// given owner, waiting until they become available. Returns ErrDeadlock if
+// waiting would deadlock with another waiting owner.
+func (db *DB) Locks(ctx context.Context, owner uint64, lockTypes []LockType) error {
+	return db.waitLocks(ctx, owner, lockTypes, true)
+}
+
+// RLocks acquires shared locks on one or more locks on the database for a
+// given owner, waiting until they become available. Returns ErrDeadlock if
+// waiting would deadlock with another waiting owner.
+func (db *DB) RLocks(ctx context.Context, owner uint64, lockTypes []LockType) error {
+	return db.waitLocks(ctx, owner, lockTypes, false)
+}
+
+func (db *DB) waitLocks(ctx context.Context, owner uint64, lockTypes []LockType, exclusive bool) error {
+	defer db.removeLockWaiter(owner)
+
+	t := time.Now()
+	for {
+		var ok bool
+		if exclusive {
+			var err error
+			if ok, err = db.TryLocks(ctx, owner, lockTypes); err != nil {
+				return err
+			}
+		} else {
+			ok = db.TryRLocks(ctx, owner, lockTypes)
+		}
+
+		if ok {
+			for _, lockType := range lockTypes {
+				dbLockWaitSecondsMetricVec.WithLabelValues(db.name, lockType.String()).Observe(time.Since(t).Seconds())
+			}
+			return nil
+		}
+
+		// Find the lock we are blocked on. If it has been released since the
+		// attempt above then simply try again.
+		ch, wait := db.lockBlockers(owner, lockTypes, exclusive)
+		if ch == nil {
+			continue
+		}
+
+		if err := db.addLockWaiter(owner, wait); err != nil {
+			TraceLog.Printf("[LockWait(%s)]: owner=%d lock=%s blockers=%v %s", db.name, owner, wait.lockType, wait.blockers, errorKeyValue(err))
+			return err
+		}
+		TraceLog.Printf("[LockWait(%s)]: owner=%d lock=%s blockers=%v status=WAIT", db.name, owner, wait.lockType, wait.blockers)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+		}
+
+		// Stop waiting before retrying. Otherwise another owner could see this
+		// stale wait edge while we briefly hold a lock and report a deadlock.
+		db.removeLockWaiter(owner)
+	}
+}
+
+// lockWait describes the lock that an owner is blocked on.
+type lockWait struct {
+	lockType  LockType
+	exclusive bool
+	blockers  []uint64 // owners holding a conflicting lock
+}
+
+// lockBlockers returns a channel that is notified when the first lock that
+// owner cannot acquire changes state, along with the owners holding it.
+// Returns a nil channel if all locks can be acquired.
+func (db *DB) lockBlockers(owner uint64, lockTypes []LockType, exclusive bool) (<-chan struct{}, lockWait) {
+	guardSet := db.CreateGuardSetIfNotExists(owner)
+	for _, lockType := range lockTypes {
+		guard := guardSet.Guard(lockType)
+
+		// The channel is obtained before checking the state so that a
+		// release between the check & the wait is not missed.
+		ch := guard.rw.changeCh()
+		if !exclusive {
+			if !guard.CanRLock() {
+				return ch, lockWait{lockType, false, db.lockHolders(owner, lockType, false)}
+			}
+			continue
+		}
+
+		// The CKPT lock is implicitly blocked by another owner's WRITE lock.
+		// See TryLocks() for details.
+		if lockType == LockTypeCkpt {
+			writeCh := db.writeLock.changeCh()
+			if db.writeLock.State() != RWMutexStateUnlocked && guardSet.write.State() != RWMutexStateExclusive {
+				return writeCh, lockWait{LockTypeWrite, true, db.lockHolders(owner, LockTypeWrite, true)}
+			}
+		}
+
+		if canLock, _ := guard.CanLock(); !canLock {
+			return ch, lockWait{lockType, true, db.lockHolders(owner, lockType, true)}
+		}
+	}
+	return nil, lockWait{}
+}
+
+// lockHolders returns the owners, other than owner, whose locks on lockType
+// conflict with an exclusive or shared lock.
+func (db *DB) lockHolders(owner uint64, lockType LockType, exclusive bool) []uint64 {
+	db.guardSets.mu.Lock()
+	defer db.guardSets.mu.Unlock()
+
+	var holders []uint64
+	for other, guardSet := range db.guardSets.m {
+		if other != owner && guardSet.conflicts(lockType, exclusive) {
+			holders = append(holders, other)
+		}
+	}
+	return holders
+}
+
+// holdsLock returns true if owner currently holds a lock on lockType that
+// conflicts with an exclusive or shared lock.
+func (db *DB) holdsLock(owner uint64, lockType LockType, exclusive bool) bool {
+	db.guardSets.mu.Lock()
+	defer db.guardSets.mu.Unlock()
+
+	guardSet := db.guardSets.m[owner]
+	return guardSet != nil && guardSet.conflicts(lockType, exclusive)
+}
+
+// addLockWaiter records that owner is waiting on the blockers in wait. Returns
+// ErrDeadlock if any of the blockers are, directly or indirectly, waiting on
+// owner.
+//
+// Wait edges are only cleared once a waiter wakes up so an edge may refer to
+// a lock that has since been released. Each edge is re-checked against the
+// current lock holders so that a stale edge is not reported as a deadlock.
+func (db *DB) addLockWaiter(owner uint64, wait lockWait) error {
+	db.lockWaiters.mu.Lock()
+	defer db.lockWaiters.mu.Unlock()
+
+	type edge struct {
+		other uint64
+		wait  lockWait
+	}
+
+	seen := make(map[uint64]struct{})
+	var stack []edge
+	for _, other := range wait.blockers {
+		stack = append(stack, edge{other, wait})
+	}
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if !db.holdsLock(e.other, e.wait.lockType, e.wait.exclusive) {
+			continue // stale edge, lock has been released
+		} else if e.other == owner {
+			return ErrDeadlock
+		} else if _, ok := seen[e.other]; ok {
+			continue
+		}
+		seen[e.other] = struct{}{}
+
+		if next, ok := db.lockWaiters.m[e.other]; ok {
+			for _, other := range next.blockers {
+				stack = append(stack, edge{other, next})
+			}
+		}
+	}
+
+	db.lockWaiters.m[owner] = wait
+	return nil
+}
+
+// removeLockWaiter clears the wait state for owner.
+func (db *DB) removeLockWaiter(owner uint64) {
+	db.lockWaiters.mu.Lock()
+	defer db.lockWaiters.mu.Unlock()
+	delete(db.lockWaiters.m, owner)
+}
+
 // Unlock unlocks one or more locks on the database for a given owner.
 func (db *DB) Unlock(ctx context.Context, owner uint64, lockTypes []LockType) {
 	guardSet := db.GuardSet(owner)
@@ -2326,6 +3333,109 @@ func (db *DB) Unlock(ctx context.Context, owner uint64, lockTypes []LockType) {
 	// TODO: Release guard set if completely unlocked.
 }
 
+// ReleaseLockOwner forcibly releases all locks held by owner & discards its
+// guard set. This recovers from processes that exit without the kernel
+// releasing their locks. Returns ErrLockOwnerNotFound if owner has no guard set.
+func (db *DB) ReleaseLockOwner(ctx context.Context, owner uint64) error {
+	if db.GuardSet(owner) == nil {
+		return ErrLockOwnerNotFound
+	}
+	TraceLog.Printf("[ReleaseLockOwner(%s)]: owner=%d", db.name, owner)
+
+	// Release through the same paths as a closed file handle so that any
+	// committed WAL frames are processed before the WRITE lock is dropped.
+	db.UnlockSHM(ctx, owner)
+	db.UnlockDatabase(ctx, owner)
+
+	db.guardSets.mu.Lock()
+	delete(db.guardSets.m, owner)
+	db.guardSets.mu.Unlock()
+
+	dbLockOwnerReleaseCountMetricVec.WithLabelValues(db.name).Inc()
+	return nil
+}
+
+// HeldLocks returns a list of all locks currently held on the database,
+// sorted by owner & lock type. Locks held by LiteFS itself are reported with
+// an owner of zero & the PID of the LiteFS process.
+func (db *DB) HeldLocks() []*LockInfo {
+	db.internalGuardSets.mu.Lock()
+	guardSets := make([]*GuardSet, 0, len(db.internalGuardSets.m))
+	for guardSet := range db.internalGuardSets.m {
+		guardSets = append(guardSets, guardSet)
+	}
+	db.internalGuardSets.mu.Unlock()
+
+	db.guardSets.mu.Lock()
+	for _, guardSet := range db.guardSets.m {
+		guardSets = append(guardSets, guardSet)
+	}
+	db.guardSets.mu.Unlock()
+
+	sort.SliceStable(guardSets, func(i, j int) bool { return guardSets[i].owner < guardSets[j].owner })
+
+	var infos []*LockInfo
+	for _, guardSet := range guardSets {
+		for _, lockType := range lockTypes {
+			guard := guardSet.Guard(lockType)
+			state, acquiredAt := guard.State(), guard.AcquiredAt()
+			if state == RWMutexStateUnlocked {
+				continue
+			}
+
+			infos = append(infos, &LockInfo{
+				Type:       lockType,
+				State:      state,
+				Owner:      guardSet.owner,
+				PID:        guardSet.PID(),
+				AcquiredAt: acquiredAt,
+			})
+		}
+	}
+	return infos
+}
+
+// mutex returns the database mutex for a given lock type.
+func (db *DB) mutex(lockType LockType) *RWMutex {
+	switch lockType {
+	case LockTypePending:
+		return &db.pendingLock
+	case LockTypeShared:
+		return &db.sharedLock
+	case LockTypeReserved:
+		return &db.reservedLock
+	case LockTypeWrite:
+		return &db.writeLock
+	case LockTypeCkpt:
+		return &db.ckptLock
+	case LockTypeRecover:
+		return &db.recoverLock
+	case LockTypeRead0:
+		return &db.read0Lock
+	case LockTypeRead1:
+		return &db.read1Lock
+	case LockTypeRead2:
+		return &db.read2Lock
+	case LockTypeRead3:
+		return &db.read3Lock
+	case LockTypeRead4:
+		return &db.read4Lock
+	case LockTypeDMS:
+		return &db.dmsLock
+	default:
+		panic("DB.mutex(): invalid lock type")
+	}
+}
+
+// LockInfo describes a lock held on a database by a single owner.
+type LockInfo struct {
+	Type       LockType
+	State      RWMutexState
+	Owner      uint64
+	PID        int // process ID of the owner, if known
+	AcquiredAt time.Time
+}
+
 // InWriteTx returns true if the RESERVED lock has an exclusive lock.
 func (db *DB) InWriteTx() bool {
 	return db.reservedLock.State() == RWMutexStateExclusive
@@ -2381,68 +3491,580 @@ func (db *DB) pageChecksum(pgno, pageN uint32, newWALChecksums map[uint32]uint64
 	}
 
 	// Finally, pull the checksum from the database.
-	chksum, ok = db.chksums.m[pgno]
-	return chksum, ok
+	return db.chksums.pages.get(pgno)
 }
 
-// WriteSnapshotTo writes an LTX snapshot to dst.
-func (db *DB) WriteSnapshotTo(ctx context.Context, dst io.Writer) (header ltx.Header, trailer ltx.Trailer, err error) {
-	gs := db.newGuardSet(0) // TODO(fsm): Track internal owners?
-	defer gs.Unlock()
+// PageRangeChecksums returns the checksums of each range of rangeSize pages.
+// A remote node can compare these against its own to find differing pages.
+func (db *DB) PageRangeChecksums(rangeSize uint32) *PageRangeChecksums {
+	assert(rangeSize > 0, "range size must be greater than zero")
 
-	// Acquire PENDING then SHARED. Release PENDING immediately afterward.
-	if err := gs.pending.RLock(ctx); err != nil {
-		return header, trailer, fmt.Errorf("acquire PENDING read lock: %w", err)
+	db.chksums.mu.Lock()
+	defer db.chksums.mu.Unlock()
+	return db.pageRangeChecksums(db.pageN, rangeSize)
+}
+
+// pageRangeChecksums computes range checksums for the first pageN pages.
+//
+// Database WRITE lock and db.chksums.mu should be held when invoked.
+func (db *DB) pageRangeChecksums(pageN, rangeSize uint32) *PageRangeChecksums {
+	ranges := &PageRangeChecksums{
+		PageSize:  db.pageSize,
+		PageN:     pageN,
+		RangeSize: rangeSize,
+		Checksums: make([]uint64, (pageN+rangeSize-1)/rangeSize),
 	}
-	if err := gs.shared.RLock(ctx); err != nil {
-		return header, trailer, fmt.Errorf("acquire SHARED read lock: %w", err)
+	for pgno := uint32(1); pgno <= pageN; pgno++ {
+		chksum, _ := db.pageChecksum(pgno, pageN, nil)
+		ranges.Checksums[(pgno-1)/rangeSize] ^= chksum
 	}
-	gs.pending.Unlock()
+	return ranges
+}
 
-	// If this is WAL mode then temporarily obtain a write lock so we can copy
-	// out the current database size & wal frames before returning to a read lock.
-	if db.mode == DBModeWAL {
-		if err := gs.write.Lock(ctx); err != nil {
-			return header, trailer, fmt.Errorf("acquire temporary exclusive WAL_WRITE_LOCK: %w", err)
+// WriteSnapshotTo writes an LTX snapshot to dst.
+func (db *DB) WriteSnapshotTo(ctx context.Context, dst io.Writer) (header ltx.Header, trailer ltx.Trailer, err error) {
+	return db.writeLTXTo(ctx, dst, Pos{}, nil)
+}
+
+// WriteDiffTo writes an LTX file to dst that moves a remote database at pos to
+// the current position of db. The remote database is described by ranges and
+// only pages within differing ranges are included.
+//
+// The LTX file uses the current TXID as both its min & max TXID and it uses
+// the remote checksum as its pre-apply checksum. This allows it to be applied
+// to a remote database which has diverged from this database.
+func (db *DB) WriteDiffTo(ctx context.Context, dst io.Writer, pos Pos, ranges *PageRangeChecksums) (header ltx.Header, trailer ltx.Trailer, err error) {
+	if pos.IsZero() {
+		return header, trailer, fmt.Errorf("remote position required")
+	} else if ranges == nil || ranges.RangeSize == 0 {
+		return header, trailer, fmt.Errorf("remote page ranges required")
+	}
+	return db.writeLTXTo(ctx, dst, pos, ranges)
+}
+
+// WriteHistoricalTo reconstructs the database as of txID & writes its pages to
+// w. See OpenHistoricalView() for how pages are resolved.
+//
+// Returns ErrTxNotAvailable if txID is not a retained transaction boundary or
+// if any of its pages have been removed by retention.
+func (db *DB) WriteHistoricalTo(ctx context.Context, w io.WriterAt, txID uint64) (header ltx.Header, err error) {
+	v, err := db.OpenHistoricalView(ctx, txID)
+	if err != nil {
+		return header, err
+	}
+	defer func() { _ = v.Close() }()
+	header = v.Header()
+
+	// Copy in chunks so locks on the current database are held briefly.
+	const chunkPageN = 256
+	pageSize := int64(header.PageSize)
+	buf := make([]byte, chunkPageN*pageSize)
+	lockPgno := ltx.LockPgno(header.PageSize)
+
+	var chksum uint64
+	for pgno := uint32(1); pgno <= header.Commit; pgno += chunkPageN {
+		n, err := v.ReadAt(ctx, buf, int64(pgno-1)*pageSize)
+		if err != nil && err != io.EOF {
+			return header, err
+		}
+		if _, err := w.WriteAt(buf[:n], int64(pgno-1)*pageSize); err != nil {
+			return header, fmt.Errorf("write page %d: %w", pgno, err)
+		}
+
+		for i := 0; i < n/int(pageSize); i++ {
+			if p := pgno + uint32(i); p != lockPgno {
+				chksum ^= ltx.ChecksumPage(p, buf[int64(i)*pageSize:int64(i+1)*pageSize])
+			}
 		}
 	}
 
-	// Determine current position & snapshot overriding WAL frames.
-	pos := db.Pos()
-	pageSize, pageN := db.pageSize, db.pageN
-	walFrameOffsets := make(map[uint32]int64, len(db.wal.frameOffsets))
-	for k, v := range db.wal.frameOffsets {
-		walFrameOffsets[k] = v
+	if actual, expected := ltx.ChecksumFlag|chksum, v.trailer.PostApplyChecksum; actual != expected {
+		return header, fmt.Errorf("database checksum %016x at TXID %s does not match expected %016x", actual, ltx.FormatTXID(txID), expected)
 	}
+	return header, nil
+}
 
-	// Release write lock, if acquired.
-	gs.write.Unlock()
+// HistoricalView is a read-only view of the database as of a retained
+// transaction. Pages written since that transaction are resolved from retained
+// LTX files & cached in an unlinked file. All other pages are read from the
+// current database on demand. A view is shared by all readers of the same
+// transaction until the last one closes it.
+type HistoricalView struct {
+	db      *DB
+	txID    uint64
+	header  ltx.Header  // header of LTX file ending at txID
+	trailer ltx.Trailer // trailer of LTX file ending at txID
+	refN    int         // protected by db.historicalViews.mu
+
+	mu       sync.Mutex
+	pos      uint64           // TXID of current database that dirty is based on
+	pageN    uint32           // smallest size of current database since txID
+	allDirty bool             // true if page size has changed since txID
+	dirty    map[uint32]int64 // offset of cached page for pages changed since txID
+	file     *os.File         // cache of dirty pages
+	size     int64            // size of cache file
+}
 
-	// Acquire the CKPT & READ locks to prevent checkpointing, in case this is in WAL mode.
-	if err := gs.read0.RLock(ctx); err != nil {
-		return header, trailer, fmt.Errorf("acquire READ0 read lock: %w", err)
+// OpenHistoricalView returns a view of the database as of txID. The caller
+// must close the view when done.
+//
+// Returns ErrTxNotAvailable if txID is not a retained transaction boundary or
+// if any of its pages have been removed by retention. Returns ErrLowDiskSpace
+// if there is not enough free space to cache the pages changed since txID.
+func (db *DB) OpenHistoricalView(ctx context.Context, txID uint64) (*HistoricalView, error) {
+	db.historicalViews.mu.Lock()
+	defer db.historicalViews.mu.Unlock()
+
+	if v := db.historicalViews.m[txID]; v != nil {
+		v.refN++
+		return v, nil
 	}
-	if err := gs.read1.RLock(ctx); err != nil {
-		return header, trailer, fmt.Errorf("acquire READ1 read lock: %w", err)
+
+	filename, err := db.historicalLTXFile(txID)
+	if err != nil {
+		return nil, err
 	}
-	if err := gs.read2.RLock(ctx); err != nil {
-		return header, trailer, fmt.Errorf("acquire READ2 read lock: %w", err)
+	header, trailer, err := readLTXPages(filename, func(hdr ltx.Header, pgno uint32, data []byte) (bool, error) {
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	if err := gs.read3.RLock(ctx); err != nil {
-		return header, trailer, fmt.Errorf("acquire READ3 read lock: %w", err)
+
+	f, err := os.CreateTemp(db.path, ".historical-*")
+	if err != nil {
+		return nil, err
+	} else if err := os.Remove(f.Name()); err != nil {
+		_ = f.Close()
+		return nil, err
 	}
-	if err := gs.read4.RLock(ctx); err != nil {
-		return header, trailer, fmt.Errorf("acquire READ4 read lock: %w", err)
+
+	v := &HistoricalView{
+		db:      db,
+		txID:    txID,
+		header:  header,
+		trailer: trailer,
+		refN:    1,
+		pos:     txID,
+		pageN:   header.Commit,
+		dirty:   make(map[uint32]int64),
+		file:    f,
 	}
-	if err := gs.ckpt.RLock(ctx); err != nil {
-		return header, trailer, fmt.Errorf("acquire CKPT read lock: %w", err)
+
+	// Resolve pages changed since txID up front so errors are reported on open.
+	gs := db.newInternalGuardSet()
+	defer gs.Unlock()
+	state, err := db.acquireSnapshotLocks(ctx, gs, nil)
+	if err == nil {
+		err = v.update(state)
 	}
-	if err := gs.recover.RLock(ctx); err != nil {
-		return header, trailer, fmt.Errorf("acquire RECOVER read lock: %w", err)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	db.historicalViews.m[txID] = v
+	return v, nil
+}
+
+// historicalLTXFile returns the path of the retained LTX file ending at txID.
+func (db *DB) historicalLTXFile(txID uint64) (string, error) {
+	ents, err := db.ReadLTXDir()
+	if err != nil {
+		return "", err
+	}
+	for _, ent := range ents {
+		if minTXID, maxTXID, _ := ltx.ParseFilename(ent.Name()); maxTXID == txID {
+			return db.LTXPath(minTXID, maxTXID), nil
+		}
+	}
+	return "", ErrTxNotAvailable
+}
+
+// Header returns the header of the LTX file ending at the view's transaction.
+// Its commit & page size describe the database as of that transaction.
+func (v *HistoricalView) Header() ltx.Header { return v.header }
+
+// Close releases the view. The page cache is removed once all readers of the
+// view have closed it.
+func (v *HistoricalView) Close() error {
+	v.db.historicalViews.mu.Lock()
+	defer v.db.historicalViews.mu.Unlock()
+
+	if v.refN--; v.refN > 0 {
+		return nil
+	}
+	delete(v.db.historicalViews.m, v.txID)
+	return v.file.Close()
+}
+
+// ReadAt reads the database as of the view's transaction into data starting
+// at offset. Returns io.EOF if the read extends past the end of the database.
+func (v *HistoricalView) ReadAt(ctx context.Context, data []byte, offset int64) (n int, err error) {
+	pageSize := int64(v.header.PageSize)
+	size := int64(v.header.Commit) * pageSize
+	if offset >= size {
+		return 0, io.EOF
+	}
+
+	var eof error
+	if int64(len(data)) > size-offset {
+		data, eof = data[:size-offset], io.EOF
+	}
+
+	// Lock the current database so unchanged pages can be read consistently.
+	gs := v.db.newInternalGuardSet()
+	defer gs.Unlock()
+	state, err := v.db.acquireSnapshotLocks(ctx, gs, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.update(state); err != nil {
+		return 0, err
+	}
+
+	dbFile, err := os.Open(v.db.DatabasePath())
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = dbFile.Close() }()
+
+	var walFile *os.File
+	if len(state.walFrameOffsets) > 0 {
+		if walFile, err = os.Open(v.db.WALPath()); err != nil {
+			return 0, err
+		}
+		defer func() { _ = walFile.Close() }()
+	}
+
+	page := make([]byte, pageSize)
+	lockPgno := ltx.LockPgno(v.header.PageSize)
+	for n < len(data) {
+		pgno := uint32((offset+int64(n))/pageSize) + 1
+		pageOffset := (offset + int64(n)) % pageSize
+
+		if pgno == lockPgno {
+			for i := range page {
+				page[i] = 0
+			}
+		} else if cacheOffset, ok := v.dirty[pgno]; ok {
+			if _, err := internal.ReadFullAt(v.file, page, cacheOffset); err != nil {
+				return n, fmt.Errorf("read cached page %d: %w", pgno, err)
+			}
+		} else if err := state.readPage(dbFile, walFile, pgno, page); err != nil {
+			return n, fmt.Errorf("read page %d: %w", pgno, err)
+		}
+		n += copy(data[n:], page[pageOffset:])
+	}
+	return n, eof
+}
+
+// update marks pages written between the view's position & the current state
+// as dirty & caches their version as of the view's transaction. Must be
+// called while the snapshot locks for state are held.
+func (v *HistoricalView) update(state snapshotState) error {
+	if state.pos.TXID < v.pos {
+		return ErrTxNotAvailable // database has been rewound
+	}
+
+	// Pages beyond the end of the current database must be resolved from LTX
+	// files. All pages must be if the page size has changed.
+	pending := make(map[uint32]struct{})
+	if state.pageSize != v.header.PageSize {
+		if !v.allDirty {
+			v.allDirty = true
+			for pgno := uint32(1); pgno <= v.header.Commit; pgno++ {
+				v.markDirty(pending, pgno)
+			}
+		}
+	} else if state.pageN < v.pageN {
+		for pgno := state.pageN + 1; pgno <= v.pageN; pgno++ {
+			v.markDirty(pending, pgno)
+		}
+		v.pageN = state.pageN
+	}
+
+	if state.pos.TXID > v.pos {
+		ents, err := v.db.ReadLTXDir()
+		if err != nil {
+			return err
+		}
+
+		// Every transaction since the view's position must be retained,
+		// otherwise changed pages would be read from the current database.
+		next := v.pos + 1
+		for _, ent := range ents {
+			minTXID, maxTXID, _ := ltx.ParseFilename(ent.Name())
+			if maxTXID <= v.pos || maxTXID > state.pos.TXID {
+				continue
+			} else if minTXID > next {
+				return ErrTxNotAvailable
+			}
+			next = maxTXID + 1
+
+			if _, _, err := readLTXPages(v.db.LTXPath(minTXID, maxTXID), func(hdr ltx.Header, pgno uint32, data []byte) (bool, error) {
+				v.markDirty(pending, pgno)
+				return true, nil
+			}); os.IsNotExist(err) {
+				return ErrTxNotAvailable
+			} else if err != nil {
+				return err
+			}
+		}
+		if next != state.pos.TXID+1 {
+			return ErrTxNotAvailable
+		}
+		v.pos = state.pos.TXID
+	}
+
+	return v.cachePages(pending)
+}
+
+// markDirty adds pgno to pending if it is within the view & not yet cached.
+func (v *HistoricalView) markDirty(pending map[uint32]struct{}, pgno uint32) {
+	if pgno > v.header.Commit || pgno == ltx.LockPgno(v.header.PageSize) {
+		return
+	} else if _, ok := v.dirty[pgno]; ok {
+		return
+	}
+	pending[pgno] = struct{}{}
+}
+
+// cachePages copies the latest version of each pending page at or before the
+// view's transaction from retained LTX files into the page cache.
+func (v *HistoricalView) cachePages(pending map[uint32]struct{}) error {
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// Ensure the cache does not push the data directory below its minimum.
+	store := v.db.store
+	if store.LowDiskSpace() {
+		return ErrLowDiskSpace
+	} else if free, err := store.FreeSpace(); err != nil {
+		return fmt.Errorf("free space: %w", err)
+	} else if free-int64(len(pending))*int64(v.header.PageSize) < store.Settings().MinFreeSpace {
+		return ErrLowDiskSpace
+	}
+
+	ents, err := v.db.ReadLTXDir()
+	if err != nil {
+		return err
+	}
+	var filenames []string
+	for _, ent := range ents {
+		if minTXID, maxTXID, _ := ltx.ParseFilename(ent.Name()); maxTXID <= v.txID {
+			filenames = append(filenames, v.db.LTXPath(minTXID, maxTXID))
+		}
+	}
+
+	// Read LTX files in reverse so the latest version of each page is used.
+	for i := len(filenames) - 1; i >= 0 && len(pending) > 0; i-- {
+		if _, _, err := readLTXPages(filenames[i], func(hdr ltx.Header, pgno uint32, data []byte) (bool, error) {
+			if hdr.PageSize != v.header.PageSize {
+				return false, nil
+			} else if _, ok := pending[pgno]; !ok {
+				return true, nil
+			}
+
+			if _, err := v.file.WriteAt(data, v.size); err != nil {
+				return false, fmt.Errorf("cache page %d: %w", pgno, err)
+			}
+			v.dirty[pgno] = v.size
+			v.size += int64(len(data))
+			delete(pending, pgno)
+			return len(pending) > 0, nil
+		}); os.IsNotExist(err) {
+			return ErrTxNotAvailable // removed by retention
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(pending) > 0 {
+		return ErrTxNotAvailable
+	}
+	return nil
+}
+
+// writeSnapshotAt writes the pages of the current database to w at their
+// offsets within the database file.
+func (db *DB) writeSnapshotAt(ctx context.Context, w io.WriterAt) (header ltx.Header, err error) {
+	pr, pw := io.Pipe()
+	go func() {
+		_, _, err := db.WriteSnapshotTo(ctx, pw)
+		_ = pw.CloseWithError(err)
+	}()
+	defer func() { _ = pr.Close() }()
+
+	dec := ltx.NewDecoder(pr)
+	if err := dec.DecodeHeader(); err != nil {
+		return header, fmt.Errorf("decode snapshot header: %w", err)
+	}
+	header = dec.Header()
+
+	data := make([]byte, header.PageSize)
+	for {
+		var hdr ltx.PageHeader
+		if err := dec.DecodePage(&hdr, data); err == io.EOF {
+			break
+		} else if err != nil {
+			return header, fmt.Errorf("decode snapshot page: %w", err)
+		}
+
+		if _, err := w.WriteAt(data, int64(hdr.Pgno-1)*int64(header.PageSize)); err != nil {
+			return header, fmt.Errorf("write page %d: %w", hdr.Pgno, err)
+		}
+	}
+	if err := dec.Close(); err != nil {
+		return header, fmt.Errorf("close snapshot: %w", err)
+	}
+	return header, nil
+}
+
+// TXIDAt returns the last retained TXID committed at or before t. Returns
+// ErrTxNotAvailable if no retained transaction is old enough.
+func (db *DB) TXIDAt(t time.Time) (uint64, error) {
+	ents, err := db.ReadLTXDir()
+	if err != nil {
+		return 0, err
+	}
+
+	var txID uint64
+	for _, ent := range ents {
+		minTXID, maxTXID, _ := ltx.ParseFilename(ent.Name())
+
+		f, err := os.Open(db.LTXPath(minTXID, maxTXID))
+		if os.IsNotExist(err) {
+			continue // removed by retention
+		} else if err != nil {
+			return 0, err
+		}
+		hdr, _, err := ltx.DecodeHeader(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return 0, fmt.Errorf("decode ltx header: %w", err)
+		}
+
+		if hdr.Timestamp > t.UnixMilli() {
+			break
+		}
+		txID = maxTXID
+	}
+
+	if txID == 0 {
+		return 0, ErrTxNotAvailable
+	}
+	return txID, nil
+}
+
+// HistoricalHeader returns the header of the retained LTX file ending at txID.
+// Its commit & page size describe the database as of that transaction.
+func (db *DB) HistoricalHeader(txID uint64) (ltx.Header, error) {
+	ents, err := db.ReadLTXDir()
+	if err != nil {
+		return ltx.Header{}, err
+	}
+	for _, ent := range ents {
+		if minTXID, maxTXID, _ := ltx.ParseFilename(ent.Name()); maxTXID == txID {
+			f, err := os.Open(db.LTXPath(minTXID, maxTXID))
+			if os.IsNotExist(err) {
+				return ltx.Header{}, ErrTxNotAvailable // removed by retention
+			} else if err != nil {
+				return ltx.Header{}, err
+			}
+			defer func() { _ = f.Close() }()
+
+			hdr, _, err := ltx.DecodeHeader(f)
+			if err != nil {
+				return hdr, fmt.Errorf("decode ltx header: %w", err)
+			}
+			return hdr, nil
+		}
+	}
+	return ltx.Header{}, ErrTxNotAvailable
+}
+
+// readLTXPages decodes the LTX file at filename & calls fn for each page. The
+// file is only read to the end, and its trailer returned, if fn returns true
+// for every page.
+func readLTXPages(filename string, fn func(hdr ltx.Header, pgno uint32, data []byte) (bool, error)) (header ltx.Header, trailer ltx.Trailer, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return header, trailer, err
+	}
+	defer func() { _ = f.Close() }()
+
+	dec := ltx.NewDecoder(f)
+	if err := dec.DecodeHeader(); err != nil {
+		return header, trailer, fmt.Errorf("decode ltx header: %w", err)
+	}
+	header = dec.Header()
+
+	data := make([]byte, header.PageSize)
+	for {
+		var hdr ltx.PageHeader
+		if err := dec.DecodePage(&hdr, data); err == io.EOF {
+			break
+		} else if err != nil {
+			return header, trailer, fmt.Errorf("decode ltx page: %w", err)
+		}
+
+		if ok, err := fn(header, hdr.Pgno, data); err != nil {
+			return header, trailer, err
+		} else if !ok {
+			return header, trailer, nil
+		}
+	}
+
+	if err := dec.Close(); err != nil {
+		return header, trailer, fmt.Errorf("close ltx file: %w", err)
+	}
+	return header, dec.Trailer(), nil
+}
+
+// writeLTXTo writes the current database state to dst. If ranges is nil then
+// a snapshot is written. Otherwise, only pages which differ from ranges are
+// written and the file is based on the remote position, pos.
+func (db *DB) writeLTXTo(ctx context.Context, dst io.Writer, remotePos Pos, ranges *PageRangeChecksums) (header ltx.Header, trailer ltx.Trailer, err error) {
+	gs := db.newInternalGuardSet()
+	defer gs.Unlock()
+
+	// Compute our range checksums while writes are blocked.
+	var localRanges *PageRangeChecksums
+	state, err := db.acquireSnapshotLocks(ctx, gs, func(pageN uint32) {
+		if ranges != nil {
+			db.chksums.mu.Lock()
+			localRanges = db.pageRangeChecksums(pageN, ranges.RangeSize)
+			db.chksums.mu.Unlock()
+		}
+	})
+	if err != nil {
+		return header, trailer, err
+	}
+	pos, pageSize, pageN := state.pos, state.pageSize, state.pageN
+
+	// Diffs must be based on an earlier transaction than the current one and
+	// the remote database must use the same page size.
+	if ranges != nil {
+		if pos.TXID <= 1 {
+			return header, trailer, fmt.Errorf("cannot write diff at tx %s", ltx.FormatTXID(pos.TXID))
+		} else if ranges.PageSize != pageSize {
+			return header, trailer, fmt.Errorf("remote page size mismatch: %d <> %d", ranges.PageSize, pageSize)
+		}
 	}
 
 	// Log transaction ID for the snapshot.
-	log.Printf("writing snapshot %q @ %s", db.name, ltx.FormatTXID(pos.TXID))
+	if ranges != nil {
+		log.Printf("writing diff %q @ %s from %s", db.name, ltx.FormatTXID(pos.TXID), remotePos)
+	} else {
+		log.Printf("writing snapshot %q @ %s", db.name, ltx.FormatTXID(pos.TXID))
+	}
 
 	// Open database file.
 	dbFile, err := os.Open(db.DatabasePath())
@@ -2453,7 +4075,7 @@ func (db *DB) WriteSnapshotTo(ctx context.Context, dst io.Writer) (header ltx.He
 
 	// Open WAL file if we have overriding WAL frames.
 	var walFile *os.File
-	if len(walFrameOffsets) > 0 {
+	if len(state.walFrameOffsets) > 0 {
 		if walFile, err = os.Open(db.WALPath()); err != nil {
 			return header, trailer, fmt.Errorf("open wal file: %w", err)
 		}
@@ -2461,8 +4083,7 @@ func (db *DB) WriteSnapshotTo(ctx context.Context, dst io.Writer) (header ltx.He
 	}
 
 	// Write current database state to an LTX writer.
-	enc := ltx.NewEncoder(dst)
-	if err := enc.EncodeHeader(ltx.Header{
+	hdr := ltx.Header{
 		Version:   ltx.Version,
 		Flags:     db.ltxHeaderFlags(),
 		PageSize:  pageSize,
@@ -2470,7 +4091,14 @@ func (db *DB) WriteSnapshotTo(ctx context.Context, dst io.Writer) (header ltx.He
 		MinTXID:   1,
 		MaxTXID:   pos.TXID,
 		Timestamp: db.Now().UnixMilli(),
-	}); err != nil {
+	}
+	if ranges != nil {
+		hdr.MinTXID = pos.TXID
+		hdr.PreApplyChecksum = remotePos.PostApplyChecksum
+	}
+
+	enc := ltx.NewEncoder(dst)
+	if err := enc.EncodeHeader(hdr); err != nil {
 		return header, trailer, fmt.Errorf("encode ltx header: %w", err)
 	}
 
@@ -2484,21 +4112,19 @@ func (db *DB) WriteSnapshotTo(ctx context.Context, dst io.Writer) (header ltx.He
 			continue
 		}
 
-		// Read from WAL if page exists in offset map. Otherwise read from DB.
-		if walFrameOffset, ok := walFrameOffsets[pgno]; ok {
-			if _, err := walFile.Seek(walFrameOffset+WALFrameHeaderSize, io.SeekStart); err != nil {
-				return header, trailer, fmt.Errorf("seek wal page: %w", err)
-			} else if _, err := io.ReadFull(walFile, pageData); err != nil {
-				return header, trailer, fmt.Errorf("read wal page: %w", err)
-			}
-		} else {
-			if _, err := dbFile.Seek(int64(pgno-1)*int64(pageSize), io.SeekStart); err != nil {
-				return header, trailer, fmt.Errorf("seek database page: %w", err)
-			} else if _, err := io.ReadFull(dbFile, pageData); err != nil {
-				return header, trailer, fmt.Errorf("read database page: %w", err)
+		// Skip pages in ranges that match the remote database.
+		if ranges != nil {
+			remoteChksum, ok := ranges.RangeChecksum(pgno)
+			if localChksum, _ := localRanges.RangeChecksum(pgno); ok && pgno <= ranges.PageN && localChksum == remoteChksum {
+				continue
 			}
 		}
 
+		// Read from WAL if page exists in offset map. Otherwise read from DB.
+		if err := state.readPage(dbFile, walFile, pgno, pageData); err != nil {
+			return header, trailer, err
+		}
+
 		if err := enc.EncodePage(ltx.PageHeader{Pgno: pgno}, pageData); err != nil {
 			return header, trailer, fmt.Errorf("encode page frame: %w", err)
 		}
@@ -2506,9 +4132,12 @@ func (db *DB) WriteSnapshotTo(ctx context.Context, dst io.Writer) (header ltx.He
 		chksum ^= ltx.ChecksumPage(pgno, pageData)
 	}
 
-	// Set the database checksum before we write the trailer.
+	// Set the database checksum before we write the trailer. Diffs do not
+	// contain every page so the checksum is verified when applied instead.
 	postApplyChecksum := ltx.ChecksumFlag | chksum
-	if postApplyChecksum != pos.PostApplyChecksum {
+	if ranges != nil {
+		postApplyChecksum = pos.PostApplyChecksum
+	} else if postApplyChecksum != pos.PostApplyChecksum {
 		return header, trailer, fmt.Errorf("snapshot checksum mismatch at tx %s: %x <> %x", ltx.FormatTXID(pos.TXID), postApplyChecksum, pos.PostApplyChecksum)
 	}
 	enc.SetPostApplyChecksum(postApplyChecksum)
@@ -2520,6 +4149,94 @@ func (db *DB) WriteSnapshotTo(ctx context.Context, dst io.Writer) (header ltx.He
 	return enc.Header(), enc.Trailer(), nil
 }
 
+// snapshotState is the state of a database while the locks acquired by
+// acquireSnapshotLocks() are held.
+type snapshotState struct {
+	pos             Pos
+	pageSize        uint32
+	pageN           uint32
+	walFrameOffsets map[uint32]int64 // committed WAL frames at pos
+}
+
+// acquireSnapshotLocks acquires read locks on gs so that the database file &
+// the WAL frames at the current position cannot change until gs is unlocked.
+// Returns the state of the database at that position. In WAL mode, writers
+// are briefly blocked while the state is copied and fn is called, if set.
+func (db *DB) acquireSnapshotLocks(ctx context.Context, gs *GuardSet, fn func(pageN uint32)) (state snapshotState, err error) {
+	// Acquire PENDING then SHARED. Release PENDING immediately afterward.
+	if err := gs.pending.RLock(ctx); err != nil {
+		return state, fmt.Errorf("acquire PENDING read lock: %w", err)
+	}
+	if err := gs.shared.RLock(ctx); err != nil {
+		return state, fmt.Errorf("acquire SHARED read lock: %w", err)
+	}
+	gs.pending.Unlock()
+
+	// If this is WAL mode then temporarily obtain a write lock so we can copy
+	// out the current database size & wal frames before returning to a read lock.
+	if db.mode == DBModeWAL {
+		if err := gs.write.Lock(ctx); err != nil {
+			return state, fmt.Errorf("acquire temporary exclusive WAL_WRITE_LOCK: %w", err)
+		}
+	}
+
+	// Determine current position & snapshot overriding WAL frames.
+	state.pos = db.Pos()
+	state.pageSize, state.pageN = db.pageSize, db.pageN
+	state.walFrameOffsets = make(map[uint32]int64, len(db.wal.frameOffsets))
+	for k, v := range db.wal.frameOffsets {
+		state.walFrameOffsets[k] = v
+	}
+
+	if fn != nil {
+		fn(state.pageN)
+	}
+
+	// Release write lock, if acquired.
+	gs.write.Unlock()
+
+	// Acquire the CKPT & READ locks to prevent checkpointing, in case this is in WAL mode.
+	if err := gs.read0.RLock(ctx); err != nil {
+		return state, fmt.Errorf("acquire READ0 read lock: %w", err)
+	}
+	if err := gs.read1.RLock(ctx); err != nil {
+		return state, fmt.Errorf("acquire READ1 read lock: %w", err)
+	}
+	if err := gs.read2.RLock(ctx); err != nil {
+		return state, fmt.Errorf("acquire READ2 read lock: %w", err)
+	}
+	if err := gs.read3.RLock(ctx); err != nil {
+		return state, fmt.Errorf("acquire READ3 read lock: %w", err)
+	}
+	if err := gs.read4.RLock(ctx); err != nil {
+		return state, fmt.Errorf("acquire READ4 read lock: %w", err)
+	}
+	if err := gs.ckpt.RLock(ctx); err != nil {
+		return state, fmt.Errorf("acquire CKPT read lock: %w", err)
+	}
+	if err := gs.recover.RLock(ctx); err != nil {
+		return state, fmt.Errorf("acquire RECOVER read lock: %w", err)
+	}
+
+	return state, nil
+}
+
+// readPage reads pgno from the WAL, if it has a committed frame, or from the
+// database file. walFile may be nil if there are no WAL frames.
+func (s *snapshotState) readPage(dbFile, walFile *os.File, pgno uint32, data []byte) error {
+	if offset, ok := s.walFrameOffsets[pgno]; ok {
+		if _, err := internal.ReadFullAt(walFile, data, offset+WALFrameHeaderSize); err != nil {
+			return fmt.Errorf("read wal page: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := internal.ReadFullAt(dbFile, data, int64(pgno-1)*int64(s.pageSize)); err != nil {
+		return fmt.Errorf("read database page: %w", err)
+	}
+	return nil
+}
+
 // EnforceRetention removes all LTX files created before minTime.
 func (db *DB) EnforceRetention(ctx context.Context, minTime time.Time) error {
 	// Collect all LTX files.
@@ -2564,15 +4281,63 @@ func (db *DB) EnforceRetention(ctx context.Context, minTime time.Time) error {
 	return nil
 }
 
+// checkMaxSize returns ErrDatabaseFull if writing pgno would cause the
+// database to exceed its configured maximum size.
+func (db *DB) checkMaxSize(pgno uint32) error {
+	maxSize := db.store.DBConfig(db.name).MaxSize
+	if maxSize <= 0 {
+		return nil
+	} else if int64(pgno)*int64(db.pageSize) > maxSize {
+		return ErrDatabaseFull
+	}
+	return nil
+}
+
 // ltxHeaderFlags returns flags used for the LTX header.
 func (db *DB) ltxHeaderFlags() uint32 {
 	var flags uint32
-	if db.store.Compress {
+	if db.store.DBConfig(db.name).Compress {
 		flags |= ltx.HeaderFlagCompressLZ4
 	}
 	return flags
 }
 
+// pageChecksums stores per-page checksums in a slice indexed by page number.
+// This uses far less memory than a map for large databases. A zero value
+// represents a missing checksum since page checksums always set ltx.ChecksumFlag.
+type pageChecksums []uint64
+
+// pageN returns the highest page number that can hold a checksum.
+func (a pageChecksums) pageN() uint32 { return uint32(len(a)) }
+
+// get returns the checksum for pgno and true if it exists.
+func (a pageChecksums) get(pgno uint32) (uint64, bool) {
+	if pgno == 0 || pgno > a.pageN() {
+		return 0, false
+	}
+	chksum := a[pgno-1]
+	return chksum, chksum != 0
+}
+
+// set sets the checksum for pgno, growing the slice if necessary.
+func (a *pageChecksums) set(pgno uint32, chksum uint64) {
+	if n := int(pgno); n > len(*a) {
+		*a = append(*a, make([]uint64, n-len(*a))...)
+	}
+	(*a)[pgno-1] = chksum
+}
+
+// truncate removes all checksums after pageN.
+func (a *pageChecksums) truncate(pageN uint32) {
+	if pageN >= a.pageN() {
+		return
+	}
+	for i := pageN; i < a.pageN(); i++ {
+		(*a)[i] = 0
+	}
+	*a = (*a)[:pageN]
+}
+
 type dbVarJSON struct {
 	Name     string `json:"name"`
 	TXID     string `json:"txid"`
@@ -2812,4 +4577,31 @@ var (
 		Name: "litefs_db_latency_seconds",
 		Help: "Latency between generating an LTX file and consuming it.",
 	}, []string{"db"})
+
+	dbWALBytesMetricVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "litefs_db_wal_bytes",
+		Help: "Size of the committed portion of the WAL file, in bytes.",
+	}, []string{"db"})
+
+	dbCheckpointCountMetricVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "litefs_db_checkpoint_count",
+		Help: "Number of checkpoints performed by LiteFS.",
+	}, []string{"db", "mode"})
+
+	dbLockWaitSecondsMetricVec = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "litefs_db_lock_wait_seconds",
+		Help:    "Time spent waiting to acquire a blocking lock.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"db", "type"})
+
+	dbLockHoldSecondsMetricVec = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "litefs_db_lock_hold_seconds",
+		Help:    "Time a lock was held before being released.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"db", "type"})
+
+	dbLockOwnerReleaseCountMetricVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "litefs_db_lock_owner_release_count",
+		Help: "Number of lock owners whose locks were forcibly released.",
+	}, []string{"db"})
 )
@@ -0,0 +1,618 @@
+package litefs_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/superfly/litefs"
+	"github.com/superfly/ltx"
+)
+
+func TestDB_WriteDiffTo(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-and-write-snapshot")
+		if err := store.Open(); err != nil {
+			t.Fatal(err)
+		}
+		db := store.DB("sqlite.db")
+
+		// Simulate a remote database which differs on page 2 and is ahead of the primary.
+		ranges := db.PageRangeChecksums(1)
+		ranges.Checksums[1] ^= 1
+		remotePos := litefs.Pos{TXID: db.TXID() + 5, PostApplyChecksum: ltx.ChecksumFlag | 1234}
+
+		var buf bytes.Buffer
+		hdr, trailer, err := db.WriteDiffTo(context.Background(), &buf, remotePos, ranges)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := hdr.MinTXID, db.TXID(); got != want {
+			t.Fatalf("MinTXID=%d, want %d", got, want)
+		} else if got, want := hdr.MaxTXID, db.TXID(); got != want {
+			t.Fatalf("MaxTXID=%d, want %d", got, want)
+		} else if got, want := hdr.PreApplyChecksum, remotePos.PostApplyChecksum; got != want {
+			t.Fatalf("PreApplyChecksum=%016x, want %016x", got, want)
+		} else if got, want := trailer.PostApplyChecksum, db.Pos().PostApplyChecksum; got != want {
+			t.Fatalf("PostApplyChecksum=%016x, want %016x", got, want)
+		}
+
+		// Ensure only the differing page is included.
+		dec := ltx.NewDecoder(&buf)
+		if err := dec.DecodeHeader(); err != nil {
+			t.Fatal(err)
+		}
+
+		var pgnos []uint32
+		data := make([]byte, hdr.PageSize)
+		for {
+			var phdr ltx.PageHeader
+			if err := dec.DecodePage(&phdr, data); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			pgnos = append(pgnos, phdr.Pgno)
+		}
+		if err := dec.Close(); err != nil {
+			t.Fatal(err)
+		} else if got, want := pgnos, []uint32{2}; len(got) != 1 || got[0] != want[0] {
+			t.Fatalf("pgnos=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrPageSizeMismatch", func(t *testing.T) {
+		store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-and-write-snapshot")
+		if err := store.Open(); err != nil {
+			t.Fatal(err)
+		}
+		db := store.DB("sqlite.db")
+
+		ranges := db.PageRangeChecksums(4)
+		ranges.PageSize *= 2
+		remotePos := litefs.Pos{TXID: 1, PostApplyChecksum: ltx.ChecksumFlag | 1234}
+		if _, _, err := db.WriteDiffTo(context.Background(), io.Discard, remotePos, ranges); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestDB_PageRangeChecksums(t *testing.T) {
+	store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-and-write-snapshot")
+	if err := store.Open(); err != nil {
+		t.Fatal(err)
+	}
+	db := store.DB("sqlite.db")
+
+	// The XOR of all ranges should equal the database checksum.
+	ranges := db.PageRangeChecksums(3)
+	var chksum uint64
+	for _, v := range ranges.Checksums {
+		chksum ^= v
+	}
+	if got, want := ltx.ChecksumFlag|chksum, db.Pos().PostApplyChecksum; got != want {
+		t.Fatalf("checksum=%016x, want %016x", got, want)
+	} else if got, want := len(ranges.Checksums), int((ranges.PageN+2)/3); got != want {
+		t.Fatalf("len(Checksums)=%d, want %d", got, want)
+	}
+}
+
+func TestDB_Checkpoint(t *testing.T) {
+	t.Run("RollbackMode", func(t *testing.T) {
+		store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-and-write-snapshot")
+		if err := store.Open(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Checkpointing is a no-op outside of WAL mode.
+		if err := store.DB("sqlite.db").Checkpoint(context.Background(), litefs.CheckpointModeTruncate); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("ErrInvalidMode", func(t *testing.T) {
+		store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-and-write-snapshot")
+		if err := store.Open(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.DB("sqlite.db").Checkpoint(context.Background(), "RESTART"); err == nil || err.Error() != `invalid checkpoint mode: "RESTART"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestDB_Locks(t *testing.T) {
+	t.Run("WaitForUnlock", func(t *testing.T) {
+		store := newOpenStore(t, newPrimaryStaticLeaser(), nil)
+		db, f, err := store.CreateDB("db")
+		if err != nil {
+			t.Fatal(err)
+		} else if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		lockTypes := []litefs.LockType{litefs.LockTypeReserved}
+		if ok, err := db.TryLocks(context.Background(), 1, lockTypes); err != nil {
+			t.Fatal(err)
+		} else if !ok {
+			t.Fatal("expected lock")
+		}
+
+		errCh := make(chan error)
+		go func() { errCh <- db.Locks(context.Background(), 2, lockTypes) }()
+
+		select {
+		case err := <-errCh:
+			t.Fatalf("unexpected lock acquisition: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		db.Unlock(context.Background(), 1, lockTypes)
+		if err := <-errCh; err != nil {
+			t.Fatal(err)
+		} else if got, want := db.GuardSet(2).Reserved().State(), litefs.RWMutexStateExclusive; got != want {
+			t.Fatalf("state=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("SharedWaitForUnlock", func(t *testing.T) {
+		store := newOpenStore(t, newPrimaryStaticLeaser(), nil)
+		db, f, err := store.CreateDB("db")
+		if err != nil {
+			t.Fatal(err)
+		} else if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		lockTypes := []litefs.LockType{litefs.LockTypePending}
+		if ok, err := db.TryLocks(context.Background(), 1, lockTypes); err != nil {
+			t.Fatal(err)
+		} else if !ok {
+			t.Fatal("expected lock")
+		}
+
+		errCh := make(chan error)
+		go func() { errCh <- db.RLocks(context.Background(), 2, lockTypes) }()
+		time.Sleep(100 * time.Millisecond)
+
+		db.Unlock(context.Background(), 1, lockTypes)
+		if err := <-errCh; err != nil {
+			t.Fatal(err)
+		} else if got, want := db.GuardSet(2).Pending().State(), litefs.RWMutexStateShared; got != want {
+			t.Fatalf("state=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("ContextCanceled", func(t *testing.T) {
+		store := newOpenStore(t, newPrimaryStaticLeaser(), nil)
+		db, f, err := store.CreateDB("db")
+		if err != nil {
+			t.Fatal(err)
+		} else if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		lockTypes := []litefs.LockType{litefs.LockTypeReserved}
+		if err := db.Locks(context.Background(), 1, lockTypes); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		if err := db.Locks(ctx, 2, lockTypes); err != context.DeadlineExceeded {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrDeadlock", func(t *testing.T) {
+		store := newOpenStore(t, newPrimaryStaticLeaser(), nil)
+		db, f, err := store.CreateDB("db")
+		if err != nil {
+			t.Fatal(err)
+		} else if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Owner 1 holds PENDING & owner 2 holds RESERVED.
+		if err := db.Locks(context.Background(), 1, []litefs.LockType{litefs.LockTypePending}); err != nil {
+			t.Fatal(err)
+		} else if err := db.Locks(context.Background(), 2, []litefs.LockType{litefs.LockTypeReserved}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Owner 1 waits on owner 2's RESERVED lock.
+		errCh := make(chan error)
+		go func() { errCh <- db.Locks(context.Background(), 1, []litefs.LockType{litefs.LockTypeReserved}) }()
+		time.Sleep(100 * time.Millisecond)
+
+		// Owner 2 waiting on owner 1's PENDING lock would deadlock.
+		if err := db.Locks(context.Background(), 2, []litefs.LockType{litefs.LockTypePending}); err != litefs.ErrDeadlock {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Releasing owner 2's lock allows owner 1 to continue.
+		db.Unlock(context.Background(), 2, []litefs.LockType{litefs.LockTypeReserved})
+		if err := <-errCh; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("ReleaseThenBlock", func(t *testing.T) {
+		store := newOpenStore(t, newPrimaryStaticLeaser(), nil)
+		db, f, err := store.CreateDB("db")
+		if err != nil {
+			t.Fatal(err)
+		} else if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Owner 1 holds PENDING while owners 2 & 3 hold SHARED.
+		if err := db.Locks(context.Background(), 1, []litefs.LockType{litefs.LockTypePending}); err != nil {
+			t.Fatal(err)
+		} else if !db.TryRLocks(context.Background(), 2, []litefs.LockType{litefs.LockTypeShared}) {
+			t.Fatal("expected lock")
+		} else if !db.TryRLocks(context.Background(), 3, []litefs.LockType{litefs.LockTypeShared}) {
+			t.Fatal("expected lock")
+		}
+
+		// Owner 1 waits on owners 2 & 3 for an exclusive SHARED lock.
+		errCh1 := make(chan error)
+		go func() { errCh1 <- db.Locks(context.Background(), 1, []litefs.LockType{litefs.LockTypeShared}) }()
+		time.Sleep(100 * time.Millisecond)
+
+		// Owner 2 releases SHARED & immediately waits on owner 1's PENDING
+		// lock. Owner 1 is no longer waiting on owner 2 so this is not a
+		// deadlock, even if owner 1 has not woken up yet.
+		db.Unlock(context.Background(), 2, []litefs.LockType{litefs.LockTypeShared})
+		errCh2 := make(chan error)
+		go func() { errCh2 <- db.Locks(context.Background(), 2, []litefs.LockType{litefs.LockTypePending}) }()
+
+		select {
+		case err := <-errCh2:
+			t.Fatalf("unexpected lock result: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		// Releasing owner 3 lets owner 1 finish, which then lets owner 2 finish.
+		db.Unlock(context.Background(), 3, []litefs.LockType{litefs.LockTypeShared})
+		if err := <-errCh1; err != nil {
+			t.Fatal(err)
+		}
+		db.Unlock(context.Background(), 1, []litefs.LockType{litefs.LockTypePending, litefs.LockTypeShared})
+		if err := <-errCh2; err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestDB_WaitWriters(t *testing.T) {
+	store := newOpenStore(t, newPrimaryStaticLeaser(), nil)
+	db, f, err := store.CreateDB("db")
+	if err != nil {
+		t.Fatal(err)
+	} else if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Owner 1 holds a read transaction open which should not block.
+	readLockTypes := []litefs.LockType{litefs.LockTypeShared, litefs.LockTypeRead0}
+	if err := db.RLocks(context.Background(), 1, readLockTypes); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	if err := db.WaitWriters(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Owner 2 holds a write transaction open which should block.
+	if err := db.Locks(context.Background(), 2, []litefs.LockType{litefs.LockTypeReserved}); err != nil {
+		t.Fatal(err)
+	}
+
+	errCh := make(chan error)
+	go func() { errCh <- db.WaitWriters(context.Background()) }()
+
+	select {
+	case err := <-errCh:
+		t.Fatalf("unexpected return: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	db.Unlock(context.Background(), 2, []litefs.LockType{litefs.LockTypeReserved})
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	// The reader's locks should be unaffected.
+	if got, want := db.GuardSet(1).Read0().State(), litefs.RWMutexStateShared; got != want {
+		t.Fatalf("state=%s, want %s", got, want)
+	}
+}
+
+func TestDB_HeldLocks(t *testing.T) {
+	store := newOpenStore(t, newPrimaryStaticLeaser(), nil)
+	db, f, err := store.CreateDB("db")
+	if err != nil {
+		t.Fatal(err)
+	} else if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if locks := db.HeldLocks(); len(locks) != 0 {
+		t.Fatalf("unexpected locks: %#v", locks)
+	}
+
+	db.CreateGuardSetIfNotExists(2).SetPID(1000)
+	if !db.TryRLocks(context.Background(), 2, []litefs.LockType{litefs.LockTypeShared}) {
+		t.Fatal("expected lock")
+	} else if err := db.Locks(context.Background(), 2, []litefs.LockType{litefs.LockTypeReserved}); err != nil {
+		t.Fatal(err)
+	} else if !db.TryRLocks(context.Background(), 1, []litefs.LockType{litefs.LockTypeShared}) {
+		t.Fatal("expected lock")
+	}
+
+	locks := db.HeldLocks()
+	if got, want := len(locks), 3; got != want {
+		t.Fatalf("len=%d, want %d", got, want)
+	}
+	for i, want := range []litefs.LockInfo{
+		{Type: litefs.LockTypeShared, State: litefs.RWMutexStateShared, Owner: 1},
+		{Type: litefs.LockTypeShared, State: litefs.RWMutexStateShared, Owner: 2, PID: 1000},
+		{Type: litefs.LockTypeReserved, State: litefs.RWMutexStateExclusive, Owner: 2, PID: 1000},
+	} {
+		got := *locks[i]
+		if got.AcquiredAt.IsZero() {
+			t.Fatalf("%d. expected acquisition time", i)
+		}
+		got.AcquiredAt = time.Time{}
+		if got != want {
+			t.Fatalf("%d. lock=%#v, want %#v", i, got, want)
+		}
+	}
+
+	// Released locks should no longer be reported.
+	db.Unlock(context.Background(), 2, []litefs.LockType{litefs.LockTypeShared, litefs.LockTypeReserved})
+	if got, want := len(db.HeldLocks()), 1; got != want {
+		t.Fatalf("len=%d, want %d", got, want)
+	}
+	db.Unlock(context.Background(), 1, []litefs.LockType{litefs.LockTypeShared})
+
+	// Locks held internally are reported with a zero owner & the current PID.
+	guard, err := db.AcquireWriteLock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	locks = db.HeldLocks()
+	if len(locks) == 0 {
+		t.Fatal("expected locks")
+	}
+	for i, lock := range locks {
+		if got, want := lock.Owner, uint64(0); got != want {
+			t.Fatalf("%d. owner=%d, want %d", i, got, want)
+		} else if got, want := lock.PID, os.Getpid(); got != want {
+			t.Fatalf("%d. pid=%d, want %d", i, got, want)
+		}
+	}
+
+	guard.Unlock()
+	if locks := db.HeldLocks(); len(locks) != 0 {
+		t.Fatalf("unexpected locks: %#v", locks)
+	}
+}
+
+func TestDB_ReleaseLockOwner(t *testing.T) {
+	store := newOpenStore(t, newPrimaryStaticLeaser(), nil)
+	db, f, err := store.CreateDB("db")
+	if err != nil {
+		t.Fatal(err)
+	} else if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lockTypes := []litefs.LockType{litefs.LockTypeShared, litefs.LockTypeReserved}
+	if err := db.Locks(context.Background(), 1, lockTypes); err != nil {
+		t.Fatal(err)
+	}
+
+	errCh := make(chan error)
+	go func() { errCh <- db.Locks(context.Background(), 2, lockTypes) }()
+	time.Sleep(100 * time.Millisecond)
+
+	// Releasing the owner should unblock the waiter & discard the guard set.
+	if err := db.ReleaseLockOwner(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	} else if err := <-errCh; err != nil {
+		t.Fatal(err)
+	} else if db.GuardSet(1) != nil {
+		t.Fatal("expected guard set to be removed")
+	}
+
+	if err := db.ReleaseLockOwner(context.Background(), 1); err != litefs.ErrLockOwnerNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestDB_WriteHistoricalTo(t *testing.T) {
+	store := newOpenStore(t, newPrimaryStaticLeaser(), nil)
+	db, f, err := store.CreateDB("db")
+	if err != nil {
+		t.Fatal(err)
+	} else if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db.Now = func() time.Time { return time.UnixMilli(1000) }
+
+	// Import a 3-page database as TXID 1.
+	const pageSize = 512
+	pages := newTestDatabasePages(pageSize, 3)
+	if err := db.Import(context.Background(), bytes.NewReader(bytes.Join(pages, nil))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Update page 2 in TXID 2 & then page 1 while truncating page 3 in TXID 3.
+	page2 := bytes.Repeat([]byte{4}, pageSize)
+	applyTestLTX(t, db, 3, 2000, map[uint32][]byte{2: page2}, [][]byte{pages[0], page2, pages[2]})
+	txID2 := [][]byte{pages[0], page2, pages[2]}
+
+	page1 := append([]byte{}, pages[0]...)
+	page1[100] = 5
+	applyTestLTX(t, db, 2, 3000, map[uint32][]byte{1: page1}, [][]byte{page1, page2})
+
+	t.Run("OK", func(t *testing.T) {
+		for txID, want := range map[uint64][][]byte{1: pages, 2: txID2, 3: {page1, page2}} {
+			f, err := os.CreateTemp(t.TempDir(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = f.Close() }()
+
+			hdr, err := db.WriteHistoricalTo(context.Background(), f, txID)
+			if err != nil {
+				t.Fatalf("TXID %d: %s", txID, err)
+			} else if got, want := hdr.Commit, uint32(len(want)); got != want {
+				t.Fatalf("TXID %d: Commit=%d, want %d", txID, got, want)
+			}
+
+			if buf, err := os.ReadFile(f.Name()); err != nil {
+				t.Fatal(err)
+			} else if !bytes.Equal(buf, bytes.Join(want, nil)) {
+				t.Fatalf("TXID %d: database mismatch", txID)
+			}
+		}
+	})
+
+	t.Run("ErrTxNotAvailable", func(t *testing.T) {
+		f, err := os.CreateTemp(t.TempDir(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = f.Close() }()
+
+		for _, txID := range []uint64{0, 4} {
+			if _, err := db.WriteHistoricalTo(context.Background(), f, txID); err != litefs.ErrTxNotAvailable {
+				t.Fatalf("TXID %d: unexpected error: %v", txID, err)
+			}
+		}
+	})
+
+	t.Run("TXIDAt", func(t *testing.T) {
+		if txID, err := db.TXIDAt(time.UnixMilli(2500)); err != nil {
+			t.Fatal(err)
+		} else if got, want := txID, uint64(2); got != want {
+			t.Fatalf("TXID=%d, want %d", got, want)
+		}
+
+		if txID, err := db.TXIDAt(time.UnixMilli(5000)); err != nil {
+			t.Fatal(err)
+		} else if got, want := txID, uint64(3); got != want {
+			t.Fatalf("TXID=%d, want %d", got, want)
+		}
+
+		if _, err := db.TXIDAt(time.UnixMilli(500)); err != litefs.ErrTxNotAvailable {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// Views are shared per TXID & remain at their TXID as the database changes.
+	t.Run("View", func(t *testing.T) {
+		v, err := db.OpenHistoricalView(context.Background(), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = v.Close() }()
+
+		other, err := db.OpenHistoricalView(context.Background(), 2)
+		if err != nil {
+			t.Fatal(err)
+		} else if other != v {
+			t.Fatal("expected view to be shared")
+		} else if err := other.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Overwrite the page that was unchanged since TXID 2.
+		page3 := bytes.Repeat([]byte{6}, pageSize)
+		applyTestLTX(t, db, 3, 6000, map[uint32][]byte{3: page3}, [][]byte{page1, page2, page3})
+
+		buf := make([]byte, 3*pageSize)
+		if n, err := v.ReadAt(context.Background(), buf, 0); err != nil {
+			t.Fatal(err)
+		} else if n != len(buf) {
+			t.Fatalf("n=%d, want %d", n, len(buf))
+		} else if !bytes.Equal(buf, bytes.Join(txID2, nil)) {
+			t.Fatal("database mismatch")
+		}
+
+		if _, err := v.ReadAt(context.Background(), buf, 3*pageSize); err != io.EOF {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// newTestDatabasePages returns n pages of a rollback journal database. Each
+// page is filled with its page number after the header.
+func newTestDatabasePages(pageSize, n int) [][]byte {
+	pages := make([][]byte, n)
+	for i := range pages {
+		pages[i] = bytes.Repeat([]byte{byte(i + 1)}, pageSize)
+	}
+	copy(pages[0], "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(pages[0][16:], uint16(pageSize))
+	pages[0][18], pages[0][19] = 1, 1
+	binary.BigEndian.PutUint32(pages[0][24:], 0)
+	binary.BigEndian.PutUint32(pages[0][28:], uint32(n))
+	binary.BigEndian.PutUint32(pages[0][40:], 0)
+	return pages
+}
+
+// applyTestLTX writes the next LTX file for db containing pages & applies it.
+// The database contents after the transaction are passed as all.
+func applyTestLTX(tb testing.TB, db *litefs.DB, commit uint32, timestamp int64, pages map[uint32][]byte, all [][]byte) {
+	tb.Helper()
+
+	pos := db.Pos()
+	var chksum uint64
+	for i, data := range all {
+		chksum ^= ltx.ChecksumPage(uint32(i+1), data)
+	}
+
+	var buf bytes.Buffer
+	enc := ltx.NewEncoder(&buf)
+	if err := enc.EncodeHeader(ltx.Header{
+		Version:          1,
+		PageSize:         uint32(len(all[0])),
+		Commit:           commit,
+		MinTXID:          pos.TXID + 1,
+		MaxTXID:          pos.TXID + 1,
+		Timestamp:        timestamp,
+		PreApplyChecksum: pos.PostApplyChecksum,
+	}); err != nil {
+		tb.Fatal(err)
+	}
+	for pgno := uint32(1); pgno <= commit; pgno++ {
+		if data, ok := pages[pgno]; ok {
+			if err := enc.EncodePage(ltx.PageHeader{Pgno: pgno}, data); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	enc.SetPostApplyChecksum(ltx.ChecksumFlag | chksum)
+	if err := enc.Close(); err != nil {
+		tb.Fatal(err)
+	}
+
+	path := db.LTXPath(pos.TXID+1, pos.TXID+1)
+	if err := os.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		tb.Fatal(err)
+	} else if err := db.ApplyLTX(context.Background(), path); err != nil {
+		tb.Fatal(err)
+	}
+}
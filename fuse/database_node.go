@@ -81,16 +81,18 @@ func (n *DatabaseNode) Fsync(ctx context.Context, req *fuse.FsyncRequest) error
 
 func (n *DatabaseNode) Forget() { n.fsys.root.ForgetNode(n) }
 
-// ENOSYS is a special return code for xattr requests that will be treated as a permanent failure for any such
-// requests in the future without being sent to the filesystem.
+// Setxattr & Removexattr return ENOSYS so the kernel stops sending those
+// requests. Getxattr returns ENODATA for unknown attributes instead so that
+// extended attributes are not disabled for the whole mount. See getxattr().
 // Source: https://github.com/libfuse/libfuse/blob/0b6d97cf5938f6b4885e487c3bd7b02144b1ea56/include/fuse_lowlevel.h#L811
 
 func (n *DatabaseNode) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
-	return fuse.ToErrno(syscall.ENOSYS)
+	listxattr(n.fsys.dbXattrs(n.db), resp)
+	return nil
 }
 
 func (n *DatabaseNode) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
-	return fuse.ToErrno(syscall.ENOSYS)
+	return getxattr(n.fsys.dbXattrs(n.db), req, resp)
 }
 
 func (n *DatabaseNode) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
@@ -102,7 +104,8 @@ func (n *DatabaseNode) Removexattr(ctx context.Context, req *fuse.RemovexattrReq
 }
 
 func (n *DatabaseNode) Poll(ctx context.Context, req *fuse.PollRequest, resp *fuse.PollResponse) error {
-	return fuse.Errno(syscall.ENOSYS)
+	resp.REvents = fuse.DefaultPollMask
+	return nil
 }
 
 var _ fs.Handle = (*DatabaseHandle)(nil)
@@ -153,7 +156,8 @@ func (h *DatabaseHandle) Lock(ctx context.Context, req *fuse.LockRequest) error
 }
 
 func (h *DatabaseHandle) LockWait(ctx context.Context, req *fuse.LockWaitRequest) error {
-	return fuse.Errno(syscall.ENOSYS)
+	lockTypes := litefs.ParseDatabaseLockRange(req.Lock.Start, req.Lock.End)
+	return lockWait(ctx, req, h.node.db, lockTypes)
 }
 
 func (h *DatabaseHandle) Unlock(ctx context.Context, req *fuse.UnlockRequest) error {
@@ -169,6 +173,8 @@ func (h *DatabaseHandle) QueryLock(ctx context.Context, req *fuse.QueryLockReque
 }
 
 func lock(ctx context.Context, req *fuse.LockRequest, db *litefs.DB, lockTypes []litefs.LockType) error {
+	setLockOwnerPID(db, uint64(req.LockOwner), req.Pid)
+
 	switch typ := req.Lock.Type; typ {
 	case fuse.LockUnlock:
 		return nil
@@ -176,7 +182,7 @@ func lock(ctx context.Context, req *fuse.LockRequest, db *litefs.DB, lockTypes [
 	case fuse.LockWrite:
 		if ok, err := db.TryLocks(ctx, uint64(req.LockOwner), lockTypes); err != nil {
 			log.Printf("fuse lock error: %s", err)
-			return err
+			return ToError(err)
 		} else if !ok {
 			return syscall.EAGAIN
 		}
@@ -193,6 +199,43 @@ func lock(ctx context.Context, req *fuse.LockRequest, db *litefs.DB, lockTypes [
 	}
 }
 
+// setLockOwnerPID records the process making a lock request on the owner's
+// guard set. FUSE reports the calling thread so it is resolved to its process,
+// which may outlive the thread. POSIX lock owners belong to a single process
+// so this only needs to be done when the owner starts acquiring locks.
+func setLockOwnerPID(db *litefs.DB, owner uint64, tid uint32) {
+	guardSet := db.CreateGuardSetIfNotExists(owner)
+	if guardSet.PID() != 0 && guardSet.IsLocked() {
+		return
+	}
+	guardSet.SetPID(processID(int(tid)))
+}
+
+// lockWait blocks until the POSIX lock is acquired. Returns EINTR if the
+// request is interrupted & EDEADLK if waiting would cause a deadlock.
+func lockWait(ctx context.Context, req *fuse.LockWaitRequest, db *litefs.DB, lockTypes []litefs.LockType) error {
+	setLockOwnerPID(db, uint64(req.LockOwner), req.Pid)
+
+	var err error
+	switch typ := req.Lock.Type; typ {
+	case fuse.LockUnlock:
+		return nil
+	case fuse.LockWrite:
+		err = db.Locks(ctx, uint64(req.LockOwner), lockTypes)
+	case fuse.LockRead:
+		err = db.RLocks(ctx, uint64(req.LockOwner), lockTypes)
+	default:
+		panic("fuse.lockWait(): invalid POSIX lock type")
+	}
+
+	if err == context.Canceled {
+		return fuse.Errno(syscall.EINTR)
+	} else if err != nil && err != litefs.ErrDeadlock {
+		log.Printf("fuse lock wait error: %s", err)
+	}
+	return ToError(err)
+}
+
 func queryLock(ctx context.Context, req *fuse.QueryLockRequest, resp *fuse.QueryLockResponse, db *litefs.DB, lockTypes []litefs.LockType) {
 	switch req.Lock.Type {
 	case fuse.LockRead:
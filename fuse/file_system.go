@@ -1,16 +1,28 @@
 package fuse
 
 import (
+	"bufio"
 	"context"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 	"github.com/superfly/litefs"
 )
 
+// Default file system settings.
+const (
+	DefaultPosWaitTimeout    = 5 * time.Second
+	DefaultStaleLockInterval = 10 * time.Second
+)
+
 var _ fs.FS = (*FileSystem)(nil)
 var _ fs.FSStatfser = (*FileSystem)(nil)
 var _ litefs.Invalidator = (*FileSystem)(nil)
@@ -23,6 +35,7 @@ type FileSystem struct {
 	conn   *fuse.Conn
 	server *fs.Server
 	root   *RootNode
+	cancel func() // stops background monitors
 
 	// If true, allows other users to access the FUSE mount.
 	// Must set "user_allow_other" option in /etc/fuse.conf as well.
@@ -34,6 +47,18 @@ type FileSystem struct {
 
 	// If true, enables debug logging.
 	Debug bool
+
+	// Hostname of this node. Reported as the primary in extended
+	// attributes while this node holds the lease.
+	Hostname string
+
+	// Maximum time a write to a "-pos" file waits for the database to
+	// reach the written TXID.
+	PosWaitTimeout time.Duration
+
+	// Interval between checks for locks held by processes that have exited
+	// or no longer have the database open. Set to zero to disable.
+	StaleLockInterval time.Duration
 }
 
 // NewFileSystem returns a new instance of FileSystem.
@@ -44,6 +69,9 @@ func NewFileSystem(path string, store *litefs.Store) *FileSystem {
 
 		Uid: os.Getuid(),
 		Gid: os.Getgid(),
+
+		PosWaitTimeout:    DefaultPosWaitTimeout,
+		StaleLockInterval: DefaultStaleLockInterval,
 	}
 
 	fsys.root = newRootNode(fsys)
@@ -92,11 +120,92 @@ func (fsys *FileSystem) Mount() (err error) {
 		}
 	}()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	fsys.cancel = cancel
+	go fsys.monitorPrimary(ctx)
+	if fsys.StaleLockInterval > 0 {
+		go fsys.monitorStaleLocks(ctx)
+	}
+
 	return nil
 }
 
+// monitorPrimary wakes up pollers on the primary file when the primary changes.
+func (fsys *FileSystem) monitorPrimary(ctx context.Context) {
+	ch := fsys.store.PrimaryChangeCh()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ch:
+		}
+
+		// Obtain the next channel before invalidating so that a change that
+		// occurs during invalidation is not missed.
+		ch = fsys.store.PrimaryChangeCh()
+		if err := fsys.InvalidatePrimary(); err != nil {
+			log.Printf("invalidate primary: %s", err)
+		}
+	}
+}
+
+// monitorStaleLocks periodically releases locks left behind by lock owners
+// whose process has exited without the kernel releasing them.
+func (fsys *FileSystem) monitorStaleLocks(ctx context.Context) {
+	ticker := time.NewTicker(fsys.StaleLockInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fsys.ReleaseStaleLocks(ctx)
+		}
+	}
+}
+
+// ReleaseStaleLocks releases all locks held by owners whose process has
+// exited or no longer has the database open. Returns the number of owners
+// whose locks were released.
+func (fsys *FileSystem) ReleaseStaleLocks(ctx context.Context) (n int) {
+	for _, db := range fsys.store.DBs() {
+		// Check each owner once, even if it holds multiple locks. Locks held
+		// by LiteFS itself use owner zero & are never stale.
+		pids := make(map[uint64]int)
+		for _, info := range db.HeldLocks() {
+			if info.Owner != 0 && info.PID != 0 {
+				pids[info.Owner] = info.PID
+			}
+		}
+
+		for owner, pid := range pids {
+			if isLockOwnerActive(pid, db.Name()) {
+				continue
+			}
+
+			// Skip if the owner was reused by another process since the check.
+			if guardSet := db.GuardSet(owner); guardSet == nil || guardSet.PID() != pid {
+				continue
+			}
+
+			log.Printf("releasing stale locks: db=%s owner=%d pid=%d", db.Name(), owner, pid)
+			if err := db.ReleaseLockOwner(ctx, owner); err != nil {
+				log.Printf("release stale locks: db=%s owner=%d: %s", db.Name(), owner, err)
+				continue
+			}
+			n++
+		}
+	}
+	return n
+}
+
 // Unmount unmounts the file system.
 func (fsys *FileSystem) Unmount() (err error) {
+	if fsys.cancel != nil {
+		fsys.cancel()
+	}
+
 	if fsys.conn != nil {
 		if e := fuse.Unmount(fsys.path); err == nil {
 			err = e
@@ -171,7 +280,8 @@ func (fsys *FileSystem) InvalidateSHM(db *litefs.DB) error {
 	return nil
 }
 
-// InvalidatePos invalidates the position file in the kernel page cache.
+// InvalidatePos invalidates the position file in the kernel page cache and
+// wakes up any pollers waiting on a position change.
 func (fsys *FileSystem) InvalidatePos(db *litefs.DB) error {
 	node := fsys.root.Node(db.Name() + "-pos")
 	if node == nil {
@@ -181,6 +291,28 @@ func (fsys *FileSystem) InvalidatePos(db *litefs.DB) error {
 	if err := fsys.server.InvalidateNodeData(node); err != nil && err != fuse.ErrNotCached {
 		return err
 	}
+
+	if node, ok := node.(*PosNode); ok {
+		node.waiters.notify(fsys.server)
+	}
+	return nil
+}
+
+// InvalidatePrimary invalidates the primary file in the kernel page cache and
+// wakes up any pollers waiting on a primary change.
+func (fsys *FileSystem) InvalidatePrimary() error {
+	node := fsys.root.Node(PrimaryFilename)
+	if node == nil {
+		return nil
+	}
+
+	if err := fsys.server.InvalidateNodeData(node); err != nil && err != fuse.ErrNotCached {
+		return err
+	}
+
+	if node, ok := node.(*PrimaryNode); ok {
+		node.waiters.notify(fsys.server)
+	}
 	return nil
 }
 
@@ -200,3 +332,53 @@ func (fsys *FileSystem) debugFn(msg any) {
 	}
 	log.Printf("%s [%s]: %s", fsys.store.ID(), status, msg)
 }
+
+// processID returns the process that a thread belongs to. Returns tid if the
+// thread no longer exists or cannot be inspected.
+func processID(tid int) int {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", tid))
+	if err != nil {
+		return tid
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "Tgid:") {
+			if pid, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Tgid:"))); err == nil {
+				return pid
+			}
+			break
+		}
+	}
+	return tid
+}
+
+// isLockOwnerActive returns true if the process still has the database or its
+// SHM file open. Processes that cannot be inspected are assumed to be active.
+func isLockOwnerActive(pid int, name string) bool {
+	dir := fmt.Sprintf("/proc/%d/fd", pid)
+	ents, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return false // process has exited
+	} else if err != nil {
+		return true
+	}
+
+	for _, ent := range ents {
+		// Only the base name is compared as the process may see the mount
+		// at a different path from another mount namespace.
+		target, err := os.Readlink(filepath.Join(dir, ent.Name()))
+		if os.IsNotExist(err) {
+			continue // closed since the directory was read
+		} else if err != nil {
+			return true
+		}
+
+		switch filepath.Base(target) {
+		case name, name + "-shm":
+			return true
+		}
+	}
+	return false
+}
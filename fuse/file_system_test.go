@@ -20,6 +20,7 @@ import (
 	"github.com/superfly/litefs"
 	"github.com/superfly/litefs/fuse"
 	"github.com/superfly/litefs/internal/testingutil"
+	"github.com/superfly/ltx"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -377,6 +378,167 @@ func TestFileSystem_Statfs(t *testing.T) {
 	}
 }
 
+// Ensure database metadata can be read through extended attributes.
+func TestFileSystem_Xattr(t *testing.T) {
+	fs := newFileSystem(t, t.TempDir(), litefs.NewStaticLeaser(true, "localhost", "http://localhost:20202"))
+	fs.Hostname = "node0"
+	if err := fs.Mount(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := fs.Unmount(); err != nil {
+			t.Errorf("server close failed: %s", err)
+		}
+	})
+
+	dsn := filepath.Join(fs.Path(), "db")
+	db := testingutil.OpenSQLDB(t, dsn)
+	if _, err := db.Exec(`CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	}
+
+	getxattr := func(path, name string) string {
+		t.Helper()
+		buf := make([]byte, 256)
+		n, err := syscall.Getxattr(path, name, buf)
+		if err != nil {
+			t.Fatalf("getxattr(%s, %s): %s", path, name, err)
+		}
+		return string(buf[:n])
+	}
+
+	pos, pageSize := fs.Store().DB("db").Pos(), fs.Store().DB("db").PageSize()
+	if got, want := getxattr(dsn, fuse.XattrTXID), ltx.FormatTXID(pos.TXID); got != want {
+		t.Fatalf("txid=%q, want %q", got, want)
+	} else if got, want := getxattr(dsn, fuse.XattrChecksum), fmt.Sprintf("%016x", pos.PostApplyChecksum); got != want {
+		t.Fatalf("checksum=%q, want %q", got, want)
+	} else if got, want := getxattr(dsn, fuse.XattrPrimary), "node0"; got != want {
+		t.Fatalf("primary=%q, want %q", got, want)
+	} else if got, want := getxattr(dsn, fuse.XattrPageSize), fmt.Sprint(pageSize); got != want {
+		t.Fatalf("page_size=%q, want %q", got, want)
+	} else if got, want := getxattr(fs.Path(), fuse.XattrPrimary), "node0"; got != want {
+		t.Fatalf("root primary=%q, want %q", got, want)
+	}
+
+	// Unknown attributes & attributes on other files should not exist.
+	if _, err := syscall.Getxattr(dsn, "user.litefs.unknown", make([]byte, 256)); err != syscall.ENODATA {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := syscall.Getxattr(dsn+"-pos", fuse.XattrTXID, make([]byte, 256)); err != syscall.ENODATA {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	buf := make([]byte, 1024)
+	n, err := syscall.Listxattr(dsn, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := strings.Split(strings.TrimSuffix(string(buf[:n]), "\x00"), "\x00")
+	if got, want := names, []string{fuse.XattrTXID, fuse.XattrChecksum, fuse.XattrPrimary, fuse.XattrMode, fuse.XattrPageSize}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("names=%q, want %q", got, want)
+	}
+}
+
+// Ensure historical versions of a database can be queried read-only.
+func TestFileSystem_Historical(t *testing.T) {
+	fs := newOpenFileSystem(t, t.TempDir(), litefs.NewStaticLeaser(true, "localhost", "http://localhost:20202"))
+	dsn := filepath.Join(fs.Path(), "db")
+	db := testingutil.OpenSQLDB(t, dsn)
+	if _, err := db.Exec(`CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.Exec(`INSERT INTO t VALUES (100)`); err != nil {
+		t.Fatal(err)
+	}
+	txID := fs.Store().DB("db").TXID()
+
+	if _, err := db.Exec(`UPDATE t SET x = 200`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Historical views should not be listed in the mount.
+	ents, err := os.ReadDir(fs.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ent := range ents {
+		if strings.Contains(ent.Name(), "@") {
+			t.Fatalf("unexpected entry: %s", ent.Name())
+		}
+	}
+
+	query := func(path string) (x int) {
+		t.Helper()
+		hdb, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = hdb.Close() }()
+
+		if err := hdb.QueryRow(`SELECT x FROM t`).Scan(&x); err != nil {
+			t.Fatal(err)
+		}
+		return x
+	}
+
+	if got, want := query(dsn+"@txid="+ltx.FormatTXID(txID)), 100; got != want {
+		t.Fatalf("x=%d, want %d", got, want)
+	} else if got, want := query(dsn+"@time="+time.Now().UTC().Format(time.RFC3339Nano)), 200; got != want {
+		t.Fatalf("x=%d, want %d", got, want)
+	}
+
+	// Views should not be writable & unknown transactions should not exist.
+	if _, err := os.OpenFile(dsn+"@txid="+ltx.FormatTXID(txID), os.O_RDWR, 0666); !errors.Is(err, syscall.EROFS) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := os.Stat(dsn + "@txid=" + ltx.FormatTXID(txID+100)); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := os.Stat(dsn + "@time=2000-01-01T00:00:00Z"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Names with "@" are reserved for historical views & other suffixes are
+	// not treated as views.
+	if _, err := os.Create(filepath.Join(fs.Path(), "a@b")); !errors.Is(err, syscall.EINVAL) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := os.Stat(dsn + "@txid=foo"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure locks held by exited processes are released.
+func TestFileSystem_ReleaseStaleLocks(t *testing.T) {
+	fs := newOpenFileSystem(t, t.TempDir(), litefs.NewStaticLeaser(true, "localhost", "http://localhost:20202"))
+	sqldb := testingutil.OpenSQLDB(t, filepath.Join(fs.Path(), "db"))
+	if _, err := sqldb.Exec(`CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Obtain the PID of a process that has already exited.
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	deadPID := cmd.Process.Pid
+
+	// This test process has the database open so its locks are not stale.
+	db := fs.Store().DB("db")
+	db.CreateGuardSetIfNotExists(1000).SetPID(os.Getpid())
+	if !db.TryRLocks(context.Background(), 1000, []litefs.LockType{litefs.LockTypeShared}) {
+		t.Fatal("expected lock")
+	}
+	db.CreateGuardSetIfNotExists(1001).SetPID(deadPID)
+	if !db.TryRLocks(context.Background(), 1001, []litefs.LockType{litefs.LockTypeShared}) {
+		t.Fatal("expected lock")
+	}
+
+	if got, want := fs.ReleaseStaleLocks(context.Background()), 1; got != want {
+		t.Fatalf("n=%d, want %d", got, want)
+	} else if db.GuardSet(1001) != nil {
+		t.Fatal("expected stale owner to be released")
+	} else if db.GuardSet(1000) == nil {
+		t.Fatal("expected active owner to remain")
+	}
+	db.Unlock(context.Background(), 1000, []litefs.LockType{litefs.LockTypeShared})
+}
+
 func TestFileSystem_Pos(t *testing.T) {
 	t.Run("ReopenHandle", func(t *testing.T) {
 		fs := newOpenFileSystem(t, t.TempDir(), litefs.NewStaticLeaser(true, "localhost", "http://localhost:20202"))
@@ -462,6 +624,92 @@ func TestFileSystem_Pos(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("Poll", func(t *testing.T) {
+		fs := newOpenFileSystem(t, t.TempDir(), litefs.NewStaticLeaser(true, "localhost", "http://localhost:20202"))
+		dsn := filepath.Join(fs.Path(), "db")
+		db := testingutil.OpenSQLDB(t, dsn)
+		if _, err := db.Exec(`CREATE TABLE t (x)`); err != nil {
+			t.Fatal(err)
+		}
+
+		// Open a raw descriptor so the Go runtime does not manage polling.
+		fd, err := syscall.Open(dsn+"-pos", syscall.O_RDONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = syscall.Close(fd) }()
+
+		// Reading the current position resets readiness.
+		if _, err := syscall.Pread(fd, make([]byte, fuse.PosFileSize), 0); err != nil {
+			t.Fatal(err)
+		} else if n := selectReadable(t, fd, 100*time.Millisecond); n != 0 {
+			t.Fatalf("expected no readable descriptors, got %d", n)
+		}
+
+		// Writing a transaction should wake up the poller.
+		errCh := make(chan error)
+		go func() {
+			_, err := db.Exec(`INSERT INTO t VALUES (100)`)
+			errCh <- err
+		}()
+		if n := selectReadable(t, fd, 5*time.Second); n != 1 {
+			t.Fatalf("expected readable descriptor, got %d", n)
+		} else if err := <-errCh; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("WaitForTXID", func(t *testing.T) {
+		fs := newOpenFileSystem(t, t.TempDir(), litefs.NewStaticLeaser(true, "localhost", "http://localhost:20202"))
+		fs.PosWaitTimeout = 100 * time.Millisecond
+		dsn := filepath.Join(fs.Path(), "db")
+		db := testingutil.OpenSQLDB(t, dsn)
+		if _, err := db.Exec(`CREATE TABLE t (x)`); err != nil {
+			t.Fatal(err)
+		}
+		txID := fs.Store().DB("db").Pos().TXID
+
+		// Writing the current position returns immediately.
+		if err := os.WriteFile(dsn+"-pos", []byte(ltx.FormatTXID(txID)+"\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		// Writing a future position times out.
+		if err := os.WriteFile(dsn+"-pos", []byte(ltx.FormatTXID(txID+1)), 0666); !errors.Is(err, syscall.ETIMEDOUT) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Writing a future position blocks until it is reached.
+		fs.PosWaitTimeout = 5 * time.Second
+		errCh := make(chan error)
+		go func() { errCh <- os.WriteFile(dsn+"-pos", []byte(ltx.FormatTXID(txID+1)), 0666) }()
+		if _, err := db.Exec(`INSERT INTO t VALUES (100)`); err != nil {
+			t.Fatal(err)
+		} else if err := <-errCh; err != nil {
+			t.Fatal(err)
+		}
+
+		// Invalid positions are rejected.
+		if err := os.WriteFile(dsn+"-pos", []byte("foo"), 0666); !errors.Is(err, syscall.EINVAL) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// selectReadable waits for fd to become readable. Returns the number of
+// readable descriptors.
+func selectReadable(tb testing.TB, fd int, timeout time.Duration) int {
+	tb.Helper()
+
+	var set syscall.FdSet
+	set.Bits[fd/64] |= 1 << (uint(fd) % 64)
+	tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+	n, err := syscall.Select(fd+1, &set, nil, nil, &tv)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return n
 }
 
 func TestFileSystem_MultipleTx(t *testing.T) {
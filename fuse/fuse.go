@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"syscall"
 
 	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
 	"github.com/superfly/litefs"
 )
 
@@ -44,10 +46,14 @@ func ParseFilename(name string) (dbName string, fileType litefs.FileType) {
 
 // ToError converts an error to a wrapped error with a FUSE status code.
 func ToError(err error) error {
-	if os.IsNotExist(err) {
+	if os.IsNotExist(err) || err == litefs.ErrTxNotAvailable {
 		return &Error{err: err, errno: fuse.ENOENT}
 	} else if err == litefs.ErrReadOnlyReplica {
 		return &Error{err: err, errno: fuse.Errno(syscall.EACCES)}
+	} else if err == litefs.ErrDatabaseFull || err == litefs.ErrLowDiskSpace {
+		return &Error{err: err, errno: fuse.Errno(syscall.ENOSPC)}
+	} else if err == litefs.ErrDeadlock {
+		return &Error{err: err, errno: fuse.Errno(syscall.EDEADLK)}
 	}
 	return err
 }
@@ -60,3 +66,37 @@ type Error struct {
 
 func (e *Error) Errno() fuse.Errno { return e.errno }
 func (e *Error) Error() string     { return e.err.Error() }
+
+// pollWaiters holds the poll wakeups requested by the kernel for a node.
+//
+// Only the "-pos" & primary files support change notification. Other nodes
+// report themselves as always ready instead of returning ENOSYS because the
+// kernel disables polling for the entire mount after the first ENOSYS.
+type pollWaiters struct {
+	mu      sync.Mutex
+	wakeups map[fuse.PollWakeup]struct{}
+}
+
+// add registers a wakeup to be sent on the next notification. The kernel
+// polls repeatedly with the same wakeup for a handle so each is only kept once.
+func (w *pollWaiters) add(wakeup fuse.PollWakeup) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.wakeups == nil {
+		w.wakeups = make(map[fuse.PollWakeup]struct{})
+	}
+	w.wakeups[wakeup] = struct{}{}
+}
+
+// notify sends all registered wakeups & clears them. Errors are ignored as
+// the handle that requested a wakeup may have already been released.
+func (w *pollWaiters) notify(server *fs.Server) {
+	w.mu.Lock()
+	wakeups := w.wakeups
+	w.wakeups = nil
+	w.mu.Unlock()
+
+	for wakeup := range wakeups {
+		_ = server.NotifyPollWakeup(wakeup)
+	}
+}
@@ -0,0 +1,197 @@
+package fuse
+
+import (
+	"context"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/superfly/litefs"
+	"github.com/superfly/ltx"
+)
+
+var _ fs.Node = (*HistoricalNode)(nil)
+var _ fs.NodeOpener = (*HistoricalNode)(nil)
+var _ fs.NodeForgetter = (*HistoricalNode)(nil)
+var _ fs.NodeListxattrer = (*HistoricalNode)(nil)
+var _ fs.NodeGetxattrer = (*HistoricalNode)(nil)
+var _ fs.NodeSetxattrer = (*HistoricalNode)(nil)
+var _ fs.NodeRemovexattrer = (*HistoricalNode)(nil)
+var _ fs.NodePoller = (*HistoricalNode)(nil)
+
+// HistoricalNode represents a read-only view of a database as of a retained
+// transaction. It is accessed as "NAME@txid=TXID" or "NAME@time=RFC3339" and
+// is not listed in the root directory. Database names cannot contain "@" so
+// these names never refer to a database.
+type HistoricalNode struct {
+	fsys   *FileSystem
+	db     *litefs.DB
+	txID   uint64
+	header ltx.Header
+}
+
+func newHistoricalNode(fsys *FileSystem, db *litefs.DB, txID uint64, header ltx.Header) *HistoricalNode {
+	return &HistoricalNode{
+		fsys:   fsys,
+		db:     db,
+		txID:   txID,
+		header: header,
+	}
+}
+
+// parseHistoricalName splits a historical view's filename into the database
+// name & the "txid=" or "time=" suffix. Returns false if name does not end in
+// a valid "@txid=TXID" or "@time=RFC3339" suffix.
+func parseHistoricalName(name string) (dbName, at string, ok bool) {
+	i := strings.LastIndex(name, "@")
+	if i == -1 {
+		return "", "", false
+	}
+	dbName, at = name[:i], name[i+1:]
+
+	if strings.HasPrefix(at, "txid=") {
+		_, err := ltx.ParseTXID(strings.TrimPrefix(at, "txid="))
+		return dbName, at, err == nil
+	} else if strings.HasPrefix(at, "time=") {
+		_, err := time.Parse(time.RFC3339Nano, strings.TrimPrefix(at, "time="))
+		return dbName, at, err == nil
+	}
+	return "", "", false
+}
+
+// parseHistoricalTXID returns the TXID referenced by the "txid=" or "time="
+// suffix of a historical view's filename.
+func parseHistoricalTXID(db *litefs.DB, at string) (uint64, error) {
+	if strings.HasPrefix(at, "txid=") {
+		return ltx.ParseTXID(strings.TrimPrefix(at, "txid="))
+	} else if strings.HasPrefix(at, "time=") {
+		t, err := time.Parse(time.RFC3339Nano, strings.TrimPrefix(at, "time="))
+		if err != nil {
+			return 0, err
+		}
+		return db.TXIDAt(t)
+	}
+	return 0, litefs.ErrTxNotAvailable
+}
+
+func (n *HistoricalNode) Attr(ctx context.Context, attr *fuse.Attr) error {
+	attr.Mode = 0444
+	attr.Size = uint64(n.header.Commit) * uint64(n.header.PageSize)
+	attr.Uid = uint32(n.fsys.Uid)
+	attr.Gid = uint32(n.fsys.Gid)
+	return nil
+}
+
+// Open opens a view of the database as of the node's transaction. Views are
+// shared between handles and pages are read on demand.
+func (n *HistoricalNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if !req.Flags.IsReadOnly() {
+		return nil, fuse.Errno(syscall.EROFS)
+	}
+	resp.Flags |= fuse.OpenKeepCache
+
+	view, err := n.db.OpenHistoricalView(ctx, n.txID)
+	if err != nil {
+		log.Printf("fuse: open(): cannot open %s@%s: %s", n.db.Name(), ltx.FormatTXID(n.txID), err)
+		return nil, ToError(err)
+	}
+	return &HistoricalHandle{node: n, view: view}, nil
+}
+
+func (n *HistoricalNode) Forget() { n.fsys.root.ForgetNode(n) }
+
+func (n *HistoricalNode) xattrs() []xattr {
+	return []xattr{
+		{name: XattrTXID, value: ltx.FormatTXID(n.txID)},
+		{name: XattrPageSize, value: strconv.FormatUint(uint64(n.header.PageSize), 10)},
+	}
+}
+
+func (n *HistoricalNode) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	listxattr(n.xattrs(), resp)
+	return nil
+}
+
+func (n *HistoricalNode) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	return getxattr(n.xattrs(), req, resp)
+}
+
+func (n *HistoricalNode) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
+	return fuse.ToErrno(syscall.ENOSYS)
+}
+
+func (n *HistoricalNode) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) error {
+	return fuse.ToErrno(syscall.ENOSYS)
+}
+
+func (n *HistoricalNode) Poll(ctx context.Context, req *fuse.PollRequest, resp *fuse.PollResponse) error {
+	resp.REvents = fuse.DefaultPollMask
+	return nil
+}
+
+var _ fs.Handle = (*HistoricalHandle)(nil)
+var _ fs.HandleReader = (*HistoricalHandle)(nil)
+var _ fs.HandleReleaser = (*HistoricalHandle)(nil)
+var _ fs.HandlePOSIXLocker = (*HistoricalHandle)(nil)
+
+// HistoricalHandle represents a file handle to a historical database view.
+type HistoricalHandle struct {
+	node *HistoricalNode
+	view *litefs.HistoricalView
+}
+
+func (h *HistoricalHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	n, err := h.view.ReadAt(ctx, resp.Data[:req.Size], req.Offset)
+	if err == io.EOF {
+		err = nil
+	} else if err != nil {
+		log.Printf("fuse: read(): cannot read %s@%s: %s", h.node.db.Name(), ltx.FormatTXID(h.node.txID), err)
+		return ToError(err)
+	}
+	resp.Data = resp.Data[:n]
+
+	// Report rollback journal mode so SQLite does not look for a WAL.
+	for i := int64(18); i <= 19; i++ {
+		if off := i - req.Offset; off >= 0 && off < int64(n) {
+			resp.Data[off] = 1
+		}
+	}
+	return nil
+}
+
+func (h *HistoricalHandle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	return nil
+}
+
+func (h *HistoricalHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	return h.view.Close()
+}
+
+// Lock grants read locks as the view never changes. Write locks are refused
+// so that SQLite reports the database as busy instead of attempting a write.
+func (h *HistoricalHandle) Lock(ctx context.Context, req *fuse.LockRequest) error {
+	if req.Lock.Type == fuse.LockWrite {
+		return syscall.EAGAIN
+	}
+	return nil
+}
+
+func (h *HistoricalHandle) LockWait(ctx context.Context, req *fuse.LockWaitRequest) error {
+	if req.Lock.Type == fuse.LockWrite {
+		return fuse.Errno(syscall.EROFS)
+	}
+	return nil
+}
+
+func (h *HistoricalHandle) Unlock(ctx context.Context, req *fuse.UnlockRequest) error {
+	return nil
+}
+
+func (h *HistoricalHandle) QueryLock(ctx context.Context, req *fuse.QueryLockRequest, resp *fuse.QueryLockResponse) error {
+	return nil
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
 	"syscall"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 	"github.com/superfly/litefs"
+	"github.com/superfly/ltx"
 )
 
 // PosFileSize is the size, in bytes, of the "-pos" file.
@@ -24,9 +27,11 @@ var _ fs.NodeRemovexattrer = (*PosNode)(nil)
 var _ fs.NodePoller = (*PosNode)(nil)
 
 // PosNode represents a file that returns the current position of the database.
+// Writing a TXID to the file blocks until the database reaches that position.
 type PosNode struct {
-	fsys *FileSystem
-	db   *litefs.DB
+	fsys    *FileSystem
+	db      *litefs.DB
+	waiters pollWaiters
 }
 
 func newPosNode(fsys *FileSystem, db *litefs.DB) *PosNode {
@@ -43,11 +48,63 @@ func (n *PosNode) Attr(ctx context.Context, attr *fuse.Attr) error {
 }
 
 func (n *PosNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
-	return n, nil
+	return newPosHandle(n), nil
 }
 
-func (n *PosNode) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
-	pos := n.db.Pos()
+func (n *PosNode) Forget() { n.fsys.root.ForgetNode(n) }
+
+// Setxattr & Removexattr return ENOSYS so the kernel stops sending those
+// requests. Getxattr returns ENODATA for unknown attributes instead so that
+// extended attributes are not disabled for the whole mount. See getxattr().
+// Source: https://github.com/libfuse/libfuse/blob/0b6d97cf5938f6b4885e487c3bd7b02144b1ea56/include/fuse_lowlevel.h#L811
+
+func (n *PosNode) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	return nil
+}
+
+func (n *PosNode) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	return getxattr(nil, req, resp)
+}
+
+func (n *PosNode) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
+	return fuse.ToErrno(syscall.ENOSYS)
+}
+
+func (n *PosNode) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) error {
+	return fuse.ToErrno(syscall.ENOSYS)
+}
+
+// Poll reports the file as always ready. Handles report readiness based on
+// position changes. See PosHandle.Poll().
+func (n *PosNode) Poll(ctx context.Context, req *fuse.PollRequest, resp *fuse.PollResponse) error {
+	resp.REvents = fuse.DefaultPollMask
+	return nil
+}
+
+var _ fs.Handle = (*PosHandle)(nil)
+var _ fs.HandleReader = (*PosHandle)(nil)
+var _ fs.HandleWriter = (*PosHandle)(nil)
+var _ fs.HandlePoller = (*PosHandle)(nil)
+
+// PosHandle represents a file handle to a "-pos" file. It tracks the last
+// position read so that poll() can report when the position has changed.
+type PosHandle struct {
+	node *PosNode
+
+	mu  sync.Mutex
+	pos litefs.Pos // position last returned by Read()
+}
+
+func newPosHandle(node *PosNode) *PosHandle {
+	return &PosHandle{node: node}
+}
+
+func (h *PosHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	pos := h.node.db.Pos()
+
+	h.mu.Lock()
+	h.pos = pos
+	h.mu.Unlock()
 
 	data := fmt.Sprintf("%016x/%016x\n", pos.TXID, pos.PostApplyChecksum)
 	if req.Offset >= int64(len(data)) {
@@ -64,28 +121,44 @@ func (n *PosNode) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.Re
 	return nil
 }
 
-func (n *PosNode) Forget() { n.fsys.root.ForgetNode(n) }
+// Write blocks until the database reaches the TXID written to the file. The
+// data uses the same format as Read, although the checksum is optional.
+// Returns ETIMEDOUT if the position is not reached within the wait timeout.
+func (h *PosHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	s, _, _ := strings.Cut(strings.TrimSpace(string(req.Data)), "/")
+	txID, err := ltx.ParseTXID(s)
+	if err != nil {
+		return fuse.Errno(syscall.EINVAL)
+	}
 
-// ENOSYS is a special return code for xattr requests that will be treated as a permanent failure for any such
-// requests in the future without being sent to the filesystem.
-// Source: https://github.com/libfuse/libfuse/blob/0b6d97cf5938f6b4885e487c3bd7b02144b1ea56/include/fuse_lowlevel.h#L811
+	ctx, cancel := context.WithTimeout(ctx, h.node.fsys.PosWaitTimeout)
+	defer cancel()
 
-func (n *PosNode) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
-	return fuse.ToErrno(syscall.ENOSYS)
-}
+	if err := h.node.fsys.store.WaitForTXID(ctx, h.node.db.Name(), txID); err == context.DeadlineExceeded {
+		return fuse.Errno(syscall.ETIMEDOUT)
+	} else if err != nil {
+		return fuse.Errno(syscall.EINTR)
+	}
 
-func (n *PosNode) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
-	return fuse.ToErrno(syscall.ENOSYS)
+	resp.Size = len(req.Data)
+	return nil
 }
 
-func (n *PosNode) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
-	return fuse.ToErrno(syscall.ENOSYS)
-}
+// Poll reports the handle as readable once the position has changed since it
+// was last read. Otherwise the kernel is woken up on the next change.
+func (h *PosHandle) Poll(ctx context.Context, req *fuse.PollRequest, resp *fuse.PollResponse) error {
+	// Register before checking the position so a change cannot be missed.
+	if wakeup, ok := req.Wakeup(); ok {
+		h.node.waiters.add(wakeup)
+	}
 
-func (n *PosNode) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) error {
-	return fuse.ToErrno(syscall.ENOSYS)
-}
+	// Writes are always accepted, although they may block.
+	resp.REvents = fuse.PollOut | fuse.PollWriteNormal
 
-func (n *PosNode) Poll(ctx context.Context, req *fuse.PollRequest, resp *fuse.PollResponse) error {
-	return fuse.Errno(syscall.ENOSYS)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.node.db.Pos() != h.pos {
+		resp.REvents |= fuse.PollIn | fuse.PollReadNormal
+	}
+	return nil
 }
@@ -2,6 +2,7 @@ package fuse
 
 import (
 	"context"
+	"sync"
 	"syscall"
 
 	"bazil.org/fuse"
@@ -12,6 +13,7 @@ import (
 const PrimaryFilename = ".primary"
 
 var _ fs.Node = (*PrimaryNode)(nil)
+var _ fs.NodeOpener = (*PrimaryNode)(nil)
 var _ fs.NodeForgetter = (*PrimaryNode)(nil)
 var _ fs.NodeListxattrer = (*PrimaryNode)(nil)
 var _ fs.NodeGetxattrer = (*PrimaryNode)(nil)
@@ -21,7 +23,8 @@ var _ fs.NodePoller = (*PrimaryNode)(nil)
 
 // PrimaryNode represents a file for returning the current primary node.
 type PrimaryNode struct {
-	fsys *FileSystem
+	fsys    *FileSystem
+	waiters pollWaiters
 }
 
 func newPrimaryNode(fsys *FileSystem) *PrimaryNode {
@@ -42,26 +45,23 @@ func (n *PrimaryNode) Attr(ctx context.Context, attr *fuse.Attr) error {
 	return nil
 }
 
-func (n *PrimaryNode) ReadAll(ctx context.Context) ([]byte, error) {
-	info := n.fsys.store.PrimaryInfo()
-	if info == nil {
-		return nil, fuse.Errno(syscall.ENOENT)
-	}
-	return []byte(info.Hostname + "\n"), nil
+func (n *PrimaryNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	return newPrimaryHandle(n), nil
 }
 
 func (n *PrimaryNode) Forget() { n.fsys.root.ForgetNode(n) }
 
-// ENOSYS is a special return code for xattr requests that will be treated as a permanent failure for any such
-// requests in the future without being sent to the filesystem.
+// Setxattr & Removexattr return ENOSYS so the kernel stops sending those
+// requests. Getxattr returns ENODATA for unknown attributes instead so that
+// extended attributes are not disabled for the whole mount. See getxattr().
 // Source: https://github.com/libfuse/libfuse/blob/0b6d97cf5938f6b4885e487c3bd7b02144b1ea56/include/fuse_lowlevel.h#L811
 
 func (n *PrimaryNode) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
-	return fuse.ToErrno(syscall.ENOSYS)
+	return nil
 }
 
 func (n *PrimaryNode) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
-	return fuse.ToErrno(syscall.ENOSYS)
+	return getxattr(nil, req, resp)
 }
 
 func (n *PrimaryNode) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
@@ -73,5 +73,58 @@ func (n *PrimaryNode) Removexattr(ctx context.Context, req *fuse.RemovexattrRequ
 }
 
 func (n *PrimaryNode) Poll(ctx context.Context, req *fuse.PollRequest, resp *fuse.PollResponse) error {
-	return fuse.Errno(syscall.ENOSYS)
+	resp.REvents = fuse.DefaultPollMask
+	return nil
+}
+
+var _ fs.Handle = (*PrimaryHandle)(nil)
+var _ fs.HandleReadAller = (*PrimaryHandle)(nil)
+var _ fs.HandlePoller = (*PrimaryHandle)(nil)
+
+// PrimaryHandle represents a file handle to the primary file. It tracks the
+// last hostname read so that poll() can report when the primary has changed.
+type PrimaryHandle struct {
+	node *PrimaryNode
+
+	mu       sync.Mutex
+	hostname string // hostname last returned by ReadAll()
+}
+
+func newPrimaryHandle(node *PrimaryNode) *PrimaryHandle {
+	return &PrimaryHandle{node: node}
+}
+
+func (h *PrimaryHandle) ReadAll(ctx context.Context) ([]byte, error) {
+	info := h.node.fsys.store.PrimaryInfo()
+	if info == nil {
+		return nil, fuse.Errno(syscall.ENOENT)
+	}
+
+	h.mu.Lock()
+	h.hostname = info.Hostname
+	h.mu.Unlock()
+
+	return []byte(info.Hostname + "\n"), nil
+}
+
+// Poll reports the handle as readable once the primary has changed since it
+// was last read. This includes the primary going away or this node becoming
+// the primary, in which case reads will fail with ENOENT.
+func (h *PrimaryHandle) Poll(ctx context.Context, req *fuse.PollRequest, resp *fuse.PollResponse) error {
+	// Register before checking the primary so a change cannot be missed.
+	if wakeup, ok := req.Wakeup(); ok {
+		h.node.waiters.add(wakeup)
+	}
+
+	var hostname string
+	if info := h.node.fsys.store.PrimaryInfo(); info != nil {
+		hostname = info.Hostname
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hostname != h.hostname {
+		resp.REvents = fuse.PollIn | fuse.PollReadNormal
+	}
+	return nil
 }
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"sort"
+	"strings"
 	"sync"
 	"syscall"
 
@@ -81,7 +82,11 @@ func (n *RootNode) Lookup(ctx context.Context, name string) (node fs.Node, err e
 			return nil, err
 		}
 	default:
-		if node, err = n.lookupDBNode(ctx, name); err != nil {
+		if dbName, at, ok := parseHistoricalName(name); ok {
+			if node, err = n.lookupHistoricalNode(ctx, dbName, at); err != nil {
+				return nil, err
+			}
+		} else if node, err = n.lookupDBNode(ctx, name); err != nil {
 			return nil, err
 		}
 	}
@@ -100,6 +105,24 @@ func (n *RootNode) lookupPrimaryNode(ctx context.Context) (fs.Node, error) {
 	return newPrimaryNode(n.fsys), nil
 }
 
+func (n *RootNode) lookupHistoricalNode(ctx context.Context, dbName, at string) (fs.Node, error) {
+	db := n.fsys.store.DB(dbName)
+	if db == nil {
+		return nil, fuse.ToErrno(syscall.ENOENT)
+	}
+
+	txID, err := parseHistoricalTXID(db, at)
+	if err != nil {
+		return nil, fuse.ToErrno(syscall.ENOENT)
+	}
+
+	header, err := db.HistoricalHeader(txID)
+	if err != nil {
+		return nil, ToError(err)
+	}
+	return newHistoricalNode(n.fsys, db, txID, header), nil
+}
+
 func (n *RootNode) lookupDBNode(ctx context.Context, name string) (fs.Node, error) {
 	dbName, fileType := ParseFilename(name)
 
@@ -180,6 +203,12 @@ func (n *RootNode) Create(ctx context.Context, req *fuse.CreateRequest, resp *fu
 }
 
 func (n *RootNode) createDatabase(ctx context.Context, dbName string, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	// Names with "@" are reserved for historical views.
+	if strings.Contains(dbName, "@") {
+		log.Printf("fuse: create(): invalid database name: %q", dbName)
+		return nil, nil, fuse.Errno(syscall.EINVAL)
+	}
+
 	db, file, err := n.fsys.store.CreateDB(dbName)
 	if err == litefs.ErrDatabaseExists {
 		return nil, nil, fuse.Errno(syscall.EEXIST)
@@ -293,16 +322,18 @@ func (n *RootNode) ForgetNode(node fs.Node) {
 	}
 }
 
-// ENOSYS is a special return code for xattr requests that will be treated as a permanent failure for any such
-// requests in the future without being sent to the filesystem.
+// Setxattr & Removexattr return ENOSYS so the kernel stops sending those
+// requests. Getxattr returns ENODATA for unknown attributes instead so that
+// extended attributes are not disabled for the whole mount. See getxattr().
 // Source: https://github.com/libfuse/libfuse/blob/0b6d97cf5938f6b4885e487c3bd7b02144b1ea56/include/fuse_lowlevel.h#L811
 
 func (n *RootNode) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
-	return fuse.ToErrno(syscall.ENOSYS)
+	listxattr(n.fsys.rootXattrs(), resp)
+	return nil
 }
 
 func (n *RootNode) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
-	return fuse.ToErrno(syscall.ENOSYS)
+	return getxattr(n.fsys.rootXattrs(), req, resp)
 }
 
 func (n *RootNode) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
@@ -314,7 +345,8 @@ func (n *RootNode) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest
 }
 
 func (n *RootNode) Poll(ctx context.Context, req *fuse.PollRequest, resp *fuse.PollResponse) error {
-	return fuse.Errno(syscall.ENOSYS)
+	resp.REvents = fuse.DefaultPollMask
+	return nil
 }
 
 var _ fs.Handle = (*RootHandle)(nil)
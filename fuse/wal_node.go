@@ -76,16 +76,17 @@ func (n *WALNode) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
 
 func (n *WALNode) Forget() { n.fsys.root.ForgetNode(n) }
 
-// ENOSYS is a special return code for xattr requests that will be treated as a permanent failure for any such
-// requests in the future without being sent to the filesystem.
+// Setxattr & Removexattr return ENOSYS so the kernel stops sending those
+// requests. Getxattr returns ENODATA for unknown attributes instead so that
+// extended attributes are not disabled for the whole mount. See getxattr().
 // Source: https://github.com/libfuse/libfuse/blob/0b6d97cf5938f6b4885e487c3bd7b02144b1ea56/include/fuse_lowlevel.h#L811
 
 func (n *WALNode) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
-	return fuse.ToErrno(syscall.ENOSYS)
+	return nil
 }
 
 func (n *WALNode) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
-	return fuse.ToErrno(syscall.ENOSYS)
+	return getxattr(nil, req, resp)
 }
 
 func (n *WALNode) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
@@ -97,7 +98,8 @@ func (n *WALNode) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest)
 }
 
 func (n *WALNode) Poll(ctx context.Context, req *fuse.PollRequest, resp *fuse.PollResponse) error {
-	return fuse.Errno(syscall.ENOSYS)
+	resp.REvents = fuse.DefaultPollMask
+	return nil
 }
 
 var _ fs.Handle = (*WALHandle)(nil)
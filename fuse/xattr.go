@@ -0,0 +1,91 @@
+package fuse
+
+import (
+	"fmt"
+	"strconv"
+	"syscall"
+
+	"bazil.org/fuse"
+	"github.com/superfly/litefs"
+	"github.com/superfly/ltx"
+)
+
+// Read-only extended attributes exposed on database files & the root directory.
+const (
+	XattrTXID     = "user.litefs.txid"
+	XattrChecksum = "user.litefs.checksum"
+	XattrPrimary  = "user.litefs.primary"
+	XattrMode     = "user.litefs.mode"
+	XattrPageSize = "user.litefs.page_size"
+)
+
+// xattr represents a single extended attribute name & value.
+type xattr struct {
+	name  string
+	value string
+}
+
+// getxattr writes the value of the requested attribute to resp. Returns
+// ENODATA if the attribute does not exist.
+//
+// Nodes without attributes must still return ENODATA instead of ENOSYS as
+// the kernel disables extended attributes for the entire mount after the
+// first ENOSYS.
+func getxattr(attrs []xattr, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	for _, attr := range attrs {
+		if attr.name == req.Name {
+			resp.Xattr = []byte(attr.value)
+			return nil
+		}
+	}
+	return fuse.Errno(syscall.ENODATA)
+}
+
+// listxattr appends the names of attrs to resp.
+func listxattr(attrs []xattr, resp *fuse.ListxattrResponse) {
+	for _, attr := range attrs {
+		resp.Append(attr.name)
+	}
+}
+
+// dbXattrs returns the extended attributes for a database file.
+func (fsys *FileSystem) dbXattrs(db *litefs.DB) []xattr {
+	pos := db.Pos()
+	attrs := []xattr{
+		{name: XattrTXID, value: ltx.FormatTXID(pos.TXID)},
+		{name: XattrChecksum, value: fmt.Sprintf("%016x", pos.PostApplyChecksum)},
+	}
+	if primary := fsys.primaryHostname(); primary != "" {
+		attrs = append(attrs, xattr{name: XattrPrimary, value: primary})
+	}
+
+	mode := "rollback"
+	if db.Mode() == litefs.DBModeWAL {
+		mode = "wal"
+	}
+	attrs = append(attrs, xattr{name: XattrMode, value: mode})
+
+	if pageSize := db.PageSize(); pageSize != 0 {
+		attrs = append(attrs, xattr{name: XattrPageSize, value: strconv.FormatUint(uint64(pageSize), 10)})
+	}
+	return attrs
+}
+
+// rootXattrs returns the extended attributes for the root directory.
+func (fsys *FileSystem) rootXattrs() []xattr {
+	if primary := fsys.primaryHostname(); primary != "" {
+		return []xattr{{name: XattrPrimary, value: primary}}
+	}
+	return nil
+}
+
+// primaryHostname returns the hostname of the current primary. Returns a
+// blank string if there is no known primary.
+func (fsys *FileSystem) primaryHostname() string {
+	if fsys.store.IsPrimary() {
+		return fsys.Hostname
+	} else if info := fsys.store.PrimaryInfo(); info != nil {
+		return info.Hostname
+	}
+	return ""
+}
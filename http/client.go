@@ -4,13 +4,19 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/superfly/litefs"
+	"github.com/superfly/ltx"
 	"golang.org/x/net/http2"
 )
 
@@ -75,8 +81,406 @@ func (c *Client) Import(ctx context.Context, rawurl, name string, r io.Reader) e
 	return nil
 }
 
+// Handoff asks the remote primary to transfer its lease to the given node.
+// If nodeID is blank, the primary chooses its most caught-up replica. Returns
+// once the primary has released its lease or the timeout has elapsed.
+func (c *Client) Handoff(ctx context.Context, rawurl, nodeID string, timeout time.Duration) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return fmt.Errorf("invalid client URL: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid URL scheme")
+	} else if u.Host == "" {
+		return fmt.Errorf("URL host required")
+	}
+
+	q := url.Values{}
+	if nodeID != "" {
+		q.Set("to", nodeID)
+	}
+	if timeout > 0 {
+		q.Set("timeout", timeout.String())
+	}
+
+	// Strip off everything but the scheme/host & add target to query params.
+	*u = url.URL{
+		Scheme:   u.Scheme,
+		Host:     u.Host,
+		Path:     "/handoff",
+		RawQuery: q.Encode(),
+	}
+
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("invalid response: code=%d msg=%q", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Exec executes statements in a single transaction on the primary. The
+// request may be sent to any node as replicas forward it to the primary.
+// The returned TXID can be used to wait for the write to replicate locally.
+func (c *Client) Exec(ctx context.Context, rawurl, name string, stmts []Statement) (*ExecResponse, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client URL: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid URL scheme")
+	} else if u.Host == "" {
+		return nil, fmt.Errorf("URL host required")
+	}
+
+	// Strip off everything but the scheme/host & add database to the path.
+	*u = url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   path.Join("/db", name, "exec"),
+	}
+
+	body, err := json.Marshal(&ExecRequest{Statements: stmts})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("invalid response: code=%d msg=%q", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var other ExecResponse
+	if err := json.NewDecoder(resp.Body).Decode(&other); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &other, nil
+}
+
+// Wait blocks until the database on the remote node reaches txID or the
+// timeout elapses. Returns the database's position once it has caught up.
+func (c *Client) Wait(ctx context.Context, rawurl, name string, txID uint64, timeout time.Duration) (*DBStatus, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client URL: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid URL scheme")
+	} else if u.Host == "" {
+		return nil, fmt.Errorf("URL host required")
+	}
+
+	q := url.Values{"txid": {ltx.FormatTXID(txID)}}
+	if timeout > 0 {
+		q.Set("timeout", timeout.String())
+	}
+
+	// Strip off everything but the scheme/host & add database to the path.
+	*u = url.URL{
+		Scheme:   u.Scheme,
+		Host:     u.Host,
+		Path:     path.Join("/db", name, "wait"),
+		RawQuery: q.Encode(),
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("invalid response: code=%d msg=%q", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var status DBStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("decode status: %w", err)
+	}
+	return &status, nil
+}
+
+// Clone creates a new database, to, on the primary as a copy of the named
+// database. The copy is made at txID if non-zero, otherwise at the current
+// position. Returns the position of the new database.
+func (c *Client) Clone(ctx context.Context, rawurl, name, to string, txID uint64) (*DBStatus, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client URL: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid URL scheme")
+	} else if u.Host == "" {
+		return nil, fmt.Errorf("URL host required")
+	}
+
+	q := url.Values{"to": {to}}
+	if txID != 0 {
+		q.Set("txid", ltx.FormatTXID(txID))
+	}
+
+	// Strip off everything but the scheme/host & add database to the path.
+	*u = url.URL{
+		Scheme:   u.Scheme,
+		Host:     u.Host,
+		Path:     path.Join("/db", name, "clone"),
+		RawQuery: q.Encode(),
+	}
+
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("invalid response: code=%d msg=%q", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var status DBStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("decode status: %w", err)
+	}
+	return &status, nil
+}
+
+// Locks returns the locks currently held on a database on the remote node.
+func (c *Client) Locks(ctx context.Context, rawurl, name string) ([]*LockStatus, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client URL: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid URL scheme")
+	} else if u.Host == "" {
+		return nil, fmt.Errorf("URL host required")
+	}
+
+	// Strip off everything but the scheme/host & add database to the path.
+	*u = url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   path.Join("/db", name, "locks"),
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("invalid response: code=%d msg=%q", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var locks []*LockStatus
+	if err := json.NewDecoder(resp.Body).Decode(&locks); err != nil {
+		return nil, fmt.Errorf("decode locks: %w", err)
+	}
+	return locks, nil
+}
+
+// ReleaseLocks forcibly releases all locks held by owner on a database on the
+// remote node.
+func (c *Client) ReleaseLocks(ctx context.Context, rawurl, name string, owner uint64) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return fmt.Errorf("invalid client URL: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid URL scheme")
+	} else if u.Host == "" {
+		return fmt.Errorf("URL host required")
+	}
+
+	// Strip off everything but the scheme/host & add database to the path.
+	*u = url.URL{
+		Scheme:   u.Scheme,
+		Host:     u.Host,
+		Path:     path.Join("/db", name, "locks"),
+		RawQuery: (url.Values{"owner": {strconv.FormatUint(owner, 10)}}).Encode(),
+	}
+
+	req, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("invalid response: code=%d msg=%q", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Status returns the current state of the remote LiteFS node.
+func (c *Client) Status(ctx context.Context, rawurl string) (*Status, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client URL: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid URL scheme")
+	} else if u.Host == "" {
+		return nil, fmt.Errorf("URL host required")
+	}
+
+	// Strip off everything but the scheme & host.
+	*u = url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   "/status",
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("invalid response: code=%d", resp.StatusCode)
+	}
+
+	var status Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("decode status: %w", err)
+	}
+	return &status, nil
+}
+
+// Export writes a consistent copy of a database on the remote LiteFS server
+// to w as a SQLite file. The checksum of the copy is verified against the
+// server's checksum and the position of the copy is returned.
+func (c *Client) Export(ctx context.Context, rawurl, name string, w io.Writer) (litefs.Pos, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return litefs.Pos{}, fmt.Errorf("invalid client URL: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return litefs.Pos{}, fmt.Errorf("invalid URL scheme")
+	} else if u.Host == "" {
+		return litefs.Pos{}, fmt.Errorf("URL host required")
+	}
+
+	// Strip off everything but the scheme & host.
+	*u = url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   path.Join("/db", name, "snapshot"),
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return litefs.Pos{}, err
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return litefs.Pos{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return litefs.Pos{}, fmt.Errorf("invalid response: code=%d", resp.StatusCode)
+	}
+
+	txID, err := ltx.ParseTXID(resp.Header.Get("Litefs-Txid"))
+	if err != nil {
+		return litefs.Pos{}, fmt.Errorf("invalid txid header: %w", err)
+	}
+	pageSize, err := strconv.ParseUint(resp.Header.Get("Litefs-Page-Size"), 10, 32)
+	if err != nil || !ltx.IsValidPageSize(uint32(pageSize)) {
+		return litefs.Pos{}, fmt.Errorf("invalid page size header: %q", resp.Header.Get("Litefs-Page-Size"))
+	}
+
+	// Copy pages to the writer while computing the checksum. The lock page is
+	// excluded from the checksum, the same as in LTX files.
+	data := make([]byte, pageSize)
+	lockPgno := ltx.LockPgno(uint32(pageSize))
+	var chksum uint64
+	for pgno := uint32(1); ; pgno++ {
+		if _, err := io.ReadFull(resp.Body, data); err == io.EOF {
+			break
+		} else if err != nil {
+			return litefs.Pos{}, fmt.Errorf("read page %d: %w", pgno, err)
+		}
+
+		if pgno != lockPgno {
+			chksum ^= ltx.ChecksumPage(pgno, data)
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return litefs.Pos{}, err
+		}
+	}
+	pos := litefs.Pos{TXID: txID, PostApplyChecksum: ltx.ChecksumFlag | chksum}
+
+	// The checksum trailer is only available once the body has been read.
+	if s := resp.Trailer.Get("Litefs-Checksum"); s == "" {
+		return pos, fmt.Errorf("snapshot incomplete, checksum trailer missing")
+	} else if want, err := strconv.ParseUint(s, 16, 64); err != nil {
+		return pos, fmt.Errorf("invalid checksum trailer: %q", s)
+	} else if pos.PostApplyChecksum != want {
+		return pos, fmt.Errorf("snapshot checksum mismatch: %016x <> %016x", pos.PostApplyChecksum, want)
+	}
+
+	return pos, nil
+}
+
 // Stream returns a snapshot and continuous stream of WAL updates.
-func (c *Client) Stream(ctx context.Context, rawurl string, nodeID string, posMap map[string]litefs.Pos) (io.ReadCloser, error) {
+func (c *Client) Stream(ctx context.Context, rawurl string, nodeID string, candidate bool, posMap map[string]litefs.Pos, rangeMap map[string]*litefs.PageRangeChecksums) (io.ReadCloser, error) {
 	u, err := url.Parse(rawurl)
 	if err != nil {
 		return nil, fmt.Errorf("invalid client URL: %w", err)
@@ -96,6 +500,8 @@ func (c *Client) Stream(ctx context.Context, rawurl string, nodeID string, posMa
 	var buf bytes.Buffer
 	if err := WritePosMapTo(&buf, posMap); err != nil {
 		return nil, fmt.Errorf("cannot write pos map: %w", err)
+	} else if err := WritePageRangeMapTo(&buf, rangeMap); err != nil {
+		return nil, fmt.Errorf("cannot write page range map: %w", err)
 	}
 
 	req, err := http.NewRequest("POST", u.String(), &buf)
@@ -105,6 +511,9 @@ func (c *Client) Stream(ctx context.Context, rawurl string, nodeID string, posMa
 	req = req.WithContext(ctx)
 
 	req.Header.Set("Litefs-Id", nodeID)
+	if candidate {
+		req.Header.Set("Litefs-Candidate", "true")
+	}
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
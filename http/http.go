@@ -6,6 +6,7 @@ import (
 	"io"
 	"math"
 	"sort"
+	"time"
 
 	"github.com/superfly/litefs"
 )
@@ -78,3 +79,201 @@ func WritePosMapTo(w io.Writer, m map[string]litefs.Pos) error {
 
 	return nil
 }
+
+// ReadPageRangeMapFrom reads page range checksums written after the pos map.
+// Returns an empty map if the stream ends immediately as older clients do not
+// send page range checksums.
+func ReadPageRangeMapFrom(r io.Reader) (map[string]*litefs.PageRangeChecksums, error) {
+	// Read entry count.
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err == io.EOF {
+		return map[string]*litefs.PageRangeChecksums{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Read entries and insert into map.
+	m := make(map[string]*litefs.PageRangeChecksums, n)
+	for i := uint32(0); i < n; i++ {
+		var nameN uint32
+		if err := binary.Read(r, binary.BigEndian, &nameN); err != nil {
+			return nil, err
+		}
+		name := make([]byte, nameN)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, err
+		}
+
+		var ranges litefs.PageRangeChecksums
+		var chksumN uint32
+		if err := binary.Read(r, binary.BigEndian, &ranges.PageSize); err != nil {
+			return nil, err
+		} else if err := binary.Read(r, binary.BigEndian, &ranges.PageN); err != nil {
+			return nil, err
+		} else if err := binary.Read(r, binary.BigEndian, &ranges.RangeSize); err != nil {
+			return nil, err
+		} else if err := binary.Read(r, binary.BigEndian, &chksumN); err != nil {
+			return nil, err
+		}
+
+		// Ensure the checksum count is consistent so we don't over-allocate.
+		if ranges.RangeSize == 0 {
+			return nil, fmt.Errorf("invalid page range size: db=%q", name)
+		} else if want := (uint64(ranges.PageN) + uint64(ranges.RangeSize) - 1) / uint64(ranges.RangeSize); uint64(chksumN) != want {
+			return nil, fmt.Errorf("invalid page range count: db=%q n=%d, expected %d", name, chksumN, want)
+		}
+
+		ranges.Checksums = make([]uint64, chksumN)
+		if err := binary.Read(r, binary.BigEndian, ranges.Checksums); err != nil {
+			return nil, err
+		}
+		m[string(name)] = &ranges
+	}
+
+	return m, nil
+}
+
+func WritePageRangeMapTo(w io.Writer, m map[string]*litefs.PageRangeChecksums) error {
+	// Sort keys for consistent output.
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Write entry count.
+	if err := binary.Write(w, binary.BigEndian, uint32(len(m))); err != nil {
+		return err
+	}
+
+	// Write all entries in sorted order.
+	for _, name := range names {
+		ranges := m[name]
+
+		if len(name) > math.MaxUint32 {
+			return fmt.Errorf("database name too long")
+		}
+
+		if err := binary.Write(w, binary.BigEndian, uint32(len(name))); err != nil {
+			return err
+		} else if _, err := w.Write([]byte(name)); err != nil {
+			return err
+		}
+
+		if err := binary.Write(w, binary.BigEndian, ranges.PageSize); err != nil {
+			return err
+		} else if err := binary.Write(w, binary.BigEndian, ranges.PageN); err != nil {
+			return err
+		} else if err := binary.Write(w, binary.BigEndian, ranges.RangeSize); err != nil {
+			return err
+		} else if err := binary.Write(w, binary.BigEndian, uint32(len(ranges.Checksums))); err != nil {
+			return err
+		} else if err := binary.Write(w, binary.BigEndian, ranges.Checksums); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Status represents the state of a LiteFS node as returned by GET /status.
+type Status struct {
+	ID           string       `json:"id"`
+	IsPrimary    bool         `json:"isPrimary"`
+	Candidate    bool         `json:"candidate"`
+	LowDiskSpace bool         `json:"lowDiskSpace"`
+	Primary      *PrimaryInfo `json:"primary,omitempty"`
+	Lease        *LeaseStatus `json:"lease,omitempty"`
+
+	DBs      []*DBStatus      `json:"dbs"`
+	Replicas []*ReplicaStatus `json:"replicas,omitempty"`
+}
+
+// PrimaryInfo represents the current primary node.
+type PrimaryInfo struct {
+	Hostname     string `json:"hostname,omitempty"`
+	AdvertiseURL string `json:"advertiseURL"`
+}
+
+// LeaseStatus represents the lease held by the primary.
+type LeaseStatus struct {
+	TTL       time.Duration `json:"ttl"`
+	RenewedAt time.Time     `json:"renewedAt"`
+}
+
+// DBStatus represents the position of a single database.
+type DBStatus struct {
+	Name     string        `json:"name"`
+	TXID     string        `json:"txid"`
+	Checksum string        `json:"checksum"`
+	Locks    []*LockStatus `json:"locks,omitempty"`
+}
+
+// LockStatus represents a lock held on a database by a single owner as
+// returned by GET /db/{name}/locks.
+type LockStatus struct {
+	Type       string    `json:"type"`
+	State      string    `json:"state"`
+	Owner      uint64    `json:"owner"`
+	PID        int       `json:"pid,omitempty"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+}
+
+// newLockStatuses converts database lock info into its API representation.
+func newLockStatuses(infos []*litefs.LockInfo) []*LockStatus {
+	a := make([]*LockStatus, 0, len(infos))
+	for _, info := range infos {
+		a = append(a, &LockStatus{
+			Type:       info.Type.String(),
+			State:      info.State.String(),
+			Owner:      info.Owner,
+			PID:        info.PID,
+			AcquiredAt: info.AcquiredAt,
+		})
+	}
+	return a
+}
+
+// ReplicaStatus represents a replica connected to the primary's stream.
+type ReplicaStatus struct {
+	ID          string             `json:"id"`
+	Addr        string             `json:"addr"`
+	ConnectedAt time.Time          `json:"connectedAt"`
+	DBs         []*ReplicaDBStatus `json:"dbs"`
+}
+
+// ReplicaDBStatus represents the replication position of a single database
+// on a replica. Positions are those sent by this node. Replicas do not report
+// back what they have applied so a replica may be further behind than shown.
+// SentLag is the number of transactions not yet sent to the replica.
+type ReplicaDBStatus struct {
+	Name     string `json:"name"`
+	SentTXID string `json:"sentTXID"`
+	SentLag  uint64 `json:"sentLag"`
+}
+
+// ExecRequest represents a set of statements that are executed in a single
+// transaction by POST /db/{name}/exec.
+type ExecRequest struct {
+	Statements []Statement `json:"statements"`
+}
+
+// Statement represents a single SQL statement and its bind arguments.
+type Statement struct {
+	SQL  string        `json:"sql"`
+	Args []interface{} `json:"args,omitempty"`
+}
+
+// ExecResponse represents the result of a POST /db/{name}/exec request. The
+// TXID is the position of the database after the transaction committed so
+// callers can wait for it to replicate to their local node.
+type ExecResponse struct {
+	TXID    string        `json:"txid"`
+	Results []*ExecResult `json:"results"`
+}
+
+// ExecResult represents the result of a single executed statement.
+type ExecResult struct {
+	RowsAffected int64 `json:"rowsAffected"`
+	LastInsertID int64 `json:"lastInsertId"`
+}
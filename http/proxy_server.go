@@ -0,0 +1,319 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/superfly/litefs"
+	"github.com/superfly/ltx"
+	"golang.org/x/sync/errgroup"
+)
+
+// Default proxy settings.
+const (
+	DefaultProxyReadTimeout  = 5 * time.Second
+	DefaultProxyCookieExpiry = 5 * time.Minute
+)
+
+// DefaultProxyReadOnlyMethods are the HTTP methods that are served by the
+// local node instead of being forwarded to the primary.
+var DefaultProxyReadOnlyMethods = []string{"GET", "HEAD", "OPTIONS"}
+
+// ProxyTXIDCookieName is the name of the cookie that holds the primary's TXID
+// after a write so that later reads on replicas can wait to catch up.
+const ProxyTXIDCookieName = "__txid"
+
+// ProxyServer represents an HTTP reverse proxy in front of an application.
+// Reads are served by the local application. Writes are forwarded to the
+// proxy on the primary node.
+type ProxyServer struct {
+	ln         net.Listener
+	httpServer *http.Server
+	store      *litefs.Store
+	target     *url.URL
+	transport  http.RoundTripper
+
+	g      errgroup.Group
+	ctx    context.Context
+	cancel func()
+
+	// Bind address of the proxy server.
+	Addr string
+
+	// Host & port of the local application.
+	Target string
+
+	// Name of the database used for read consistency.
+	DBName string
+
+	// Requests with these methods, or with a path that matches one of the
+	// path patterns, are served locally. All other requests are writes.
+	ReadOnlyMethods []string
+	ReadOnlyPaths   []string
+
+	// Time to wait for a replica to catch up to the TXID in a request's
+	// cookie before the read is forwarded to the primary instead.
+	ReadTimeout time.Duration
+
+	// Lifetime of the TXID cookie set after a write.
+	CookieExpiry time.Duration
+
+	// Used for overriding the primary's proxy URL for testing.
+	PrimaryURLFn func(info *litefs.PrimaryInfo) string
+}
+
+// NewProxyServer returns a new instance of ProxyServer.
+func NewProxyServer(store *litefs.Store) *ProxyServer {
+	s := &ProxyServer{
+		store:     store,
+		transport: http.DefaultTransport,
+
+		ReadOnlyMethods: DefaultProxyReadOnlyMethods,
+		ReadTimeout:     DefaultProxyReadTimeout,
+		CookieExpiry:    DefaultProxyCookieExpiry,
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	s.httpServer = &http.Server{
+		Handler: http.HandlerFunc(s.serveHTTP),
+		BaseContext: func(_ net.Listener) context.Context {
+			return s.ctx
+		},
+	}
+	return s
+}
+
+// Listen validates the settings & opens the listener.
+func (s *ProxyServer) Listen() (err error) {
+	if s.Target == "" {
+		return fmt.Errorf("proxy target required")
+	} else if s.DBName == "" {
+		return fmt.Errorf("proxy database required")
+	}
+
+	for _, pattern := range s.ReadOnlyPaths {
+		if _, err := path.Match(pattern, "/"); err != nil {
+			return fmt.Errorf("invalid proxy read-only path %q: %w", pattern, err)
+		}
+	}
+
+	if s.target, err = url.Parse("http://" + s.Target); err != nil {
+		return fmt.Errorf("invalid proxy target: %w", err)
+	}
+
+	if s.ln, err = net.Listen("tcp", s.Addr); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *ProxyServer) Serve() {
+	s.g.Go(func() error {
+		if err := s.httpServer.Serve(s.ln); s.ctx.Err() != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *ProxyServer) Close() (err error) {
+	if s.ln != nil {
+		if e := s.ln.Close(); err == nil {
+			err = e
+		}
+	}
+	if e := s.httpServer.Close(); err == nil {
+		err = e
+	}
+	s.cancel()
+	if e := s.g.Wait(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// Port returns the port the listener is running on.
+func (s *ProxyServer) Port() int {
+	if s.ln == nil {
+		return 0
+	}
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+// URL returns the full base URL for the running server.
+func (s *ProxyServer) URL() string {
+	host, _, _ := net.SplitHostPort(s.Addr)
+	if host == "" {
+		host = "localhost"
+	}
+	return fmt.Sprintf("http://%s", net.JoinHostPort(host, fmt.Sprint(s.Port())))
+}
+
+func (s *ProxyServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.isReadOnly(r) {
+		s.serveRead(w, r)
+		return
+	}
+	s.serveWrite(w, r)
+}
+
+// serveRead serves a request from the local application once the local
+// database has caught up to the TXID in the request's cookie, if any.
+func (s *ProxyServer) serveRead(w http.ResponseWriter, r *http.Request) {
+	cookie, _ := r.Cookie(ProxyTXIDCookieName)
+	if cookie == nil || s.store.IsPrimary() {
+		s.proxyToTarget(w, r)
+		return
+	}
+
+	txID, err := ltx.ParseTXID(cookie.Value)
+	if err != nil {
+		s.proxyToTarget(w, r) // ignore invalid cookies
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.ReadTimeout)
+	defer cancel()
+
+	if err := s.store.WaitForTXID(ctx, s.DBName, txID); err == nil {
+		s.proxyToTarget(w, r)
+		return
+	} else if r.Context().Err() != nil {
+		return // client disconnected
+	}
+
+	// The primary always has the latest data so serve from there if the
+	// replica could not catch up in time.
+	proxyReadTimeoutCountMetric.Inc()
+	s.proxyToPrimary(w, r)
+}
+
+// serveWrite serves a request from the local application if this node is the
+// primary. Otherwise the request is forwarded to the primary's proxy.
+func (s *ProxyServer) serveWrite(w http.ResponseWriter, r *http.Request) {
+	if !s.store.IsPrimary() {
+		proxyWriteCountMetricVec.WithLabelValues("primary").Inc()
+		s.proxyToPrimary(w, r)
+		return
+	}
+
+	proxy := s.newReverseProxy(s.target)
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		// The application has committed by the time it responds so the
+		// current position includes the request's write, if any.
+		var pos litefs.Pos
+		if db := s.store.DB(s.DBName); db != nil {
+			pos = db.Pos()
+		}
+		resp.Header.Add("Set-Cookie", (&http.Cookie{
+			Name:     ProxyTXIDCookieName,
+			Value:    ltx.FormatTXID(pos.TXID),
+			Path:     "/",
+			MaxAge:   int(s.CookieExpiry.Seconds()),
+			HttpOnly: true,
+		}).String())
+		return nil
+	}
+
+	proxyWriteCountMetricVec.WithLabelValues("local").Inc()
+	proxy.ServeHTTP(w, r)
+}
+
+func (s *ProxyServer) proxyToTarget(w http.ResponseWriter, r *http.Request) {
+	proxyReadCountMetric.Inc()
+	s.newReverseProxy(s.target).ServeHTTP(w, r)
+}
+
+// proxyToPrimary forwards a request to the proxy on the primary node. The
+// primary's proxy is assumed to listen on the same port as this node's proxy.
+func (s *ProxyServer) proxyToPrimary(w http.ResponseWriter, r *http.Request) {
+	// Avoid forwarding loops if the primary info is stale on both nodes.
+	if r.Header.Get("Litefs-Proxy-Forwarded") != "" {
+		Error(w, r, litefs.ErrReadOnlyReplica, http.StatusServiceUnavailable)
+		return
+	}
+
+	info := s.store.PrimaryInfo()
+	if info == nil {
+		Error(w, r, litefs.ErrNoPrimary, http.StatusServiceUnavailable)
+		return
+	}
+
+	target, err := s.primaryURL(info)
+	if err != nil {
+		Error(w, r, fmt.Errorf("invalid primary URL: %w", err), http.StatusBadGateway)
+		return
+	}
+	r.Header.Set("Litefs-Proxy-Forwarded", s.store.ID())
+
+	s.newReverseProxy(target).ServeHTTP(w, r)
+}
+
+// primaryURL returns the URL of the proxy on the primary node.
+func (s *ProxyServer) primaryURL(info *litefs.PrimaryInfo) (*url.URL, error) {
+	if s.PrimaryURLFn != nil {
+		return url.Parse(s.PrimaryURLFn(info))
+	}
+
+	u, err := url.Parse(info.AdvertiseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(u.Hostname(), fmt.Sprint(s.Port())),
+	}, nil
+}
+
+func (s *ProxyServer) newReverseProxy(target *url.URL) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = s.transport
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Printf("proxy: %s %s: %s", r.Method, r.URL.Path, err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	return proxy
+}
+
+// isReadOnly returns true if the request can be served by a replica.
+func (s *ProxyServer) isReadOnly(r *http.Request) bool {
+	for _, method := range s.ReadOnlyMethods {
+		if strings.EqualFold(r.Method, method) {
+			return true
+		}
+	}
+	for _, pattern := range s.ReadOnlyPaths {
+		if ok, _ := path.Match(pattern, r.URL.Path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Proxy server metrics.
+var (
+	proxyReadCountMetric = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "litefs_proxy_read_count",
+		Help: "Number of requests served by the local application.",
+	})
+
+	proxyWriteCountMetricVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "litefs_proxy_write_count",
+		Help: "Number of write requests by where they were served.",
+	}, []string{"target"})
+
+	proxyReadTimeoutCountMetric = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "litefs_proxy_read_timeout_count",
+		Help: "Number of reads forwarded to the primary after waiting to catch up.",
+	})
+)
@@ -1,7 +1,9 @@
 package http
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"expvar"
 	"fmt"
 	"io"
@@ -9,9 +11,14 @@ import (
 	"net"
 	"net/http"
 	"net/http/pprof"
+	"net/url"
 	"os"
+	"path"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -27,8 +34,21 @@ import (
 // Default settings
 const (
 	DefaultAddr = ":20202"
+
+	DefaultHandoffTimeout = 30 * time.Second
+	DefaultWaitTimeout    = 5 * time.Second
+
+	// Maximum size of a request body for POST /db/{name}/exec.
+	MaxExecRequestSize = 16 << 20
 )
 
+// Executor executes statements in a single transaction against a database on
+// the local node. Writes must go through the file system so that they are
+// recorded as transactions & replicated.
+type Executor interface {
+	Exec(ctx context.Context, name string, stmts []Statement) ([]*ExecResult, error)
+}
+
 // Server represents an HTTP API server for LiteFS.
 type Server struct {
 	ln net.Listener
@@ -40,6 +60,13 @@ type Server struct {
 	addr  string
 	store *litefs.Store
 
+	// Executes forwarded writes on the primary. Write forwarding is
+	// disabled if nil.
+	Executor Executor
+
+	mu       sync.Mutex
+	replicas map[*replicaStream]struct{} // connected replica streams
+
 	g      errgroup.Group
 	ctx    context.Context
 	cancel func()
@@ -49,6 +76,8 @@ func NewServer(store *litefs.Store, addr string) *Server {
 	s := &Server{
 		addr:  addr,
 		store: store,
+
+		replicas: make(map[*replicaStream]struct{}),
 	}
 	s.ctx, s.cancel = context.WithCancel(context.Background())
 
@@ -132,6 +161,38 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	switch r.URL.Path {
+	case "/demote":
+		switch r.Method {
+		case http.MethodPost:
+			s.handlePostDemote(w, r)
+		default:
+			Error(w, r, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		}
+		return
+	case "/promote":
+		switch r.Method {
+		case http.MethodPost:
+			s.handlePostPromote(w, r)
+		default:
+			Error(w, r, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		}
+		return
+	case "/handoff":
+		switch r.Method {
+		case http.MethodPost:
+			s.handlePostHandoff(w, r)
+		default:
+			Error(w, r, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		}
+		return
+	case "/status":
+		switch r.Method {
+		case http.MethodGet:
+			s.handleGetStatus(w, r)
+		default:
+			Error(w, r, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		}
+		return
 	case "/debug/vars":
 		expvar.Handler().ServeHTTP(w, r)
 		return
@@ -140,6 +201,12 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Route requests for individual databases: /db/{name}/{action}
+	if strings.HasPrefix(r.URL.Path, "/db/") {
+		s.serveDB(w, r)
+		return
+	}
+
 	switch r.URL.Path {
 	case "/import":
 		switch r.Method {
@@ -160,6 +227,739 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *Server) serveDB(w http.ResponseWriter, r *http.Request) {
+	name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/db/"), "/")
+	if name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch action {
+	case "snapshot":
+		switch r.Method {
+		case http.MethodGet:
+			s.handleGetDBSnapshot(w, r, name)
+		default:
+			Error(w, r, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	case "checkpoint":
+		switch r.Method {
+		case http.MethodPost:
+			s.handlePostDBCheckpoint(w, r, name)
+		default:
+			Error(w, r, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	case "wait":
+		switch r.Method {
+		case http.MethodGet:
+			s.handleGetDBWait(w, r, name)
+		default:
+			Error(w, r, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	case "exec":
+		switch r.Method {
+		case http.MethodPost:
+			s.handlePostDBExec(w, r, name)
+		default:
+			Error(w, r, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	case "clone":
+		switch r.Method {
+		case http.MethodPost:
+			s.handlePostDBClone(w, r, name)
+		default:
+			Error(w, r, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	case "locks":
+		switch r.Method {
+		case http.MethodGet:
+			s.handleGetDBLocks(w, r, name)
+		case http.MethodDelete:
+			s.handleDeleteDBLocks(w, r, name)
+		default:
+			Error(w, r, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) handlePostDBCheckpoint(w http.ResponseWriter, r *http.Request, name string) {
+	mode := litefs.CheckpointMode(strings.ToUpper(r.URL.Query().Get("mode")))
+	if mode == "" {
+		mode = litefs.CheckpointModePassive
+	} else if !mode.IsValid() {
+		Error(w, r, fmt.Errorf("invalid checkpoint mode: %q", mode), http.StatusBadRequest)
+		return
+	}
+
+	// Wrap context so that it cancels when the primary lease is lost.
+	r = r.WithContext(s.store.PrimaryCtx(r.Context()))
+	if err := r.Context().Err(); err != nil {
+		Error(w, r, err, http.StatusServiceUnavailable)
+		return
+	}
+
+	db := s.store.DB(name)
+	if db == nil {
+		Error(w, r, litefs.ErrDatabaseNotFound, http.StatusNotFound)
+		return
+	}
+
+	if err := db.Checkpoint(r.Context(), mode); err == litefs.ErrCheckpointBusy {
+		Error(w, r, err, http.StatusConflict)
+		return
+	} else if err != nil {
+		Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleGetDBWait blocks until the database reaches the given TXID and then
+// returns its position. Returns a 408 if the timeout elapses first.
+func (s *Server) handleGetDBWait(w http.ResponseWriter, r *http.Request, name string) {
+	q := r.URL.Query()
+	txID, err := ltx.ParseTXID(q.Get("txid"))
+	if err != nil {
+		Error(w, r, err, http.StatusBadRequest)
+		return
+	}
+	timeout, err := parseTimeout(q.Get("timeout"), DefaultWaitTimeout)
+	if err != nil {
+		Error(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	if err := s.store.WaitForTXID(ctx, name, txID); err == context.DeadlineExceeded {
+		Error(w, r, fmt.Errorf("timeout waiting for txid %s", ltx.FormatTXID(txID)), http.StatusRequestTimeout)
+		return
+	} else if err != nil {
+		return // client disconnected
+	}
+
+	pos := s.store.DB(name).Pos()
+	buf, err := json.Marshal(&DBStatus{
+		Name:     name,
+		TXID:     ltx.FormatTXID(pos.TXID),
+		Checksum: fmt.Sprintf("%016x", pos.PostApplyChecksum),
+	})
+	if err != nil {
+		Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(buf)
+}
+
+// handlePostDBClone creates a new database as a copy of an existing database
+// at its current position or at a retained TXID.
+func (s *Server) handlePostDBClone(w http.ResponseWriter, r *http.Request, name string) {
+	q := r.URL.Query()
+	to := q.Get("to")
+	if to == "" {
+		Error(w, r, fmt.Errorf("target name required"), http.StatusBadRequest)
+		return
+	} else if to != path.Base(to) || strings.Contains(to, "@") {
+		Error(w, r, fmt.Errorf("invalid target name: %q", to), http.StatusBadRequest)
+		return
+	}
+
+	var txID uint64
+	if v := q.Get("txid"); v != "" {
+		var err error
+		if txID, err = ltx.ParseTXID(v); err != nil {
+			Error(w, r, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Wrap context so that it cancels when the primary lease is lost.
+	r = r.WithContext(s.store.PrimaryCtx(r.Context()))
+	if err := r.Context().Err(); err != nil {
+		Error(w, r, err, http.StatusServiceUnavailable)
+		return
+	}
+
+	db, err := s.store.CloneDB(r.Context(), name, to, txID)
+	switch err {
+	case nil:
+	case litefs.ErrDatabaseNotFound, litefs.ErrTxNotAvailable:
+		Error(w, r, err, http.StatusNotFound)
+		return
+	case litefs.ErrDatabaseExists:
+		Error(w, r, err, http.StatusConflict)
+		return
+	default:
+		Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	pos := db.Pos()
+	buf, err := json.Marshal(&DBStatus{
+		Name:     db.Name(),
+		TXID:     ltx.FormatTXID(pos.TXID),
+		Checksum: fmt.Sprintf("%016x", pos.PostApplyChecksum),
+	})
+	if err != nil {
+		Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(buf)
+}
+
+// handleGetDBLocks returns the locks currently held on the database along
+// with the owner & process holding each one.
+func (s *Server) handleGetDBLocks(w http.ResponseWriter, r *http.Request, name string) {
+	db := s.store.DB(name)
+	if db == nil {
+		Error(w, r, litefs.ErrDatabaseNotFound, http.StatusNotFound)
+		return
+	}
+
+	buf, err := json.MarshalIndent(newLockStatuses(db.HeldLocks()), "", "  ")
+	if err != nil {
+		Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(buf)
+}
+
+// handleDeleteDBLocks forcibly releases all locks held by a single owner. This
+// is intended for emergencies when a lock is held by a process that cannot be
+// stopped or was not detected as stale.
+func (s *Server) handleDeleteDBLocks(w http.ResponseWriter, r *http.Request, name string) {
+	owner, err := strconv.ParseUint(r.URL.Query().Get("owner"), 10, 64)
+	if err != nil {
+		Error(w, r, fmt.Errorf("invalid owner: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	db := s.store.DB(name)
+	if db == nil {
+		Error(w, r, litefs.ErrDatabaseNotFound, http.StatusNotFound)
+		return
+	}
+
+	log.Printf("force releasing locks: db=%s owner=%d", name, owner)
+	if err := db.ReleaseLockOwner(r.Context(), owner); err == litefs.ErrLockOwnerNotFound {
+		Error(w, r, err, http.StatusNotFound)
+		return
+	} else if err != nil {
+		Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// handlePostDBExec executes statements in a single transaction on the primary.
+// Replicas proxy the request to the current primary.
+func (s *Server) handlePostDBExec(w http.ResponseWriter, r *http.Request, name string) {
+	if s.Executor == nil {
+		Error(w, r, fmt.Errorf("write forwarding not enabled"), http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxExecRequestSize))
+	if err != nil {
+		Error(w, r, fmt.Errorf("read request: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	if !s.store.IsPrimary() {
+		s.forwardDBExec(w, r, name, body)
+		return
+	}
+
+	var req ExecRequest
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		Error(w, r, fmt.Errorf("decode request: %w", err), http.StatusBadRequest)
+		return
+	} else if len(req.Statements) == 0 {
+		Error(w, r, fmt.Errorf("statements required"), http.StatusBadRequest)
+		return
+	}
+	for _, stmt := range req.Statements {
+		normalizeArgs(stmt.Args)
+	}
+
+	// Wrap context so that it cancels when the primary lease is lost.
+	r = r.WithContext(s.store.PrimaryCtx(r.Context()))
+	if err := r.Context().Err(); err != nil {
+		Error(w, r, err, http.StatusServiceUnavailable)
+		return
+	}
+
+	results, err := s.Executor.Exec(r.Context(), name, req.Statements)
+	if err != nil {
+		Error(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	// Report the position after commit. This may include later transactions
+	// from other writers but never precedes this transaction.
+	var pos litefs.Pos
+	if db := s.store.DB(name); db != nil {
+		pos = db.Pos()
+	}
+
+	buf, err := json.Marshal(&ExecResponse{TXID: ltx.FormatTXID(pos.TXID), Results: results})
+	if err != nil {
+		Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(buf)
+}
+
+// forwardDBExec proxies an exec request body to the current primary and copies
+// the primary's response back to the caller.
+func (s *Server) forwardDBExec(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	// Avoid forwarding loops if the primary info is stale on both nodes.
+	if r.Header.Get("Litefs-Forwarded") != "" {
+		Error(w, r, litefs.ErrReadOnlyReplica, http.StatusServiceUnavailable)
+		return
+	}
+
+	info := s.store.PrimaryInfo()
+	if info == nil {
+		Error(w, r, litefs.ErrNoPrimary, http.StatusServiceUnavailable)
+		return
+	}
+
+	u, err := url.Parse(info.AdvertiseURL)
+	if err != nil {
+		Error(w, r, fmt.Errorf("invalid primary URL: %w", err), http.StatusBadGateway)
+		return
+	}
+	*u = url.URL{Scheme: u.Scheme, Host: u.Host, Path: path.Join("/db", name, "exec")}
+
+	req, err := http.NewRequestWithContext(r.Context(), "POST", u.String(), bytes.NewReader(body))
+	if err != nil {
+		Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Litefs-Forwarded", s.store.ID())
+
+	resp, err := NewClient().HTTPClient.Do(req)
+	if err != nil {
+		Error(w, r, fmt.Errorf("forward to primary: %w", err), http.StatusBadGateway)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// normalizeArgs converts JSON numbers to integers or floats so they are bound
+// with the correct SQLite type.
+func normalizeArgs(args []interface{}) {
+	for i, arg := range args {
+		n, ok := arg.(json.Number)
+		if !ok {
+			continue
+		}
+		if v, err := n.Int64(); err == nil {
+			args[i] = v
+		} else if v, err := n.Float64(); err == nil {
+			args[i] = v
+		}
+	}
+}
+
+func (s *Server) handlePostDemote(w http.ResponseWriter, r *http.Request) {
+	if !s.store.IsPrimary() {
+		Error(w, r, litefs.ErrReadOnlyReplica, http.StatusServiceUnavailable)
+		return
+	}
+	s.store.Demote()
+}
+
+// handlePostPromote asks the current primary to hand off its lease to this node.
+func (s *Server) handlePostPromote(w http.ResponseWriter, r *http.Request) {
+	timeout, err := parseTimeout(r.URL.Query().Get("timeout"), DefaultHandoffTimeout)
+	if err != nil {
+		Error(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if s.store.IsPrimary() {
+		return // already primary
+	} else if !s.store.Candidate() {
+		Error(w, r, fmt.Errorf("node is not a candidate"), http.StatusBadRequest)
+		return
+	}
+
+	info := s.store.PrimaryInfo()
+	if info == nil {
+		Error(w, r, litefs.ErrNoPrimary, http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := NewClient().Handoff(r.Context(), info.AdvertiseURL, s.store.ID(), timeout); err != nil {
+		Error(w, r, fmt.Errorf("handoff: %w", err), http.StatusServiceUnavailable)
+		return
+	}
+}
+
+func (s *Server) handlePostHandoff(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	timeout, err := parseTimeout(q.Get("timeout"), DefaultHandoffTimeout)
+	if err != nil {
+		Error(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	if err := s.Handoff(ctx, q.Get("to")); err == litefs.ErrReadOnlyReplica {
+		Error(w, r, err, http.StatusServiceUnavailable)
+		return
+	} else if err != nil {
+		Error(w, r, err, http.StatusConflict)
+		return
+	}
+}
+
+// Handoff transfers the primary lease to the replica with the given node ID.
+// If nodeID is blank, the most caught-up candidate replica is chosen.
+//
+// Writes are blocked while in-flight transactions finish and the replica
+// catches up. The lease is then released and the replica is told to acquire
+// it. Writes resume on this node if the handoff fails before demotion.
+func (s *Server) Handoff(ctx context.Context, nodeID string) (err error) {
+	if !s.store.IsPrimary() {
+		return litefs.ErrReadOnlyReplica
+	}
+
+	replica := s.handoffReplica(nodeID)
+	if replica == nil && nodeID != "" {
+		return fmt.Errorf("replica not connected: %s", nodeID)
+	} else if replica == nil {
+		return fmt.Errorf("no candidate replicas connected")
+	} else if !replica.candidate {
+		return fmt.Errorf("replica is not a candidate: %s", nodeID)
+	}
+
+	log.Printf("%s: handing off primary lease to %s", s.store.ID(), replica.id)
+
+	s.store.BeginHandoff(replica.id)
+	defer func() {
+		if err != nil {
+			log.Printf("%s: handoff to %s failed, resuming writes: %s", s.store.ID(), replica.id, err)
+			s.store.CancelHandoff()
+		}
+	}()
+
+	// Wait for in-flight write transactions to complete. New writes are
+	// rejected until the handoff is complete or canceled. Readers are not
+	// waited on as they do not change the position sent to the replica.
+	dbs := s.store.DBs()
+	for _, db := range dbs {
+		if err := db.WaitWriters(ctx); err != nil {
+			return fmt.Errorf("wait for writers (%s): %w", db.Name(), err)
+		}
+	}
+
+	// Wait for the replica to receive every transaction.
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for !s.isReplicaCaughtUp(replica, dbs) {
+		if !s.hasReplica(replica) {
+			return fmt.Errorf("replica disconnected: %s", replica.id)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for replica to catch up: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	s.store.Demote()
+	return nil
+}
+
+// handoffReplica returns the connected replica with the given ID. If nodeID
+// is blank, returns the candidate replica with the least total lag.
+func (s *Server) handoffReplica(nodeID string) *replicaStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if nodeID != "" {
+		for replica := range s.replicas {
+			if replica.id == nodeID {
+				return replica
+			}
+		}
+		return nil
+	}
+
+	dbs := s.store.DBs()
+
+	var best *replicaStream
+	var bestLag uint64
+	for replica := range s.replicas {
+		if !replica.candidate {
+			continue
+		}
+
+		var lag uint64
+		replicaPosMap := replica.getPosMap()
+		for _, db := range dbs {
+			if pos, replicaPos := db.Pos(), replicaPosMap[db.Name()]; pos.TXID > replicaPos.TXID {
+				lag += pos.TXID - replicaPos.TXID
+			}
+		}
+
+		if best == nil || lag < bestLag || (lag == bestLag && replica.id < best.id) {
+			best, bestLag = replica, lag
+		}
+	}
+	return best
+}
+
+// isReplicaCaughtUp returns true if replica has received the current position of every database.
+func (s *Server) isReplicaCaughtUp(replica *replicaStream, dbs []*litefs.DB) bool {
+	replicaPosMap := replica.getPosMap()
+	for _, db := range dbs {
+		if replicaPosMap[db.Name()].TXID < db.Pos().TXID {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) hasReplica(replica *replicaStream) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.replicas[replica]
+	return ok
+}
+
+func (s *Server) handleGetStatus(w http.ResponseWriter, r *http.Request) {
+	buf, err := json.MarshalIndent(s.Status(), "", "  ")
+	if err != nil {
+		Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(buf)
+}
+
+// Status returns the current state of the node. If the node is the primary,
+// the status includes the replicas currently connected to it.
+func (s *Server) Status() *Status {
+	status := &Status{
+		ID:           s.store.ID(),
+		IsPrimary:    s.store.IsPrimary(),
+		Candidate:    s.store.Candidate(),
+		LowDiskSpace: s.store.LowDiskSpace(),
+		DBs:          make([]*DBStatus, 0),
+	}
+
+	if lease := s.store.Lease(); lease != nil {
+		status.Primary = &PrimaryInfo{AdvertiseURL: s.store.Leaser.AdvertiseURL()}
+		status.Lease = &LeaseStatus{TTL: lease.TTL(), RenewedAt: lease.RenewedAt()}
+	} else if info := s.store.PrimaryInfo(); info != nil {
+		status.Primary = &PrimaryInfo{Hostname: info.Hostname, AdvertiseURL: info.AdvertiseURL}
+	}
+
+	dbs := s.store.DBs()
+	sort.Slice(dbs, func(i, j int) bool { return dbs[i].Name() < dbs[j].Name() })
+
+	posMap := make(map[string]litefs.Pos, len(dbs))
+	for _, db := range dbs {
+		pos := db.Pos()
+		posMap[db.Name()] = pos
+		dbStatus := &DBStatus{
+			Name:     db.Name(),
+			TXID:     ltx.FormatTXID(pos.TXID),
+			Checksum: fmt.Sprintf("%016x", pos.PostApplyChecksum),
+		}
+		if locks := db.HeldLocks(); len(locks) > 0 {
+			dbStatus.Locks = newLockStatuses(locks)
+		}
+		status.DBs = append(status.DBs, dbStatus)
+	}
+
+	s.mu.Lock()
+	replicas := make([]*replicaStream, 0, len(s.replicas))
+	for replica := range s.replicas {
+		replicas = append(replicas, replica)
+	}
+	s.mu.Unlock()
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].id < replicas[j].id })
+
+	for _, replica := range replicas {
+		replicaPosMap := replica.getPosMap()
+
+		replicaStatus := &ReplicaStatus{
+			ID:          replica.id,
+			Addr:        replica.addr,
+			ConnectedAt: replica.connectedAt,
+			DBs:         make([]*ReplicaDBStatus, 0, len(dbs)),
+		}
+		for _, db := range dbs {
+			pos, replicaPos := posMap[db.Name()], replicaPosMap[db.Name()]
+
+			var lag uint64
+			if pos.TXID > replicaPos.TXID {
+				lag = pos.TXID - replicaPos.TXID
+			}
+
+			replicaStatus.DBs = append(replicaStatus.DBs, &ReplicaDBStatus{
+				Name:     db.Name(),
+				SentTXID: ltx.FormatTXID(replicaPos.TXID),
+				SentLag:  lag,
+			})
+		}
+		status.Replicas = append(status.Replicas, replicaStatus)
+	}
+
+	return status
+}
+
+func (s *Server) addReplica(replica *replicaStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replicas[replica] = struct{}{}
+}
+
+func (s *Server) removeReplica(replica *replicaStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.replicas, replica)
+}
+
+// handleGetDBSnapshot writes a consistent copy of the database as a SQLite
+// file. The TXID & page size are sent as headers and the checksum is sent as
+// a trailer once all pages have been written.
+func (s *Server) handleGetDBSnapshot(w http.ResponseWriter, r *http.Request, name string) {
+	db := s.store.DB(name)
+	if db == nil {
+		Error(w, r, litefs.ErrDatabaseNotFound, http.StatusNotFound)
+		return
+	}
+
+	// Write the LTX snapshot to a pipe so we can strip the framing.
+	pr, pw := io.Pipe()
+	defer func() { _ = pr.Close() }()
+	go func() {
+		_, _, err := db.WriteSnapshotTo(r.Context(), pw)
+		_ = pw.CloseWithError(err)
+	}()
+
+	dec := ltx.NewDecoder(pr)
+	if err := dec.DecodeHeader(); err != nil {
+		Error(w, r, fmt.Errorf("decode ltx header: %w", err), http.StatusInternalServerError)
+		return
+	}
+	hdr := dec.Header()
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Litefs-Txid", ltx.FormatTXID(hdr.MaxTXID))
+	w.Header().Set("Litefs-Page-Size", strconv.FormatUint(uint64(hdr.PageSize), 10))
+	w.Header().Set("Trailer", "Litefs-Checksum")
+	w.WriteHeader(http.StatusOK)
+
+	// Write pages in order. The lock page is not stored in LTX files so it is
+	// written out as zeros to preserve page offsets.
+	data := make([]byte, hdr.PageSize)
+	var pageN uint32
+	for {
+		var phdr ltx.PageHeader
+		if err := dec.DecodePage(&phdr, data); err == io.EOF {
+			break
+		} else if err != nil {
+			log.Printf("snapshot %q: decode page: %s", name, err)
+			return
+		}
+
+		if err := writeZeroPages(w, hdr.PageSize, phdr.Pgno-pageN-1); err != nil {
+			log.Printf("snapshot %q: write lock page: %s", name, err)
+			return
+		} else if _, err := w.Write(data); err != nil {
+			log.Printf("snapshot %q: write page: %s", name, err)
+			return
+		}
+		pageN = phdr.Pgno
+	}
+
+	if err := writeZeroPages(w, hdr.PageSize, hdr.Commit-pageN); err != nil {
+		log.Printf("snapshot %q: write lock page: %s", name, err)
+		return
+	}
+
+	if err := dec.Close(); err != nil {
+		log.Printf("snapshot %q: close decoder: %s", name, err)
+		return
+	}
+	w.Header().Set("Litefs-Checksum", fmt.Sprintf("%016x", dec.Trailer().PostApplyChecksum))
+}
+
+// replicaStream tracks the last position sent to a connected replica.
+type replicaStream struct {
+	id          string
+	addr        string
+	candidate   bool
+	connectedAt time.Time
+
+	mu     sync.Mutex
+	posMap map[string]litefs.Pos
+}
+
+func (r *replicaStream) getPosMap() map[string]litefs.Pos {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.posMap
+}
+
+// setPosMap stores a copy of m as the replica's current position.
+func (r *replicaStream) setPosMap(m map[string]litefs.Pos) {
+	other := make(map[string]litefs.Pos, len(m))
+	for k, v := range m {
+		other[k] = v
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.posMap = other
+}
+
+// parseTimeout parses a duration query parameter. Returns defaultValue if blank.
+func parseTimeout(s string, defaultValue time.Duration) (time.Duration, error) {
+	if s == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout: %q", s)
+	}
+	return d, nil
+}
+
+// writeZeroPages writes n zero-filled pages to w.
+func writeZeroPages(w io.Writer, pageSize, n uint32) error {
+	for i := uint32(0); i < n; i++ {
+		if _, err := w.Write(make([]byte, pageSize)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *Server) handlePostImport(w http.ResponseWriter, r *http.Request) {
 	name := r.URL.Query().Get("name")
 	if name == "" {
@@ -193,7 +993,7 @@ func (s *Server) handlePostStream(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Prevent nodes from connecting to themselves.
-	if id := r.Header.Get("Litefs-Id"); id == s.store.ID() {
+	if r.Header.Get("Litefs-Id") == s.store.ID() {
 		Error(w, r, fmt.Errorf("cannot connect to self"), http.StatusBadRequest)
 		return
 	}
@@ -205,6 +1005,7 @@ func (s *Server) handlePostStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	id := r.Header.Get("Litefs-Id")
 	log.Printf("%s: stream connected", s.store.ID())
 	defer log.Printf("%s: stream disconnected", s.store.ID())
 
@@ -222,6 +1023,24 @@ func (s *Server) handlePostStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Read in page range checksums used to resync diverged databases.
+	rangeMap, err := ReadPageRangeMapFrom(r.Body)
+	if err != nil {
+		Error(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	// Track replica so its position can be reported by the status endpoint.
+	replica := &replicaStream{
+		id:          id,
+		addr:        r.RemoteAddr,
+		candidate:   r.Header.Get("Litefs-Candidate") == "true",
+		connectedAt: time.Now(),
+	}
+	replica.setPosMap(posMap)
+	s.addReplica(replica)
+	defer s.removeReplica(replica)
+
 	dbs := s.store.DBs()
 	sort.Slice(dbs, func(i, j int) bool { return dbs[i].Name() < dbs[j].Name() })
 
@@ -240,7 +1059,13 @@ func (s *Server) handlePostStream(w http.ResponseWriter, r *http.Request) {
 
 	// Attempt to flush an "end" frame on disconnect so we can flush it.
 	// See: https://github.com/superfly/litefs/issues/182
+	//
+	// If we're disconnecting because the lease was handed off then let the
+	// replica know which node is taking over.
 	defer func() {
+		if nodeID := s.store.HandoffNodeID(); nodeID != "" && !s.store.IsPrimary() {
+			_ = litefs.WriteStreamFrame(w, &litefs.HandoffStreamFrame{NodeID: nodeID})
+		}
 		_ = litefs.WriteStreamFrame(w, &litefs.EndStreamFrame{})
 		w.(http.Flusher).Flush()
 	}()
@@ -250,11 +1075,12 @@ func (s *Server) handlePostStream(w http.ResponseWriter, r *http.Request) {
 	for {
 		// Send pending transactions for each database.
 		for name := range dirtySet {
-			if err := s.streamDB(r.Context(), w, name, posMap); err != nil {
+			if err := s.streamDB(r.Context(), w, name, posMap, rangeMap); err != nil {
 				Error(w, r, fmt.Errorf("stream error: db=%q err=%s", name, err), http.StatusInternalServerError)
 				return
 			}
 		}
+		replica.setPosMap(posMap)
 
 		// Send "ready" frame after initial replication set
 		if !readySent {
@@ -279,9 +1105,13 @@ func (s *Server) handlePostStream(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) streamDB(ctx context.Context, w http.ResponseWriter, name string, posMap map[string]litefs.Pos) error {
+func (s *Server) streamDB(ctx context.Context, w http.ResponseWriter, name string, posMap map[string]litefs.Pos, rangeMap map[string]*litefs.PageRangeChecksums) error {
 	db := s.store.DB(name)
 
+	// Page range checksums are only valid for the client's initial position.
+	ranges := rangeMap[name]
+	delete(rangeMap, name)
+
 	// If the replica has a database that doesn't exist on the primary, skip it.
 	// TODO: Send a deletion message to the replica to remove the database.
 	if db == nil {
@@ -289,24 +1119,38 @@ func (s *Server) streamDB(ctx context.Context, w http.ResponseWriter, name strin
 		return nil
 	}
 
+	// Skip databases that have been excluded from replication.
+	if !s.store.DBConfig(name).Replicate {
+		return nil
+	}
+
 	for {
 		clientPos := posMap[name]
 		dbPos := db.Pos()
 
-		// Invalidate client position if we're beyond the primary's TXID.
+		// Resync client if we're beyond the primary's TXID.
 		// This can occur if an old primary has unreplicated transactions and
-		// then loses its primary status and reconnects. By invalidating, we
-		// will cause a snapshot to occur.
+		// then loses its primary status and reconnects.
+		var resync bool
 		if clientPos.TXID > dbPos.TXID {
-			log.Printf("client transaction id (%s) exceeds primary transaction id (%s), clearing client position", ltx.FormatTXID(clientPos.TXID), ltx.FormatTXID(dbPos.TXID))
-			clientPos = litefs.Pos{}
+			log.Printf("client transaction id (%s) exceeds primary transaction id (%s), resyncing client", ltx.FormatTXID(clientPos.TXID), ltx.FormatTXID(dbPos.TXID))
+			resync = true
 		}
 
-		// Invalidate client position if the TXID matches but the checksum does not.
+		// Resync client if the TXID matches but the checksum does not.
 		// This can also occur if an old primary has unreplicated transactions.
 		if clientPos.TXID == dbPos.TXID && clientPos.PostApplyChecksum != dbPos.PostApplyChecksum {
-			log.Printf("client transaction id (%s) caught up but checksum is mismatched (%016x <> %016x), clearing client position", ltx.FormatTXID(clientPos.TXID), clientPos.PostApplyChecksum, dbPos.PostApplyChecksum)
-			clientPos = litefs.Pos{}
+			log.Printf("client transaction id (%s) caught up but checksum is mismatched (%016x <> %016x), resyncing client", ltx.FormatTXID(clientPos.TXID), clientPos.PostApplyChecksum, dbPos.PostApplyChecksum)
+			resync = true
+		}
+
+		if resync {
+			newPos, err := s.streamLTXResync(ctx, w, db, clientPos, ranges)
+			if err != nil {
+				return fmt.Errorf("stream ltx resync: %w", err)
+			}
+			posMap[name], ranges = newPos, nil
+			continue
 		}
 
 		// Exit when client has caught up.
@@ -314,20 +1158,22 @@ func (s *Server) streamDB(ctx context.Context, w http.ResponseWriter, name strin
 			return nil
 		}
 
-		newPos, err := s.streamLTX(ctx, w, db, clientPos.TXID+1, clientPos.PostApplyChecksum)
+		newPos, err := s.streamLTX(ctx, w, db, clientPos, ranges)
 		if err != nil {
 			return fmt.Errorf("stream ltx (%s): %w", ltx.FormatTXID(clientPos.TXID+1), err)
 		}
-		posMap[name] = newPos
+		posMap[name], ranges = newPos, nil
 	}
 }
 
-func (s *Server) streamLTX(ctx context.Context, w http.ResponseWriter, db *litefs.DB, txID uint64, preApplyChecksum uint64) (newPos litefs.Pos, err error) {
+func (s *Server) streamLTX(ctx context.Context, w http.ResponseWriter, db *litefs.DB, clientPos litefs.Pos, ranges *litefs.PageRangeChecksums) (newPos litefs.Pos, err error) {
+	txID := clientPos.TXID + 1
+
 	// Open LTX file, read header.
 	f, err := db.OpenLTXFile(txID)
 	if os.IsNotExist(err) {
-		log.Printf("transaction file for txid %s no longer available, writing snapshot", ltx.FormatTXID(txID))
-		return s.streamLTXSnapshot(ctx, w, db)
+		log.Printf("transaction file for txid %s no longer available, resyncing client", ltx.FormatTXID(txID))
+		return s.streamLTXResync(ctx, w, db, clientPos, ranges)
 	} else if err != nil {
 		return litefs.Pos{}, fmt.Errorf("open ltx file: %w", err)
 	}
@@ -342,10 +1188,10 @@ func (s *Server) streamLTX(ctx context.Context, w http.ResponseWriter, db *litef
 		return litefs.Pos{}, fmt.Errorf("seek ltx to start: %w", err)
 	}
 
-	// If previous checksum on client does not match, return snapshot instead.
-	if dec.Header().PreApplyChecksum != preApplyChecksum {
-		log.Printf("client preapply checksum mismatch for txid %s, writing snapshot", ltx.FormatTXID(txID))
-		return s.streamLTXSnapshot(ctx, w, db)
+	// If previous checksum on client does not match, resync the client instead.
+	if dec.Header().PreApplyChecksum != clientPos.PostApplyChecksum {
+		log.Printf("client preapply checksum mismatch for txid %s, resyncing client", ltx.FormatTXID(txID))
+		return s.streamLTXResync(ctx, w, db, clientPos, ranges)
 	}
 
 	// Write frame.
@@ -369,6 +1215,35 @@ func (s *Server) streamLTX(ctx context.Context, w http.ResponseWriter, db *litef
 	return litefs.Pos{TXID: dec.Header().MaxTXID, PostApplyChecksum: dec.Trailer().PostApplyChecksum}, nil
 }
 
+// streamLTXResync writes only the pages that differ between the client and the
+// primary based on the client's page range checksums. Falls back to writing a
+// snapshot if the client did not send compatible page range checksums.
+func (s *Server) streamLTXResync(ctx context.Context, w http.ResponseWriter, db *litefs.DB, clientPos litefs.Pos, ranges *litefs.PageRangeChecksums) (newPos litefs.Pos, err error) {
+	if ranges == nil || clientPos.IsZero() || ranges.PageSize != db.PageSize() || db.TXID() <= 1 {
+		log.Printf("page ranges unavailable for %q, writing snapshot", db.Name())
+		return s.streamLTXSnapshot(ctx, w, db)
+	}
+
+	// Write frame.
+	if err := litefs.WriteStreamFrame(w, &litefs.ResyncStreamFrame{Name: db.Name()}); err != nil {
+		return litefs.Pos{}, fmt.Errorf("write ltx resync stream frame: %w", err)
+	}
+
+	// Write differing pages to writer.
+	cw := chunk.NewWriter(w)
+	header, trailer, err := db.WriteDiffTo(ctx, cw, clientPos, ranges)
+	if err != nil {
+		return litefs.Pos{}, fmt.Errorf("write ltx diff to chunked stream: %w", err)
+	} else if err := cw.Close(); err != nil {
+		return litefs.Pos{}, fmt.Errorf("close ltx diff to chunked stream: %w", err)
+	}
+	w.(http.Flusher).Flush()
+
+	serverFrameSendCountMetricVec.WithLabelValues(db.Name(), "ltx:resync").Inc()
+
+	return litefs.Pos{TXID: header.MaxTXID, PostApplyChecksum: trailer.PostApplyChecksum}, nil
+}
+
 func (s *Server) streamLTXSnapshot(ctx context.Context, w http.ResponseWriter, db *litefs.DB) (newPos litefs.Pos, err error) {
 	// Write frame.
 	if err := litefs.WriteStreamFrame(w, &litefs.LTXStreamFrame{Name: db.Name()}); err != nil {
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"sync/atomic"
 	"unsafe"
 )
 
@@ -30,6 +31,13 @@ var (
 	ErrLeaseExpired  = errors.New("lease expired")
 
 	ErrReadOnlyReplica = fmt.Errorf("read only replica")
+	ErrDatabaseFull    = fmt.Errorf("database exceeds maximum size")
+	ErrLowDiskSpace    = fmt.Errorf("data directory low on disk space")
+	ErrCheckpointBusy  = fmt.Errorf("checkpoint busy")
+	ErrDeadlock        = fmt.Errorf("deadlock detected")
+
+	ErrLockOwnerNotFound = fmt.Errorf("lock owner not found")
+	ErrTxNotAvailable    = fmt.Errorf("transaction not available")
 )
 
 // SQLite constants
@@ -77,6 +85,29 @@ const (
 	JournalModeWAL      = "WAL"
 )
 
+// CheckpointMode represents a mode for checkpointing the WAL.
+//
+// LiteFS always copies every WAL page into the database file and truncates
+// the WAL so FULL & TRUNCATE behave the same. PASSIVE does not wait on
+// readers or writers and returns ErrCheckpointBusy if the WAL is in use.
+type CheckpointMode string
+
+const (
+	CheckpointModePassive  = CheckpointMode("PASSIVE")
+	CheckpointModeFull     = CheckpointMode("FULL")
+	CheckpointModeTruncate = CheckpointMode("TRUNCATE")
+)
+
+// IsValid returns true if m is a valid checkpoint mode.
+func (m CheckpointMode) IsValid() bool {
+	switch m {
+	case CheckpointModePassive, CheckpointModeFull, CheckpointModeTruncate:
+		return true
+	default:
+		return false
+	}
+}
+
 // FileType represents a type of SQLite file.
 type FileType int
 
@@ -125,15 +156,42 @@ func (p Pos) IsZero() bool {
 // Client represents a client for connecting to other LiteFS nodes.
 type Client interface {
 	// Stream starts a long-running connection to stream changes from another node.
-	Stream(ctx context.Context, rawurl string, id string, posMap map[string]Pos) (io.ReadCloser, error)
+	// The candidate flag lets the primary know if the node can receive a handoff.
+	// The rangeMap holds page range checksums for each database so that the
+	// remote node can resync a diverged database by only sending changed pages.
+	Stream(ctx context.Context, rawurl string, id string, candidate bool, posMap map[string]Pos, rangeMap map[string]*PageRangeChecksums) (io.ReadCloser, error)
+}
+
+// PageRangeChecksums represents checksums for fixed-size ranges of pages in a
+// database. Each checksum is the XOR of the page checksums within its range.
+type PageRangeChecksums struct {
+	PageSize  uint32   // database page size
+	PageN     uint32   // database size, in pages
+	RangeSize uint32   // number of pages per range
+	Checksums []uint64 // checksum of each range
+}
+
+// RangeChecksum returns the checksum of the range containing pgno. Returns
+// false if pgno is outside of the ranges.
+func (r *PageRangeChecksums) RangeChecksum(pgno uint32) (uint64, bool) {
+	if pgno == 0 || r.RangeSize == 0 {
+		return 0, false
+	}
+	i := int((pgno - 1) / r.RangeSize)
+	if i >= len(r.Checksums) {
+		return 0, false
+	}
+	return r.Checksums[i], true
 }
 
 type StreamFrameType uint32
 
 const (
-	StreamFrameTypeLTX   = StreamFrameType(1)
-	StreamFrameTypeReady = StreamFrameType(2)
-	StreamFrameTypeEnd   = StreamFrameType(3)
+	StreamFrameTypeLTX     = StreamFrameType(1)
+	StreamFrameTypeReady   = StreamFrameType(2)
+	StreamFrameTypeEnd     = StreamFrameType(3)
+	StreamFrameTypeResync  = StreamFrameType(4)
+	StreamFrameTypeHandoff = StreamFrameType(5)
 )
 
 type StreamFrame interface {
@@ -157,6 +215,10 @@ func ReadStreamFrame(r io.Reader) (StreamFrame, error) {
 		f = &ReadyStreamFrame{}
 	case StreamFrameTypeEnd:
 		f = &EndStreamFrame{}
+	case StreamFrameTypeResync:
+		f = &ResyncStreamFrame{}
+	case StreamFrameTypeHandoff:
+		f = &HandoffStreamFrame{}
 	default:
 		return nil, fmt.Errorf("invalid stream frame type: 0x%02x", typ)
 	}
@@ -226,6 +288,64 @@ func (f *LTXStreamFrame) WriteTo(w io.Writer) (int64, error) {
 	return 0, nil
 }
 
+// ResyncStreamFrame is followed by an LTX file that only contains the pages
+// that differ from the replica. It has the same encoding as LTXStreamFrame.
+// The LTX file is based on the replica's current checksum rather than its
+// TXID so it can move a diverged replica to the primary's position.
+type ResyncStreamFrame struct {
+	Size int64  // payload size
+	Name string // database name
+}
+
+// Type returns the type of stream frame.
+func (*ResyncStreamFrame) Type() StreamFrameType { return StreamFrameTypeResync }
+
+func (f *ResyncStreamFrame) ReadFrom(r io.Reader) (int64, error) {
+	return (*LTXStreamFrame)(f).ReadFrom(r)
+}
+
+func (f *ResyncStreamFrame) WriteTo(w io.Writer) (int64, error) {
+	return (*LTXStreamFrame)(f).WriteTo(w)
+}
+
+// HandoffStreamFrame is sent by a primary that is stepping down. It names the
+// node that should acquire the lease next. Other nodes should wait before
+// attempting to acquire the lease so that the named node can take over.
+type HandoffStreamFrame struct {
+	NodeID string
+}
+
+// Type returns the type of stream frame.
+func (*HandoffStreamFrame) Type() StreamFrameType { return StreamFrameTypeHandoff }
+
+func (f *HandoffStreamFrame) ReadFrom(r io.Reader) (int64, error) {
+	var idN uint32
+	if err := binary.Read(r, binary.BigEndian, &idN); err == io.EOF {
+		return 0, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return 0, err
+	}
+
+	id := make([]byte, idN)
+	if _, err := io.ReadFull(r, id); err == io.EOF {
+		return 0, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return 0, err
+	}
+	f.NodeID = string(id)
+
+	return 0, nil
+}
+
+func (f *HandoffStreamFrame) WriteTo(w io.Writer) (int64, error) {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(f.NodeID))); err != nil {
+		return 0, err
+	} else if _, err := w.Write([]byte(f.NodeID)); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
 type ReadyStreamFrame struct{}
 
 func (f *ReadyStreamFrame) Type() StreamFrameType               { return StreamFrameTypeReady }
@@ -463,6 +583,14 @@ const (
 	LockTypeDMS     = LockType(128)
 )
 
+// lockTypes is the list of all lock types.
+var lockTypes = []LockType{
+	LockTypePending, LockTypeShared, LockTypeReserved,
+	LockTypeWrite, LockTypeCkpt, LockTypeRecover,
+	LockTypeRead0, LockTypeRead1, LockTypeRead2, LockTypeRead3, LockTypeRead4,
+	LockTypeDMS,
+}
+
 // ContainsLockType returns true if a contains typ.
 func ContainsLockType(a []LockType, typ LockType) bool {
 	for _, v := range a {
@@ -525,7 +653,9 @@ func ParseSHMLockRange(start, end uint64) []LockType {
 
 // GuardSet represents a set of mutex guards by a single owner.
 type GuardSet struct {
-	owner uint64
+	owner   uint64
+	pid     atomic.Int64 // process that last acquired a lock, if known
+	release func()       // removes an internal guard set from its database
 
 	// Database file locks
 	pending  RWMutexGuard
@@ -544,6 +674,16 @@ type GuardSet struct {
 	dms     RWMutexGuard
 }
 
+// Owner returns the lock owner ID of the guard set.
+func (s *GuardSet) Owner() uint64 { return s.owner }
+
+// PID returns the ID of the process that last acquired a lock through the
+// guard set. Returns zero if unknown.
+func (s *GuardSet) PID() int { return int(s.pid.Load()) }
+
+// SetPID sets the ID of the process acquiring locks through the guard set.
+func (s *GuardSet) SetPID(pid int) { s.pid.Store(int64(pid)) }
+
 // Pending returns a reference to the PENDING mutex guard.
 func (s *GuardSet) Pending() *RWMutexGuard { return &s.pending }
 
@@ -617,10 +757,37 @@ func (s *GuardSet) Guard(lockType LockType) *RWMutexGuard {
 	}
 }
 
+// conflicts returns true if the set holds a lock on lockType that conflicts
+// with an exclusive or shared lock.
+func (s *GuardSet) conflicts(lockType LockType, exclusive bool) bool {
+	switch s.Guard(lockType).State() {
+	case RWMutexStateExclusive:
+		return true
+	case RWMutexStateShared:
+		return exclusive
+	default:
+		return false
+	}
+}
+
+// IsLocked returns true if any guard in the set holds a lock.
+func (s *GuardSet) IsLocked() bool {
+	for _, lockType := range lockTypes {
+		if s.Guard(lockType).State() != RWMutexStateUnlocked {
+			return true
+		}
+	}
+	return false
+}
+
 // Unlock unlocks all the guards in reversed order that they are acquired by SQLite.
 func (s *GuardSet) Unlock() {
 	s.UnlockDatabase()
 	s.UnlockSHM()
+
+	if s.release != nil {
+		s.release()
+	}
 }
 
 // UnlockDatabase unlocks all the database file guards.
@@ -36,6 +36,17 @@ func TestFileType_IsValid(t *testing.T) {
 	})
 }
 
+func TestCheckpointMode_IsValid(t *testing.T) {
+	for _, mode := range []litefs.CheckpointMode{litefs.CheckpointModePassive, litefs.CheckpointModeFull, litefs.CheckpointModeTruncate} {
+		if !mode.IsValid() {
+			t.Fatalf("expected %q to be valid", mode)
+		}
+	}
+	if litefs.CheckpointMode("RESTART").IsValid() {
+		t.Fatal("expected invalid")
+	}
+}
+
 func TestPos_IsZero(t *testing.T) {
 	if !(litefs.Pos{}).IsZero() {
 		t.Fatal("expected true")
@@ -61,6 +72,32 @@ func TestReadWriteStreamFrame(t *testing.T) {
 			t.Fatalf("got %#v, want %#v", frame, other)
 		}
 	})
+	t.Run("ResyncStreamFrame", func(t *testing.T) {
+		frame := &litefs.ResyncStreamFrame{Size: 100, Name: "test.db"}
+
+		var buf bytes.Buffer
+		if err := litefs.WriteStreamFrame(&buf, frame); err != nil {
+			t.Fatal(err)
+		}
+		if other, err := litefs.ReadStreamFrame(&buf); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(frame, other) {
+			t.Fatalf("got %#v, want %#v", frame, other)
+		}
+	})
+	t.Run("HandoffStreamFrame", func(t *testing.T) {
+		frame := &litefs.HandoffStreamFrame{NodeID: "ABC"}
+
+		var buf bytes.Buffer
+		if err := litefs.WriteStreamFrame(&buf, frame); err != nil {
+			t.Fatal(err)
+		}
+		if other, err := litefs.ReadStreamFrame(&buf); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(frame, other) {
+			t.Fatalf("got %#v, want %#v", frame, other)
+		}
+	})
 	t.Run("ReadyStreamFrame", func(t *testing.T) {
 		frame := &litefs.ReadyStreamFrame{}
 
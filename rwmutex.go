@@ -7,21 +7,26 @@ import (
 	"time"
 )
 
-// RWMutexInterval is the time between reattempting lock acquisition.
-const RWMutexInterval = 10 * time.Microsecond
-
 // RWMutex is a reader/writer mutual exclusion lock. It wraps the sync package
-// to provide additional capabilities such as lock upgrades & downgrades. It
-// only supports TryLock() & TryRLock() as that is what's supported by our
-// FUSE file system.
+// to provide additional capabilities such as lock upgrades & downgrades.
+//
+// Blocked callers of Lock() & RLock() sleep until another guard releases or
+// downgrades its lock and then retry, rather than polling the mutex state.
 type RWMutex struct {
 	mu      sync.Mutex
 	sharedN int           // number of readers
 	excl    *RWMutexGuard // exclusive lock holder
+	changed chan struct{} // closed when a lock is released or downgraded
 
 	// If set, this function is called when the state transitions.
 	// Must be set before use of the mutex or its guards.
 	OnLockStateChange func(prevState, newState RWMutexState)
+
+	// If set, these functions are called with the time a guard spent waiting
+	// in Lock() or RLock() and with the time a guard held its lock once it is
+	// released. Must be set before use of the mutex or its guards.
+	OnWait   func(d time.Duration)
+	OnUnlock func(d time.Duration)
 }
 
 // Guard returns an unlocked guard for the mutex.
@@ -46,12 +51,38 @@ func (rw *RWMutex) state() RWMutexState {
 	return RWMutexStateUnlocked
 }
 
+// changeCh returns a channel that is closed the next time a lock on the
+// mutex is released or downgraded.
+func (rw *RWMutex) changeCh() <-chan struct{} {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return rw.waitCh()
+}
+
+// waitCh returns the current change channel, creating it if needed.
+// Mutex must be held.
+func (rw *RWMutex) waitCh() <-chan struct{} {
+	if rw.changed == nil {
+		rw.changed = make(chan struct{})
+	}
+	return rw.changed
+}
+
+// notify wakes any goroutines waiting on changeCh(). Mutex must be held.
+func (rw *RWMutex) notify() {
+	if rw.changed != nil {
+		close(rw.changed)
+		rw.changed = nil
+	}
+}
+
 // RWMutexGuard is a reference to a mutex. Locking, unlocking, upgrading, &
 // downgrading operations are all performed via the guard instead of directly
 // on the RWMutex itself as this works similarly to how POSIX locks work.
 type RWMutexGuard struct {
-	rw    *RWMutex
-	state RWMutexState
+	rw         *RWMutex
+	state      RWMutexState
+	acquiredAt time.Time // time the lock was acquired from an unlocked state
 }
 
 // State returns the current state of the guard.
@@ -61,41 +92,25 @@ func (g *RWMutexGuard) State() RWMutexState {
 	return g.state
 }
 
+// AcquiredAt returns the time the guard acquired its lock. Upgrades &
+// downgrades do not reset the time. Returns zero if the guard is unlocked.
+func (g *RWMutexGuard) AcquiredAt() time.Time {
+	g.rw.mu.Lock()
+	defer g.rw.mu.Unlock()
+	return g.acquiredAt
+}
+
 // Lock attempts to obtain a exclusive lock for the guard. Returns an error if ctx is done.
 func (g *RWMutexGuard) Lock(ctx context.Context) error {
-	if g.TryLock() {
-		return nil
-	}
-
-	ticker := time.NewTicker(RWMutexInterval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-ticker.C:
-			if g.TryLock() {
-				return nil
-			}
-		}
-	}
+	return g.wait(ctx, g.tryLock)
 }
 
 // TryLock upgrades the lock from a shared lock to an exclusive lock.
 // This is a no-op if the lock is already an exclusive lock. This function will
 // trigger OnLockStateChange on the mutex, if set, and if state changes.
 func (g *RWMutexGuard) TryLock() bool {
-	g.rw.mu.Lock()
-	prevState := g.rw.state()
-	v := g.tryLock()
-	fn, newState := g.rw.OnLockStateChange, g.rw.state()
-	g.rw.mu.Unlock()
-
-	if fn != nil && prevState != newState {
-		fn(prevState, newState)
-	}
-	return v
+	ok, _ := g.try(g.tryLock)
+	return ok
 }
 
 func (g *RWMutexGuard) tryLock() bool {
@@ -106,6 +121,7 @@ func (g *RWMutexGuard) tryLock() bool {
 		}
 		g.rw.sharedN, g.rw.excl = 0, g
 		g.state = RWMutexStateExclusive
+		g.acquiredAt = time.Now()
 		return true
 
 	case RWMutexStateShared:
@@ -148,38 +164,14 @@ func (g *RWMutexGuard) CanLock() (canLock bool, mutexState RWMutexState) {
 
 // RLock attempts to obtain a shared lock for the guard. Returns an error if ctx is done.
 func (g *RWMutexGuard) RLock(ctx context.Context) error {
-	if g.TryRLock() {
-		return nil
-	}
-
-	ticker := time.NewTicker(RWMutexInterval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-ticker.C:
-			if g.TryRLock() {
-				return nil
-			}
-		}
-	}
+	return g.wait(ctx, g.tryRLock)
 }
 
 // TryRLock attempts to obtain a shared lock on the mutex for the guard. This will upgrade
 // an unlocked guard and downgrade an exclusive guard. Shared guards are a no-op.
 func (g *RWMutexGuard) TryRLock() bool {
-	g.rw.mu.Lock()
-	prevState := g.rw.state()
-	v := g.tryRLock()
-	fn, newState := g.rw.OnLockStateChange, g.rw.state()
-	g.rw.mu.Unlock()
-
-	if fn != nil && prevState != newState {
-		fn(prevState, newState)
-	}
-	return v
+	ok, _ := g.try(g.tryRLock)
+	return ok
 }
 
 func (g *RWMutexGuard) tryRLock() bool {
@@ -190,6 +182,7 @@ func (g *RWMutexGuard) tryRLock() bool {
 		}
 		g.rw.sharedN++
 		g.state = RWMutexStateShared
+		g.acquiredAt = time.Now()
 		return true
 
 	case RWMutexStateShared:
@@ -199,6 +192,7 @@ func (g *RWMutexGuard) tryRLock() bool {
 		assert(g.rw.excl == g, "attempted downgrade of non-exclusive guard")
 		g.rw.sharedN, g.rw.excl = 1, nil
 		g.state = RWMutexStateShared
+		g.rw.notify()
 		return true
 
 	default:
@@ -221,34 +215,80 @@ func (g *RWMutexGuard) CanRLock() bool {
 	}
 }
 
+// wait repeatedly attempts to acquire a lock with fn until it succeeds or ctx
+// is done. Between attempts, it sleeps until the mutex changes state.
+func (g *RWMutexGuard) wait(ctx context.Context, fn func() bool) error {
+	t := time.Now()
+	for {
+		ok, ch := g.try(fn)
+		if ok {
+			if g.rw.OnWait != nil {
+				g.rw.OnWait(time.Since(t))
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+		}
+	}
+}
+
+// try attempts to acquire a lock with fn & triggers OnLockStateChange if the
+// mutex state changed. On failure, it also returns a channel that is closed
+// on the next release so that a release after the attempt is not missed.
+func (g *RWMutexGuard) try(fn func() bool) (ok bool, ch <-chan struct{}) {
+	g.rw.mu.Lock()
+	prevState := g.rw.state()
+	if ok = fn(); !ok {
+		ch = g.rw.waitCh()
+	}
+	onChange, newState := g.rw.OnLockStateChange, g.rw.state()
+	g.rw.mu.Unlock()
+
+	if onChange != nil && prevState != newState {
+		onChange(prevState, newState)
+	}
+	return ok, ch
+}
+
 // Unlock unlocks the underlying mutex.
 func (g *RWMutexGuard) Unlock() {
 	g.rw.mu.Lock()
 	prevState := g.rw.state()
-	g.unlock()
-	fn, newState := g.rw.OnLockStateChange, g.rw.state()
+	acquiredAt := g.acquiredAt
+	released := g.unlock()
+	fn, onUnlock, newState := g.rw.OnLockStateChange, g.rw.OnUnlock, g.rw.state()
 	g.rw.mu.Unlock()
 
 	if fn != nil && prevState != newState {
 		fn(prevState, newState)
 	}
+	if onUnlock != nil && released {
+		onUnlock(time.Since(acquiredAt))
+	}
 }
 
-func (g *RWMutexGuard) unlock() {
+// unlock releases the guard's lock. Returns true if a lock was held.
+func (g *RWMutexGuard) unlock() bool {
 	switch g.state {
 	case RWMutexStateUnlocked:
-		return // already unlocked, skip
+		return false // already unlocked, skip
 	case RWMutexStateShared:
 		assert(g.rw.sharedN > 0, "invalid shared lock state on unlock")
 		g.rw.sharedN--
-		g.state = RWMutexStateUnlocked
 	case RWMutexStateExclusive:
 		assert(g.rw.excl == g, "attempted unlock of non-exclusive guard")
 		g.rw.sharedN, g.rw.excl = 0, nil
-		g.state = RWMutexStateUnlocked
 	default:
 		panic("RWMutexGuard.Unlock(): unreachable")
 	}
+
+	g.state, g.acquiredAt = RWMutexStateUnlocked, time.Time{}
+	g.rw.notify()
+	return true
 }
 
 // RWMutexState represents the lock state of an RWMutex or RWMutexGuard.
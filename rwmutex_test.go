@@ -3,6 +3,8 @@ package litefs_test
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
@@ -361,3 +363,58 @@ func TestRWMutexGuard_CanRLock(t *testing.T) {
 		}
 	})
 }
+
+// Measures lock handoff latency & CPU usage while several goroutines contend
+// for an exclusive lock that is held for a short time. Reports the average
+// time spent waiting for the lock & the process CPU time per lock operation.
+func BenchmarkRWMutexGuard_Lock_Contention(b *testing.B) {
+	for _, n := range []int{2, 8, 32} {
+		b.Run(fmt.Sprintf("goroutines=%d", n), func(b *testing.B) {
+			var mu litefs.RWMutex
+			var waitNS atomic.Int64
+
+			cpu0 := processCPUTime(b)
+			b.ResetTimer()
+
+			var g errgroup.Group
+			for i := 0; i < n; i++ {
+				opN := b.N / n
+				if i < b.N%n {
+					opN++
+				}
+
+				g.Go(func() error {
+					for j := 0; j < opN; j++ {
+						guard := mu.Guard()
+						t := time.Now()
+						if err := guard.Lock(context.Background()); err != nil {
+							return err
+						}
+						waitNS.Add(int64(time.Since(t)))
+
+						time.Sleep(50 * time.Microsecond) // simulate I/O while locked
+						guard.Unlock()
+					}
+					return nil
+				})
+			}
+			if err := g.Wait(); err != nil {
+				b.Fatal(err)
+			}
+
+			b.StopTimer()
+			b.ReportMetric(float64(processCPUTime(b)-cpu0)/float64(b.N), "cpu-ns/op")
+			b.ReportMetric(float64(waitNS.Load())/float64(b.N), "wait-ns/op")
+		})
+	}
+}
+
+// processCPUTime returns the total user & system CPU time used by the process.
+func processCPUTime(tb testing.TB) time.Duration {
+	tb.Helper()
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		tb.Fatal(err)
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
@@ -10,8 +10,12 @@ import (
 	"io"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -29,9 +33,21 @@ const IDLength = 24
 const (
 	DefaultReconnectDelay = 1 * time.Second
 	DefaultDemoteDelay    = 10 * time.Second
+	DefaultHandoffDelay   = 5 * time.Second
 
 	DefaultRetention                = 10 * time.Minute
 	DefaultRetentionMonitorInterval = 1 * time.Minute
+
+	DefaultResyncRangeSize = 256
+
+	DefaultCheckpointMode            = CheckpointModePassive
+	DefaultCheckpointMonitorInterval = 1 * time.Second
+
+	DefaultDiskSpaceMonitorInterval = 5 * time.Second
+
+	DefaultBackupInterval        = 1 * time.Hour
+	DefaultBackupRetain          = 24
+	DefaultBackupMonitorInterval = 1 * time.Minute
 )
 
 // Store represents a collection of databases.
@@ -44,12 +60,21 @@ type Store struct {
 	subscribers map[*Subscriber]struct{}
 
 	isPrimary   bool          // if true, store is current primary
+	lease       Lease         // lease held while primary
 	primaryCh   chan struct{} // closed when primary loses leadership
 	primaryInfo *PrimaryInfo  // contains info about the current primary
 	candidate   bool          // if true, we are eligible to become the primary
 	readyCh     chan struct{} // closed when primary found or acquired
 	demoteCh    chan struct{} // closed when Demote() is called
 
+	primaryChangeCh chan struct{} // closed when primary status or info changes
+	settingsCh      chan struct{} // closed when settings are applied
+
+	lowDiskSpace bool // if true, free space is below MinFreeSpace
+
+	handoffNodeID string    // node receiving the lease, blocks writes while set
+	acquireAfter  time.Time // delays lease acquisition during another node's handoff
+
 	ctx    context.Context
 	cancel func()
 	g      errgroup.Group
@@ -69,10 +94,47 @@ type Store struct {
 	// Time to wait after manually demoting trying to become primary again.
 	DemoteDelay time.Duration
 
+	// Time that nodes wait for the target of a handoff to acquire the lease
+	// before attempting to acquire it themselves.
+	HandoffDelay time.Duration
+
 	// Length of time to retain LTX files.
 	Retention                time.Duration
 	RetentionMonitorInterval time.Duration
 
+	// WAL size, in bytes, at which the primary checkpoints a database using
+	// CheckpointMode. Set to zero to leave checkpointing to SQLite.
+	CheckpointThreshold       int64
+	CheckpointMode            CheckpointMode
+	CheckpointMonitorInterval time.Duration
+
+	// Minimum free space, in bytes, required on the data directory's file
+	// system. Below this, new write locks fail with ErrLowDiskSpace and LTX
+	// files are removed regardless of retention. Set to zero to disable.
+	MinFreeSpace             int64
+	DiskSpaceMonitorInterval time.Duration
+
+	// Number of pages per range checksum sent to the primary on connect. This
+	// allows a diverged replica to resync by receiving only the changed pages
+	// instead of a full snapshot. Set to zero to always use snapshots.
+	ResyncRangeSize uint32
+
+	// Directory that the primary writes periodic copies of each database to.
+	// Copies of a database are written to a subdirectory with the same name
+	// and are named after their TXID. Backups are disabled if blank.
+	BackupDir string
+
+	// Minimum time between backups of a database & the number of backups
+	// kept per database. Unchanged databases are not backed up again. Set
+	// BackupInterval to zero to disable & BackupRetain to zero to keep all.
+	BackupInterval        time.Duration
+	BackupRetain          int
+	BackupMonitorInterval time.Duration
+
+	// Per-database overrides of the store settings. Overrides are matched
+	// against the database name in order and the first match is used.
+	DBOverrides []*DBOverride
+
 	// Callback to notify kernel of file changes.
 	Invalidator Invalidator
 
@@ -97,11 +159,26 @@ func NewStore(path string, candidate bool) *Store {
 		readyCh:     make(chan struct{}),
 		demoteCh:    make(chan struct{}),
 
+		primaryChangeCh: make(chan struct{}),
+		settingsCh:      make(chan struct{}),
+
 		ReconnectDelay: DefaultReconnectDelay,
 		DemoteDelay:    DefaultDemoteDelay,
+		HandoffDelay:   DefaultHandoffDelay,
 
 		Retention:                DefaultRetention,
 		RetentionMonitorInterval: DefaultRetentionMonitorInterval,
+
+		CheckpointMode:            DefaultCheckpointMode,
+		CheckpointMonitorInterval: DefaultCheckpointMonitorInterval,
+
+		DiskSpaceMonitorInterval: DefaultDiskSpaceMonitorInterval,
+
+		BackupInterval:        DefaultBackupInterval,
+		BackupRetain:          DefaultBackupRetain,
+		BackupMonitorInterval: DefaultBackupMonitorInterval,
+
+		ResyncRangeSize: DefaultResyncRangeSize,
 	}
 	s.ctx, s.cancel = context.WithCancel(context.Background())
 
@@ -153,6 +230,24 @@ func (s *Store) Open() error {
 		s.g.Go(func() error { return s.monitorRetention(s.ctx) })
 	}
 
+	// Begin checkpoint monitor.
+	if s.CheckpointThreshold > 0 && s.CheckpointMonitorInterval > 0 {
+		s.g.Go(func() error { return s.monitorCheckpoint(s.ctx) })
+	}
+
+	// Begin disk space monitor.
+	if s.MinFreeSpace > 0 && s.DiskSpaceMonitorInterval > 0 {
+		if err := s.CheckDiskSpace(s.ctx); err != nil {
+			return fmt.Errorf("check disk space: %w", err)
+		}
+		s.g.Go(func() error { return s.monitorDiskSpace(s.ctx) })
+	}
+
+	// Begin backup monitor.
+	if s.BackupDir != "" && s.BackupMonitorInterval > 0 {
+		s.g.Go(func() error { return s.monitorBackup(s.ctx) })
+	}
+
 	return nil
 }
 
@@ -229,9 +324,18 @@ func (s *Store) openDatabase(name string) error {
 }
 
 // Close signals for the store to shut down.
-func (s *Store) Close() error {
+func (s *Store) Close() (retErr error) {
 	s.cancel()
-	return s.g.Wait()
+	retErr = s.g.Wait()
+
+	// Persist database state so that the next open is fast.
+	for _, db := range s.DBs() {
+		if err := db.Close(); err != nil && retErr == nil {
+			retErr = fmt.Errorf("close database(%q): %w", db.Name(), err)
+		}
+	}
+
+	return retErr
 }
 
 // ReadyCh returns a channel that is closed once the store has become primary
@@ -259,6 +363,27 @@ func (s *Store) Demote() {
 	s.demoteCh = make(chan struct{})
 }
 
+// BeginHandoff marks the start of a lease handoff to the given node. New
+// write locks are rejected until the handoff is canceled or a new lease is
+// acquired. Streams sent after demotion tell replicas which node to expect.
+func (s *Store) BeginHandoff(nodeID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handoffNodeID = nodeID
+}
+
+// CancelHandoff resumes writes after a failed handoff.
+func (s *Store) CancelHandoff() {
+	s.BeginHandoff("")
+}
+
+// HandoffNodeID returns the target node of the current handoff, if any.
+func (s *Store) HandoffNodeID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handoffNodeID
+}
+
 // IsPrimary returns true if store has a lease to be the primary.
 func (s *Store) IsPrimary() bool {
 	s.mu.Lock()
@@ -275,6 +400,7 @@ func (s *Store) setIsPrimary(v bool) {
 		} else {
 			close(s.primaryCh)
 		}
+		s.notifyPrimaryChange()
 	}
 
 	// Update state.
@@ -288,6 +414,22 @@ func (s *Store) setIsPrimary(v bool) {
 	}
 }
 
+// PrimaryChangeCh returns a channel that is closed when the node gains or
+// loses its primary status or when the known primary changes. A new channel
+// must be fetched after each notification.
+func (s *Store) PrimaryChangeCh() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.primaryChangeCh
+}
+
+// notifyPrimaryChange wakes up all waiters on PrimaryChangeCh.
+// Must be called while holding s.mu.
+func (s *Store) notifyPrimaryChange() {
+	close(s.primaryChangeCh)
+	s.primaryChangeCh = make(chan struct{})
+}
+
 // PrimaryCtx wraps ctx with another context that will cancel when no longer primary.
 func (s *Store) PrimaryCtx(ctx context.Context) context.Context {
 	s.mu.Lock()
@@ -295,6 +437,13 @@ func (s *Store) PrimaryCtx(ctx context.Context) context.Context {
 	return newPrimaryCtx(ctx, s.primaryCh)
 }
 
+// Lease returns the lease held by this node. Returns nil if not primary.
+func (s *Store) Lease() Lease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lease
+}
+
 // PrimaryInfo returns info about the current primary.
 func (s *Store) PrimaryInfo() *PrimaryInfo {
 	s.mu.Lock()
@@ -307,6 +456,193 @@ func (s *Store) Candidate() bool {
 	return s.candidate
 }
 
+// LowDiskSpace returns true if the free space on the data directory's file
+// system was below MinFreeSpace at the last check.
+func (s *Store) LowDiskSpace() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lowDiskSpace
+}
+
+// FreeSpace returns the number of bytes available on the file system that
+// holds the data directory.
+func (s *Store) FreeSpace() (int64, error) {
+	var statfs syscall.Statfs_t
+	if err := syscall.Statfs(s.path, &statfs); err != nil {
+		return 0, err
+	}
+	return int64(uint64(statfs.Bavail) * uint64(statfs.Bsize)), nil
+}
+
+// CheckDiskSpace updates the low disk space flag from the current free space.
+// If free space is low, LTX files are removed down to the latest file for
+// every database to reclaim space.
+func (s *Store) CheckDiskSpace(ctx context.Context) error {
+	freeSpace, err := s.FreeSpace()
+	if err != nil {
+		return fmt.Errorf("free space: %w", err)
+	}
+	storeFreeSpaceMetric.Set(float64(freeSpace))
+
+	s.mu.Lock()
+	minFreeSpace := s.MinFreeSpace
+	low := freeSpace < minFreeSpace
+	prev := s.lowDiskSpace
+	s.lowDiskSpace = low
+	s.mu.Unlock()
+
+	if low {
+		storeLowDiskSpaceMetric.Set(1)
+	} else {
+		storeLowDiskSpaceMetric.Set(0)
+	}
+
+	switch {
+	case low && !prev:
+		log.Printf("low disk space: %d bytes free, minimum is %d bytes, rejecting writes", freeSpace, minFreeSpace)
+	case !low && prev:
+		log.Printf("disk space recovered: %d bytes free, accepting writes", freeSpace)
+	}
+
+	if !low {
+		return nil
+	}
+	return s.EnforceRetention(ctx)
+}
+
+// StoreSettings represents the store settings that can be changed while the
+// store is open. See the Store fields of the same name for descriptions.
+type StoreSettings struct {
+	Retention                 time.Duration
+	RetentionMonitorInterval  time.Duration
+	Compress                  bool
+	CheckpointThreshold       int64
+	CheckpointMode            CheckpointMode
+	CheckpointMonitorInterval time.Duration
+	MinFreeSpace              int64
+	DiskSpaceMonitorInterval  time.Duration
+	BackupInterval            time.Duration
+	BackupRetain              int
+	DBOverrides               []*DBOverride
+}
+
+// Settings returns the current values of the runtime-changeable settings.
+func (s *Store) Settings() StoreSettings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.settings()
+}
+
+func (s *Store) settings() StoreSettings {
+	return StoreSettings{
+		Retention:                 s.Retention,
+		RetentionMonitorInterval:  s.RetentionMonitorInterval,
+		Compress:                  s.Compress,
+		CheckpointThreshold:       s.CheckpointThreshold,
+		CheckpointMode:            s.CheckpointMode,
+		CheckpointMonitorInterval: s.CheckpointMonitorInterval,
+		MinFreeSpace:              s.MinFreeSpace,
+		DiskSpaceMonitorInterval:  s.DiskSpaceMonitorInterval,
+		BackupInterval:            s.BackupInterval,
+		BackupRetain:              s.BackupRetain,
+		DBOverrides:               s.DBOverrides,
+	}
+}
+
+// ApplySettings updates the store settings while the store is open. Monitors
+// pick up new intervals immediately. Background monitors are only started
+// when the store is opened so settings that would enable or disable a
+// monitor are rejected.
+func (s *Store) ApplySettings(v StoreSettings) error {
+	if !v.CheckpointMode.IsValid() {
+		return fmt.Errorf("invalid checkpoint mode: %q", v.CheckpointMode)
+	}
+	for _, o := range v.DBOverrides {
+		if err := o.Validate(); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := s.settings()
+	if (prev.RetentionMonitorInterval > 0) != (v.RetentionMonitorInterval > 0) {
+		return fmt.Errorf("retention monitor cannot be enabled or disabled while running")
+	} else if (prev.CheckpointThreshold > 0 && prev.CheckpointMonitorInterval > 0) != (v.CheckpointThreshold > 0 && v.CheckpointMonitorInterval > 0) {
+		return fmt.Errorf("checkpoint monitor cannot be enabled or disabled while running")
+	} else if (prev.MinFreeSpace > 0 && prev.DiskSpaceMonitorInterval > 0) != (v.MinFreeSpace > 0 && v.DiskSpaceMonitorInterval > 0) {
+		return fmt.Errorf("disk space monitor cannot be enabled or disabled while running")
+	}
+
+	s.Retention = v.Retention
+	s.RetentionMonitorInterval = v.RetentionMonitorInterval
+	s.Compress = v.Compress
+	s.CheckpointThreshold = v.CheckpointThreshold
+	s.CheckpointMode = v.CheckpointMode
+	s.CheckpointMonitorInterval = v.CheckpointMonitorInterval
+	s.MinFreeSpace = v.MinFreeSpace
+	s.DiskSpaceMonitorInterval = v.DiskSpaceMonitorInterval
+	s.BackupInterval = v.BackupInterval
+	s.BackupRetain = v.BackupRetain
+	s.DBOverrides = v.DBOverrides
+
+	// Notify monitors so they can reset their tickers.
+	close(s.settingsCh)
+	s.settingsCh = make(chan struct{})
+
+	return nil
+}
+
+// SettingsCh returns a channel that is closed when new settings are applied.
+func (s *Store) SettingsCh() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.settingsCh
+}
+
+// DBConfig returns the effective settings for the named database. These are
+// the store settings with the first matching override applied, if any.
+func (s *Store) DBConfig(name string) DBConfig {
+	settings := s.Settings()
+
+	config := DBConfig{
+		Retention:      settings.Retention,
+		Compress:       settings.Compress,
+		Replicate:      true,
+		BackupInterval: settings.BackupInterval,
+		BackupRetain:   settings.BackupRetain,
+	}
+
+	for _, o := range settings.DBOverrides {
+		if !o.Match(name) {
+			continue
+		}
+
+		if o.Retention != nil {
+			config.Retention = *o.Retention
+		}
+		if o.Compress != nil {
+			config.Compress = *o.Compress
+		}
+		if o.Replicate != nil {
+			config.Replicate = *o.Replicate
+		}
+		if o.MaxSize != nil {
+			config.MaxSize = *o.MaxSize
+		}
+		if o.BackupInterval != nil {
+			config.BackupInterval = *o.BackupInterval
+		}
+		if o.BackupRetain != nil {
+			config.BackupRetain = *o.BackupRetain
+		}
+		break
+	}
+
+	return config
+}
+
 // DBByName returns a database by name.
 // Returns nil if the database does not exist.
 func (s *Store) DB(name string) *DB {
@@ -407,6 +743,78 @@ func (s *Store) CreateDBIfNotExists(name string) (*DB, error) {
 	return db, nil
 }
 
+// CloneDB creates a new database, newName, as a copy of the named database as
+// of txID. The current state is copied if txID is zero. The copy is imported as
+// the first transaction of the new database so it replicates like any other
+// write. Returns ErrTxNotAvailable if txID is no longer retained.
+//
+// Databases cannot be removed so if the import fails then newName is left as
+// an empty database. The clone can be retried by importing into it directly.
+func (s *Store) CloneDB(ctx context.Context, name, newName string, txID uint64) (*DB, error) {
+	if !s.IsPrimary() {
+		return nil, ErrReadOnlyReplica
+	}
+
+	src := s.DB(name)
+	if src == nil {
+		return nil, ErrDatabaseNotFound
+	} else if s.DB(newName) != nil {
+		return nil, ErrDatabaseExists
+	}
+
+	// Build the copy before creating the new database so that an unavailable
+	// transaction or a failed read of the source does not leave an empty
+	// database behind.
+	f, err := os.CreateTemp(src.Path(), ".clone-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	if txID == 0 {
+		_, err = src.writeSnapshotAt(ctx, f)
+	} else {
+		_, err = src.WriteHistoricalTo(ctx, f, txID)
+	}
+	if err != nil {
+		return nil, err
+	} else if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	db, dbFile, err := s.CreateDB(newName)
+	if err != nil {
+		return nil, err
+	} else if err := dbFile.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := db.Import(ctx, f); err != nil {
+		return nil, fmt.Errorf("import into empty database %q: %w", newName, err)
+	}
+	return db, nil
+}
+
+// PageRangeMap returns a map of databases and their page range checksums.
+// Returns nil if resync is disabled.
+func (s *Store) PageRangeMap() map[string]*PageRangeChecksums {
+	if s.ResyncRangeSize == 0 {
+		return nil
+	}
+
+	m := make(map[string]*PageRangeChecksums)
+	for _, db := range s.DBs() {
+		if db.Pos().IsZero() || db.PageSize() == 0 {
+			continue
+		}
+		m[db.Name()] = db.PageRangeChecksums(s.ResyncRangeSize)
+	}
+	return m
+}
+
 // PosMap returns a map of databases and their transactional position.
 func (s *Store) PosMap() map[string]Pos {
 	s.mu.Lock()
@@ -440,6 +848,25 @@ func (s *Store) Unsubscribe(sub *Subscriber) {
 	storeSubscriberCountMetric.Set(float64(len(s.subscribers)))
 }
 
+// WaitForTXID blocks until the named database reaches txID or ctx is done.
+// The database does not need to exist yet.
+func (s *Store) WaitForTXID(ctx context.Context, name string, txID uint64) error {
+	sub := s.Subscribe()
+	defer func() { _ = sub.Close() }()
+
+	for {
+		if db := s.DB(name); db != nil && db.Pos().TXID >= txID {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-sub.NotifyCh():
+		}
+	}
+}
+
 // MarkDirty marks a database dirty on all subscribers.
 func (s *Store) MarkDirty(name string) {
 	s.mu.Lock()
@@ -455,6 +882,7 @@ func (s *Store) markDirty(name string) {
 
 // monitorLease continuously handles either the leader lease or replicates from the primary.
 func (s *Store) monitorLease(ctx context.Context) error {
+	var handoffLease Lease
 	for {
 		// Exit if store is closed.
 		if err := ctx.Err(); err != nil {
@@ -462,7 +890,16 @@ func (s *Store) monitorLease(ctx context.Context) error {
 		}
 
 		// Attempt to either obtain a primary lock or read the current primary.
-		lease, info, err := s.acquireLeaseOrPrimaryInfo(ctx)
+		// If the previous primary handed off to us, we already have the lease.
+		var lease Lease
+		var info *PrimaryInfo
+		var err error
+		if handoffLease != nil {
+			lease, handoffLease = handoffLease, nil
+		} else {
+			lease, info, err = s.acquireLeaseOrPrimaryInfo(ctx)
+		}
+
 		if err == ErrNoPrimary && !s.candidate {
 			log.Printf("%s: cannot find primary & ineligible to become primary, retrying: %s", s.id, err)
 			sleepWithContext(ctx, s.ReconnectDelay)
@@ -487,7 +924,8 @@ func (s *Store) monitorLease(ctx context.Context) error {
 
 		// Monitor as replica if another primary already exists.
 		log.Printf("%s: existing primary found (%s), connecting as replica", s.id, info.Hostname)
-		if err := s.monitorLeaseAsReplica(ctx, info); err == nil {
+		handoffNodeID, err := s.monitorLeaseAsReplica(ctx, info)
+		if err == nil {
 			log.Printf("%s: disconnected from primary, retrying", s.id)
 		} else {
 			log.Printf("%s: disconnected from primary with error, retrying: %s", s.id, err)
@@ -495,10 +933,52 @@ func (s *Store) monitorLease(ctx context.Context) error {
 		if err := s.Recover(ctx); err != nil {
 			log.Printf("%s: state change recovery error (replica): %s", s.id, err)
 		}
+
+		// If the primary handed off to this node then take over the lease
+		// immediately. Otherwise, give the target node time to take over.
+		if handoffNodeID == s.id && s.candidate {
+			log.Printf("%s: primary handed off lease to this node, acquiring", s.id)
+			if handoffLease = s.acquireHandoffLease(ctx); handoffLease != nil {
+				continue
+			}
+		} else if handoffNodeID != "" {
+			log.Printf("%s: primary handed off lease to %s, waiting %s before acquiring", s.id, handoffNodeID, s.HandoffDelay)
+			s.mu.Lock()
+			s.acquireAfter = time.Now().Add(s.HandoffDelay)
+			s.mu.Unlock()
+		}
+
 		sleepWithContext(ctx, s.ReconnectDelay)
 	}
 }
 
+// acquireHandoffLease attempts to acquire the lease after the primary has
+// handed off to this node. The previous primary may not have released the
+// lease yet so this retries until HandoffDelay has elapsed.
+func (s *Store) acquireHandoffLease(ctx context.Context) Lease {
+	const interval = 100 * time.Millisecond
+
+	deadline := time.Now().Add(s.HandoffDelay)
+	for {
+		lease, err := s.Leaser.Acquire(ctx)
+		if err == nil {
+			return lease
+		} else if err != ErrPrimaryExists {
+			log.Printf("%s: cannot acquire handoff lease: %s", s.id, err)
+			return nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			log.Printf("%s: handoff lease not released within %s", s.id, s.HandoffDelay)
+			return nil
+		}
+		sleepWithContext(ctx, interval)
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
 func (s *Store) acquireLeaseOrPrimaryInfo(ctx context.Context) (Lease, *PrimaryInfo, error) {
 	// Attempt to find an existing primary first.
 	info, err := s.Leaser.PrimaryInfo(ctx)
@@ -510,6 +990,14 @@ func (s *Store) acquireLeaseOrPrimaryInfo(ctx context.Context) (Lease, *PrimaryI
 		return nil, &info, nil
 	}
 
+	// If another node is taking over from a handoff, give it a chance first.
+	s.mu.Lock()
+	acquireAfter := s.acquireAfter
+	s.mu.Unlock()
+	if time.Now().Before(acquireAfter) {
+		return nil, nil, fmt.Errorf("waiting for handoff: %w", ErrNoPrimary)
+	}
+
 	// If no primary, attempt to become primary.
 	lease, err := s.Leaser.Acquire(ctx)
 	if err == ErrPrimaryExists {
@@ -551,6 +1039,8 @@ func (s *Store) monitorLeaseAsPrimary(ctx context.Context, lease Lease) error {
 	// Mark as the primary node while we're in this function.
 	s.mu.Lock()
 	s.setIsPrimary(true)
+	s.lease = lease
+	s.handoffNodeID = ""
 	demoteCh := s.demoteCh
 	s.mu.Unlock()
 
@@ -562,6 +1052,7 @@ func (s *Store) monitorLeaseAsPrimary(ctx context.Context, lease Lease) error {
 		s.mu.Lock()
 		defer s.mu.Unlock()
 		s.setIsPrimary(false)
+		s.lease = nil
 	}()
 
 	waitDur := lease.TTL() / 2
@@ -604,14 +1095,15 @@ func (s *Store) monitorLeaseAsPrimary(ctx context.Context, lease Lease) error {
 }
 
 // monitorLeaseAsReplica tries to connect to the primary node and stream down changes.
-func (s *Store) monitorLeaseAsReplica(ctx context.Context, info *PrimaryInfo) error {
+func (s *Store) monitorLeaseAsReplica(ctx context.Context, info *PrimaryInfo) (handoffNodeID string, err error) {
 	if s.Client == nil {
-		return fmt.Errorf("no client set, skipping replica monitor")
+		return "", fmt.Errorf("no client set, skipping replica monitor")
 	}
 
 	// Store the URL of the primary while we're in this function.
 	s.mu.Lock()
 	s.primaryInfo = info
+	s.notifyPrimaryChange()
 	s.mu.Unlock()
 
 	// Clear the primary URL once we leave this function since we can no longer connect.
@@ -619,49 +1111,62 @@ func (s *Store) monitorLeaseAsReplica(ctx context.Context, info *PrimaryInfo) er
 		s.mu.Lock()
 		defer s.mu.Unlock()
 		s.primaryInfo = nil
+		s.notifyPrimaryChange()
 	}()
 
 	posMap := s.PosMap()
-	st, err := s.Client.Stream(ctx, info.AdvertiseURL, s.id, posMap)
+	st, err := s.Client.Stream(ctx, info.AdvertiseURL, s.id, s.candidate, posMap, s.PageRangeMap())
 	if err != nil {
-		return fmt.Errorf("connect to primary: %s ('%s')", err, info.AdvertiseURL)
+		return "", fmt.Errorf("connect to primary: %s ('%s')", err, info.AdvertiseURL)
 	}
 	defer func() { _ = st.Close() }()
 
 	for {
 		frame, err := ReadStreamFrame(st)
 		if err == io.EOF {
-			return nil // clean disconnect
+			return handoffNodeID, nil // clean disconnect
 		} else if err != nil {
-			return fmt.Errorf("next frame: %w", err)
+			return handoffNodeID, fmt.Errorf("next frame: %w", err)
 		}
 
 		switch frame := frame.(type) {
 		case *LTXStreamFrame:
-			if err := s.processLTXStreamFrame(ctx, frame, chunk.NewReader(st)); err != nil {
-				return fmt.Errorf("process ltx stream frame: %w", err)
+			if err := s.processLTXStreamFrame(ctx, frame.Name, false, chunk.NewReader(st)); err != nil {
+				return "", fmt.Errorf("process ltx stream frame: %w", err)
+			}
+		case *ResyncStreamFrame:
+			if err := s.processLTXStreamFrame(ctx, frame.Name, true, chunk.NewReader(st)); err != nil {
+				return "", fmt.Errorf("process resync stream frame: %w", err)
 			}
 		case *ReadyStreamFrame:
 			// Mark store as ready once we've received an initial replication set.
 			s.markReady()
+		case *HandoffStreamFrame:
+			// Primary is stepping down; remember which node should take over.
+			handoffNodeID = frame.NodeID
 		case *EndStreamFrame:
 			// Server cleanly disconnected
-			return nil
+			return handoffNodeID, nil
 		default:
-			return fmt.Errorf("invalid stream frame type: 0x%02x", frame.Type())
+			return "", fmt.Errorf("invalid stream frame type: 0x%02x", frame.Type())
 		}
 	}
 }
 
 // monitorRetention periodically enforces retention of LTX files on the databases.
 func (s *Store) monitorRetention(ctx context.Context) error {
-	ticker := time.NewTicker(s.RetentionMonitorInterval)
+	interval := func() time.Duration { return s.Settings().RetentionMonitorInterval }
+	ticker := time.NewTicker(interval())
 	defer ticker.Stop()
 
 	for {
+		settingsCh := s.SettingsCh()
+
 		select {
 		case <-ctx.Done():
 			return nil
+		case <-settingsCh:
+			ticker.Reset(interval())
 		case <-ticker.C:
 			if err := s.EnforceRetention(ctx); err != nil {
 				return err
@@ -670,6 +1175,250 @@ func (s *Store) monitorRetention(ctx context.Context) error {
 	}
 }
 
+// monitorCheckpoint periodically checkpoints databases on the primary whose
+// WAL has grown past the checkpoint threshold.
+func (s *Store) monitorCheckpoint(ctx context.Context) error {
+	interval := func() time.Duration { return s.Settings().CheckpointMonitorInterval }
+	ticker := time.NewTicker(interval())
+	defer ticker.Stop()
+
+	for {
+		settingsCh := s.SettingsCh()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-settingsCh:
+			ticker.Reset(interval())
+		case <-ticker.C:
+			if !s.IsPrimary() {
+				continue
+			}
+			if err := s.CheckpointIfNeeded(ctx); err != nil {
+				log.Printf("checkpoint: %s", err)
+			}
+		}
+	}
+}
+
+// monitorDiskSpace periodically checks the free space on the data directory.
+func (s *Store) monitorDiskSpace(ctx context.Context) error {
+	interval := func() time.Duration { return s.Settings().DiskSpaceMonitorInterval }
+	ticker := time.NewTicker(interval())
+	defer ticker.Stop()
+
+	for {
+		settingsCh := s.SettingsCh()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-settingsCh:
+			ticker.Reset(interval())
+		case <-ticker.C:
+			if err := s.CheckDiskSpace(ctx); err != nil {
+				log.Printf("disk space: %s", err)
+			}
+		}
+	}
+}
+
+// monitorBackup periodically writes backups of databases on the primary.
+func (s *Store) monitorBackup(ctx context.Context) error {
+	ticker := time.NewTicker(s.BackupMonitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if !s.IsPrimary() {
+				continue
+			}
+			if err := s.BackupIfNeeded(ctx); err != nil {
+				log.Printf("backup: %s", err)
+			}
+		}
+	}
+}
+
+// BackupIfNeeded writes a snapshot of every database that has changed since
+// its last backup & whose backup interval has elapsed. Old backups beyond the
+// database's retain count are then removed.
+func (s *Store) BackupIfNeeded(ctx context.Context) (err error) {
+	if s.BackupDir == "" {
+		return nil
+	}
+
+	for _, db := range s.DBs() {
+		config := s.DBConfig(db.Name())
+		if config.BackupInterval <= 0 {
+			continue
+		}
+
+		if e := s.backupDB(ctx, db, config); e != nil && err == nil {
+			err = fmt.Errorf("backup db %q: %w", db.Name(), e)
+		}
+	}
+	return err
+}
+
+func (s *Store) backupDB(ctx context.Context, db *DB, config DBConfig) error {
+	dir := filepath.Join(s.BackupDir, db.Name())
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return err
+	}
+
+	backups, err := readBackupDir(dir)
+	if err != nil {
+		return err
+	}
+
+	// Skip if the database is empty, unchanged, or backed up too recently.
+	pos := db.Pos()
+	if pos.IsZero() {
+		return nil
+	} else if n := len(backups); n > 0 {
+		if last := backups[n-1]; last.txID == pos.TXID || time.Since(last.modTime) < config.BackupInterval {
+			return nil
+		}
+	}
+
+	if err := s.writeBackup(ctx, db, dir); err != nil {
+		return err
+	}
+
+	if config.BackupRetain <= 0 {
+		return nil
+	}
+	if backups, err = readBackupDir(dir); err != nil {
+		return err
+	}
+	for i := 0; i < len(backups)-config.BackupRetain; i++ {
+		if err := os.Remove(backups[i].path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeBackup writes a snapshot of db as a SQLite database file to a temporary
+// file in dir & atomically renames it after the TXID of the snapshot.
+func (s *Store) writeBackup(ctx context.Context, db *DB, dir string) error {
+	f, err := os.CreateTemp(dir, ".backup-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	// Write the LTX snapshot to a pipe so the pages can be written in place.
+	pr, pw := io.Pipe()
+	defer func() { _ = pr.Close() }()
+	go func() {
+		_, _, err := db.WriteSnapshotTo(ctx, pw)
+		_ = pw.CloseWithError(err)
+	}()
+
+	dec := ltx.NewDecoder(pr)
+	if err := dec.DecodeHeader(); err != nil {
+		return fmt.Errorf("decode ltx header: %w", err)
+	}
+	hdr := dec.Header()
+
+	data := make([]byte, hdr.PageSize)
+	for {
+		var phdr ltx.PageHeader
+		if err := dec.DecodePage(&phdr, data); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("decode ltx page: %w", err)
+		}
+
+		if _, err := f.WriteAt(data, int64(phdr.Pgno-1)*int64(hdr.PageSize)); err != nil {
+			return err
+		}
+	}
+
+	// Verify the snapshot checksum & size the file to the commit so a
+	// trailing lock page is included.
+	if err := dec.Close(); err != nil {
+		return fmt.Errorf("close ltx decoder: %w", err)
+	} else if err := f.Truncate(int64(hdr.Commit) * int64(hdr.PageSize)); err != nil {
+		return err
+	} else if err := f.Sync(); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.Name(), filepath.Join(dir, ltx.FormatTXID(hdr.MaxTXID)+".db")); err != nil {
+		return err
+	}
+	return internal.Sync(dir)
+}
+
+// backupFile represents a backup snapshot on disk.
+type backupFile struct {
+	path    string
+	txID    uint64
+	modTime time.Time
+}
+
+// readBackupDir returns the backups in dir, sorted by TXID.
+func readBackupDir(dir string) ([]backupFile, error) {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var a []backupFile
+	for _, ent := range ents {
+		name := ent.Name()
+		if filepath.Ext(name) != ".db" {
+			continue
+		}
+		txID, err := ltx.ParseTXID(strings.TrimSuffix(name, ".db"))
+		if err != nil {
+			continue
+		}
+		fi, err := ent.Info()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, backupFile{path: filepath.Join(dir, name), txID: txID, modTime: fi.ModTime()})
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i].txID < a[j].txID })
+	return a, nil
+}
+
+// CheckpointIfNeeded checkpoints every database whose WAL size exceeds the
+// checkpoint threshold. Busy databases are skipped and retried later.
+func (s *Store) CheckpointIfNeeded(ctx context.Context) (err error) {
+	settings := s.Settings()
+	for _, db := range s.DBs() {
+		walSize, e := db.WALSize()
+		if e != nil {
+			if err == nil {
+				err = fmt.Errorf("wal size on db %q: %w", db.Name(), e)
+			}
+			continue
+		} else if walSize <= settings.CheckpointThreshold {
+			continue
+		}
+
+		if e := db.Checkpoint(ctx, settings.CheckpointMode); e == ErrCheckpointBusy {
+			continue
+		} else if e != nil && err == nil {
+			err = fmt.Errorf("checkpoint db %q: %w", db.Name(), e)
+		}
+	}
+	return err
+}
+
 // Recover forces a rollback (journal) or checkpoint (wal) on all open databases.
 // This is done when switching the primary/replica state.
 func (s *Store) Recover(ctx context.Context) (err error) {
@@ -681,16 +1430,22 @@ func (s *Store) Recover(ctx context.Context) (err error) {
 	return nil
 }
 
-// EnforceRetention enforces retention of LTX files on all databases.
+// EnforceRetention enforces retention of LTX files on all databases. If disk
+// space is low, all LTX files except the latest are removed.
 func (s *Store) EnforceRetention(ctx context.Context) (err error) {
-	// Skip enforcement if not set.
-	if s.Retention <= 0 {
-		return nil
-	}
-
-	minTime := time.Now().Add(-s.Retention).UTC()
+	now := time.Now()
+	lowDiskSpace := s.LowDiskSpace()
 
 	for _, db := range s.DBs() {
+		// Skip enforcement if not set for this database.
+		retention := s.DBConfig(db.Name()).Retention
+		if lowDiskSpace {
+			retention = 0
+		} else if retention <= 0 {
+			continue
+		}
+
+		minTime := now.Add(-retention).UTC()
 		if e := db.EnforceRetention(ctx, minTime); err == nil {
 			err = fmt.Errorf("cannot enforce retention on db %q: %w", db.Name(), e)
 		}
@@ -698,8 +1453,11 @@ func (s *Store) EnforceRetention(ctx context.Context) (err error) {
 	return nil
 }
 
-func (s *Store) processLTXStreamFrame(ctx context.Context, frame *LTXStreamFrame, src io.Reader) error {
-	db, err := s.CreateDBIfNotExists(frame.Name)
+// processLTXStreamFrame writes the LTX file from src and applies it. If resync
+// is true, the file only contains pages that differ from the local database
+// and it is based on the current checksum instead of the current TXID.
+func (s *Store) processLTXStreamFrame(ctx context.Context, name string, resync bool, src io.Reader) error {
+	db, err := s.CreateDBIfNotExists(name)
 	if err != nil {
 		return fmt.Errorf("create database: %w", err)
 	}
@@ -711,8 +1469,13 @@ func (s *Store) processLTXStreamFrame(ctx context.Context, frame *LTXStreamFrame
 	src = io.MultiReader(bytes.NewReader(data), src)
 
 	// Verify LTX file pre-apply checksum matches the current database position
-	// unless this is a snapshot, which will overwrite all data.
-	if !hdr.IsSnapshot() {
+	// unless this is a snapshot, which will overwrite all data. Resync files
+	// can change the TXID arbitrarily so only the checksum must match.
+	if resync {
+		if pos := db.Pos(); pos.PostApplyChecksum != hdr.PreApplyChecksum {
+			return fmt.Errorf("checksum mismatch on db %q resync: %016x <> %016x", db.Name(), pos.PostApplyChecksum, hdr.PreApplyChecksum)
+		}
+	} else if !hdr.IsSnapshot() {
 		expectedPos := Pos{
 			TXID:              hdr.MinTXID - 1,
 			PostApplyChecksum: hdr.PreApplyChecksum,
@@ -760,6 +1523,15 @@ func (s *Store) processLTXStreamFrame(ctx context.Context, frame *LTXStreamFrame
 		}
 	}
 
+	// Remove other LTX files after a resync as they are from diverged history.
+	if resync {
+		dir, file := filepath.Split(path)
+		log.Printf("resync received for %q, removing other ltx files: %s", db.Name(), file)
+		if err := removeFilesExcept(dir, file); err != nil {
+			return fmt.Errorf("remove ltx after resync: %w", err)
+		}
+	}
+
 	// Attempt to apply the LTX file to the database.
 	if err := db.ApplyLTX(ctx, path); err != nil {
 		return fmt.Errorf("apply ltx: %w", err)
@@ -768,6 +1540,57 @@ func (s *Store) processLTXStreamFrame(ctx context.Context, frame *LTXStreamFrame
 	return nil
 }
 
+// DBConfig represents the effective settings for a single database.
+type DBConfig struct {
+	// Length of time to retain LTX files.
+	Retention time.Duration
+
+	// If true, LTX files are compressed using LZ4.
+	Compress bool
+
+	// If true, the database is streamed to replicas.
+	Replicate bool
+
+	// Maximum size of the database, in bytes. Zero means no limit.
+	MaxSize int64
+
+	// Minimum time between backups & the number of backups to keep. Backups
+	// are disabled if the interval is zero & all are kept if retain is zero.
+	BackupInterval time.Duration
+	BackupRetain   int
+}
+
+// DBOverride represents settings that override the store defaults for
+// databases whose name matches Pattern. Nil fields use the store setting.
+type DBOverride struct {
+	// Database name or glob pattern, as used by path.Match().
+	Pattern string
+
+	Retention *time.Duration
+	Compress  *bool
+	Replicate *bool
+	MaxSize   *int64
+
+	BackupInterval *time.Duration
+	BackupRetain   *int
+}
+
+// Match returns true if name matches the override's pattern.
+func (o *DBOverride) Match(name string) bool {
+	ok, _ := path.Match(o.Pattern, name)
+	return ok
+}
+
+// Validate returns an error if the override pattern is malformed.
+func (o *DBOverride) Validate() error {
+	if o.Pattern == "" {
+		return fmt.Errorf("database override pattern required")
+	} else if _, err := path.Match(o.Pattern, ""); err != nil {
+		return fmt.Errorf("invalid database override pattern %q: %w", o.Pattern, err)
+	}
+	return nil
+}
+
 var _ expvar.Var = (*StoreVar)(nil)
 
 type StoreVar Store
@@ -775,9 +1598,10 @@ type StoreVar Store
 func (v *StoreVar) String() string {
 	s := (*Store)(v)
 	m := &storeVarJSON{
-		IsPrimary: s.IsPrimary(),
-		Candidate: s.candidate,
-		DBs:       make(map[string]*dbVarJSON),
+		IsPrimary:    s.IsPrimary(),
+		Candidate:    s.candidate,
+		LowDiskSpace: s.LowDiskSpace(),
+		DBs:          make(map[string]*dbVarJSON),
 	}
 
 	for _, db := range s.DBs() {
@@ -814,9 +1638,10 @@ func (v *StoreVar) String() string {
 }
 
 type storeVarJSON struct {
-	IsPrimary bool                  `json:"isPrimary"`
-	Candidate bool                  `json:"candidate"`
-	DBs       map[string]*dbVarJSON `json:"dbs"`
+	IsPrimary    bool                  `json:"isPrimary"`
+	Candidate    bool                  `json:"candidate"`
+	LowDiskSpace bool                  `json:"lowDiskSpace"`
+	DBs          map[string]*dbVarJSON `json:"dbs"`
 }
 
 // Subscriber subscribes to changes to databases in the store.
@@ -978,4 +1803,14 @@ var (
 		Name: "litefs_subscriber_count",
 		Help: "Number of connected subscribers",
 	})
+
+	storeFreeSpaceMetric = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "litefs_free_space_bytes",
+		Help: "Free space available on the data directory.",
+	})
+
+	storeLowDiskSpaceMetric = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "litefs_low_disk_space",
+		Help: "Set to 1 if free space is below the configured minimum.",
+	})
 )
@@ -5,8 +5,11 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math"
+	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -57,6 +60,56 @@ func TestStore_CreateDB(t *testing.T) {
 	}
 }
 
+// Ensure a database can be cloned at its current position or a retained TXID.
+func TestStore_CloneDB(t *testing.T) {
+	store := newOpenStore(t, newPrimaryStaticLeaser(), nil)
+	db, f, err := store.CreateDB("db")
+	if err != nil {
+		t.Fatal(err)
+	} else if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	pages := newTestDatabasePages(512, 2)
+	if err := db.Import(context.Background(), bytes.NewReader(bytes.Join(pages, nil))); err != nil {
+		t.Fatal(err)
+	}
+	page2 := bytes.Repeat([]byte{9}, 512)
+	applyTestLTX(t, db, 2, 0, map[uint32][]byte{2: page2}, [][]byte{pages[0], page2})
+
+	for _, tt := range []struct {
+		name string
+		txID uint64
+		want [][]byte
+	}{
+		{"current", 0, [][]byte{pages[0], page2}},
+		{"txid1", 1, pages},
+	} {
+		clone, err := store.CloneDB(context.Background(), "db", tt.name, tt.txID)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := clone.TXID(), uint64(1); got != want {
+			t.Fatalf("%s: TXID=%d, want %d", tt.name, got, want)
+		}
+
+		if buf, err := os.ReadFile(clone.DatabasePath()); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(buf, bytes.Join(tt.want, nil)) {
+			t.Fatalf("%s: database mismatch", tt.name)
+		}
+	}
+
+	if _, err := store.CloneDB(context.Background(), "db", "current", 0); err != litefs.ErrDatabaseExists {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := store.CloneDB(context.Background(), "db", "x", 10); err != litefs.ErrTxNotAvailable {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := store.CloneDB(context.Background(), "missing", "x", 0); err != litefs.ErrDatabaseNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	} else if store.DB("x") != nil {
+		t.Fatal("expected no database to be created")
+	}
+}
+
 func TestStore_Open(t *testing.T) {
 	t.Run("ExistingEmptyDB", func(t *testing.T) {
 		store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-name-only")
@@ -144,6 +197,388 @@ func TestStore_OpenAndWriteSnapshot(t *testing.T) {
 	}
 }
 
+func TestStore_DBConfig(t *testing.T) {
+	retention, compress, replicate, maxSize := 1*time.Hour, false, false, int64(4096)
+	backupInterval, backupRetain := 5*time.Minute, 288
+
+	store := litefs.NewStore(t.TempDir(), true)
+	store.Compress = true
+	store.Retention = 10 * time.Minute
+	store.BackupInterval = 1 * time.Hour
+	store.BackupRetain = 24
+	store.DBOverrides = []*litefs.DBOverride{
+		{Pattern: "events.db", Retention: &retention, MaxSize: &maxSize, BackupInterval: &backupInterval, BackupRetain: &backupRetain},
+		{Pattern: "tmp-*.db", Compress: &compress, Replicate: &replicate},
+		{Pattern: "*.db", Retention: &retention},
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		if got, want := store.DBConfig("config"), (litefs.DBConfig{Retention: 10 * time.Minute, Compress: true, Replicate: true, BackupInterval: 1 * time.Hour, BackupRetain: 24}); got != want {
+			t.Fatalf("config=%#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("ExactName", func(t *testing.T) {
+		if got, want := store.DBConfig("events.db"), (litefs.DBConfig{Retention: 1 * time.Hour, Compress: true, Replicate: true, MaxSize: 4096, BackupInterval: 5 * time.Minute, BackupRetain: 288}); got != want {
+			t.Fatalf("config=%#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("Glob", func(t *testing.T) {
+		if got, want := store.DBConfig("tmp-1.db"), (litefs.DBConfig{Retention: 10 * time.Minute, Compress: false, Replicate: false, BackupInterval: 1 * time.Hour, BackupRetain: 24}); got != want {
+			t.Fatalf("config=%#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("FirstMatchWins", func(t *testing.T) {
+		if got, want := store.DBConfig("other.db"), (litefs.DBConfig{Retention: 1 * time.Hour, Compress: true, Replicate: true, BackupInterval: 1 * time.Hour, BackupRetain: 24}); got != want {
+			t.Fatalf("config=%#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("ErrInvalidPattern", func(t *testing.T) {
+		o := &litefs.DBOverride{Pattern: "[a-"}
+		if err := o.Validate(); err == nil || err.Error() != `invalid database override pattern "[a-": syntax error in pattern` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// Ensure backups are written for changed databases & pruned to the retain count.
+func TestStore_BackupIfNeeded(t *testing.T) {
+	zero := time.Duration(0)
+
+	store := newOpenStore(t, newPrimaryStaticLeaser(), nil)
+	store.BackupDir = t.TempDir()
+
+	settings := store.Settings()
+	settings.BackupInterval = 1 * time.Nanosecond
+	settings.BackupRetain = 2
+	settings.DBOverrides = []*litefs.DBOverride{{Pattern: "skip", BackupInterval: &zero}}
+	if err := store.ApplySettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	const pageSize = 512
+	pages := newTestDatabasePages(pageSize, 3)
+	for _, name := range []string{"db", "skip"} {
+		db, f, err := store.CreateDB(name)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := f.Close(); err != nil {
+			t.Fatal(err)
+		} else if err := db.Import(context.Background(), bytes.NewReader(bytes.Join(pages, nil))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db := store.DB("db")
+
+	// readBackups returns the names of the backups of db.
+	readBackups := func() (names []string) {
+		ents, err := os.ReadDir(filepath.Join(store.BackupDir, "db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ent := range ents {
+			names = append(names, ent.Name())
+		}
+		return names
+	}
+
+	t.Run("Initial", func(t *testing.T) {
+		if err := store.BackupIfNeeded(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := readBackups(), []string{"0000000000000001.db"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("backups=%v, want %v", got, want)
+		}
+
+		// Backup should be a copy of the database.
+		if buf, err := os.ReadFile(filepath.Join(store.BackupDir, "db", "0000000000000001.db")); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(buf, bytes.Join(pages, nil)) {
+			t.Fatal("backup mismatch")
+		}
+
+		// Databases with a zero interval should not be backed up.
+		if _, err := os.Stat(filepath.Join(store.BackupDir, "skip")); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Unchanged", func(t *testing.T) {
+		if err := store.BackupIfNeeded(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := readBackups(), []string{"0000000000000001.db"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("backups=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Retain", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			page2 := bytes.Repeat([]byte{byte(10 + i)}, pageSize)
+			applyTestLTX(t, db, 3, 0, map[uint32][]byte{2: page2}, [][]byte{pages[0], page2, pages[2]})
+			if err := store.BackupIfNeeded(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if got, want := readBackups(), []string{"0000000000000002.db", "0000000000000003.db"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("backups=%v, want %v", got, want)
+		}
+	})
+}
+
+// Ensure page checksums are persisted on close and reused on the next open.
+func TestStore_ChecksumFile(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-and-write-snapshot")
+		if err := store.Open(); err != nil {
+			t.Fatal(err)
+		}
+		pos := store.DB("sqlite.db").Pos()
+
+		if err := store.Close(); err != nil {
+			t.Fatal(err)
+		} else if _, err := os.Stat(store.DB("sqlite.db").ChecksumPath()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Reopen and ensure the checksum file is consumed.
+		other := newStore(t, newPrimaryStaticLeaser(), nil)
+		testingutil.MustCopyDir(t, store.Path(), other.Path())
+		if err := other.Open(); err != nil {
+			t.Fatal(err)
+		}
+
+		db := other.DB("sqlite.db")
+		if got, want := db.Pos(), pos; got != want {
+			t.Fatalf("pos=%s, want %s", got, want)
+		} else if _, err := os.Stat(db.ChecksumPath()); !os.IsNotExist(err) {
+			t.Fatalf("expected checksum file to be removed: %v", err)
+		}
+
+		var buf bytes.Buffer
+		if _, _, err := db.WriteSnapshotTo(context.Background(), &buf); err != nil {
+			t.Fatal(err)
+		} else if err := ltx.NewDecoder(&buf).Verify(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// Ensure changes to the database file while the node is stopped are
+	// detected instead of trusting the checksum file.
+	t.Run("DatabaseChanged", func(t *testing.T) {
+		store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-and-write-snapshot")
+		if err := store.Open(); err != nil {
+			t.Fatal(err)
+		}
+		db := store.DB("sqlite.db")
+		if err := store.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if f, err := os.OpenFile(db.DatabasePath(), os.O_RDWR, 0666); err != nil {
+			t.Fatal(err)
+		} else if _, err := f.WriteAt([]byte("\xff\xff\xff\xff"), int64(db.PageSize())+200); err != nil {
+			t.Fatal(err)
+		} else if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		other := litefs.NewStore(store.Path(), true)
+		other.Leaser = newPrimaryStaticLeaser()
+		if err := other.Open(); err == nil || !strings.Contains(err.Error(), "does not match LTX post-apply checksum") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// Ensure a corrupt checksum file falls back to reading the database.
+	t.Run("Corrupt", func(t *testing.T) {
+		store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-and-write-snapshot")
+		if err := os.WriteFile(filepath.Join(store.Path(), "dbs", "sqlite.db", "checksums"), []byte("LFSC-garbage"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Open(); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if _, _, err := store.DB("sqlite.db").WriteSnapshotTo(context.Background(), &buf); err != nil {
+			t.Fatal(err)
+		} else if err := ltx.NewDecoder(&buf).Verify(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestStore_CheckDiskSpace(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-and-write-snapshot")
+		store.MinFreeSpace = 1
+		if err := store.Open(); err != nil {
+			t.Fatal(err)
+		} else if store.LowDiskSpace() {
+			t.Fatal("expected sufficient disk space")
+		}
+
+		if ok, err := store.DB("sqlite.db").TryLocks(context.Background(), 1, []litefs.LockType{litefs.LockTypeReserved}); err != nil {
+			t.Fatal(err)
+		} else if !ok {
+			t.Fatal("expected lock")
+		}
+	})
+
+	t.Run("LowDiskSpace", func(t *testing.T) {
+		store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-and-write-snapshot")
+		store.MinFreeSpace = math.MaxInt64
+		if err := store.Open(); err != nil {
+			t.Fatal(err)
+		} else if !store.LowDiskSpace() {
+			t.Fatal("expected low disk space")
+		}
+
+		// Write locks should be rejected but read locks are still allowed.
+		db := store.DB("sqlite.db")
+		if _, err := db.TryLocks(context.Background(), 1, []litefs.LockType{litefs.LockTypeReserved}); err != litefs.ErrLowDiskSpace {
+			t.Fatalf("unexpected error: %v", err)
+		} else if !db.TryRLocks(context.Background(), 1, []litefs.LockType{litefs.LockTypeShared}) {
+			t.Fatal("expected read lock")
+		}
+
+		// Only the latest LTX file should remain.
+		if ents, err := db.ReadLTXDir(); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(ents), 1; got != want {
+			t.Fatalf("len=%d, want %d", got, want)
+		}
+	})
+}
+
+func TestStore_BeginHandoff(t *testing.T) {
+	store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-and-write-snapshot")
+	if err := store.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Write locks should be rejected during a handoff.
+	store.BeginHandoff("node2")
+	if got, want := store.HandoffNodeID(), "node2"; got != want {
+		t.Fatalf("HandoffNodeID=%q, want %q", got, want)
+	}
+	db := store.DB("sqlite.db")
+	if _, err := db.TryLocks(context.Background(), 1, []litefs.LockType{litefs.LockTypeReserved}); err != litefs.ErrReadOnlyReplica {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !db.TryRLocks(context.Background(), 1, []litefs.LockType{litefs.LockTypeShared}) {
+		t.Fatal("expected read lock")
+	}
+	db.Unlock(context.Background(), 1, []litefs.LockType{litefs.LockTypeShared})
+
+	// Writes resume once the handoff is canceled.
+	store.CancelHandoff()
+	if ok, err := db.TryLocks(context.Background(), 2, []litefs.LockType{litefs.LockTypeReserved}); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("expected lock")
+	}
+}
+
+func TestStore_PrimaryChangeCh(t *testing.T) {
+	store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-and-write-snapshot")
+	ch := store.PrimaryChangeCh()
+	if err := store.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for primary change")
+	}
+	if !store.IsPrimary() {
+		t.Fatal("expected primary")
+	}
+}
+
+func TestStore_ApplySettings(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-and-write-snapshot")
+		if err := store.Open(); err != nil {
+			t.Fatal(err)
+		}
+
+		settings := store.Settings()
+		settings.Retention = 1 * time.Hour
+		settings.CheckpointMode = litefs.CheckpointModeTruncate
+		ch := store.SettingsCh()
+		if err := store.ApplySettings(settings); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case <-ch:
+		default:
+			t.Fatal("expected settings notification")
+		}
+		if got, want := store.Settings().Retention, 1*time.Hour; got != want {
+			t.Fatalf("Retention=%s, want %s", got, want)
+		} else if got, want := store.Settings().CheckpointMode, litefs.CheckpointModeTruncate; got != want {
+			t.Fatalf("CheckpointMode=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("ErrMonitorDisabled", func(t *testing.T) {
+		store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-and-write-snapshot")
+		if err := store.Open(); err != nil {
+			t.Fatal(err)
+		}
+
+		settings := store.Settings()
+		settings.RetentionMonitorInterval = 0
+		if err := store.ApplySettings(settings); err == nil || err.Error() != `retention monitor cannot be enabled or disabled while running` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrInvalidCheckpointMode", func(t *testing.T) {
+		store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-and-write-snapshot")
+		settings := store.Settings()
+		settings.CheckpointMode = "RESTART"
+		if err := store.ApplySettings(settings); err == nil || err.Error() != `invalid checkpoint mode: "RESTART"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestStore_WaitForTXID(t *testing.T) {
+	store := newStoreFromFixture(t, newPrimaryStaticLeaser(), nil, "testdata/store/open-and-write-snapshot")
+	if err := store.Open(); err != nil {
+		t.Fatal(err)
+	}
+	txID := store.DB("sqlite.db").Pos().TXID
+
+	t.Run("OK", func(t *testing.T) {
+		if err := store.WaitForTXID(context.Background(), "sqlite.db", txID); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := store.WaitForTXID(ctx, "sqlite.db", txID+1); err != context.DeadlineExceeded {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("DatabaseNotFound", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := store.WaitForTXID(ctx, "no-such-db", 1); err != context.DeadlineExceeded {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
 func TestPrimaryInfo_Clone(t *testing.T) {
 	t.Run("OK", func(t *testing.T) {
 		info := &litefs.PrimaryInfo{Hostname: "foo", AdvertiseURL: "bar"}
@@ -225,7 +660,7 @@ func TestStore_PrimaryCtx(t *testing.T) {
 		}
 
 		client := mock.Client{
-			StreamFunc: func(ctx context.Context, rawurl string, id string, posMap map[string]litefs.Pos) (io.ReadCloser, error) {
+			StreamFunc: func(ctx context.Context, rawurl string, id string, candidate bool, posMap map[string]litefs.Pos, rangeMap map[string]*litefs.PageRangeChecksums) (io.ReadCloser, error) {
 				return io.NopCloser(&bytes.Buffer{}), nil
 			},
 		}
@@ -255,7 +690,7 @@ func TestStore_PrimaryCtx(t *testing.T) {
 	t.Run("InitialReplica", func(t *testing.T) {
 		leaser := litefs.NewStaticLeaser(false, "localhost", "http://localhost:20202")
 		client := mock.Client{
-			StreamFunc: func(ctx context.Context, rawurl string, id string, posMap map[string]litefs.Pos) (io.ReadCloser, error) {
+			StreamFunc: func(ctx context.Context, rawurl string, id string, candidate bool, posMap map[string]litefs.Pos, rangeMap map[string]*litefs.PageRangeChecksums) (io.ReadCloser, error) {
 				var buf bytes.Buffer
 				if err := litefs.WriteStreamFrame(&buf, &litefs.ReadyStreamFrame{}); err != nil {
 					return nil, err